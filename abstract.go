@@ -0,0 +1,95 @@
+// Extract the abstract and title block of a document.
+
+package mmark
+
+import (
+	"bytes"
+	htmllib "html"
+	"strings"
+)
+
+// Abstract is the abstract of a document and its title block.
+type Abstract struct {
+	TitleBlock *TitleBlock
+	HTML       []byte // the abstract rendered as HTML, empty if there is none
+	Text       string // the abstract as plain text, paragraphs separated by a blank line
+}
+
+// ParseAbstract returns the abstract, the .# Abstract section, and the title block
+// of input. Only those are parsed, not the rest of the document, which makes this
+// cheap enough for indexes of many documents and announcement emails.
+func ParseAbstract(input []byte, extensions int) *Abstract {
+	input = normalizeInput(input)
+	titleBlock, abstract := abstractSource(input)
+	if extensions&EXTENSION_TITLEBLOCK_TOML == 0 {
+		titleBlock = nil
+	}
+	source := append(append(append([]byte{}, titleBlock...), '\n'), abstract...)
+	doc := ParseDocument(source, HtmlRenderer(0, "", ""), extensions)
+	a := &Abstract{TitleBlock: doc.TitleBlock, HTML: bytes.TrimSpace(doc.Body)}
+	if len(abstract) > 0 {
+		a.Text = htmllib.UnescapeString(string(bytes.TrimSpace(sanitizeXML(append([]byte{}, a.HTML...)))))
+	} else {
+		a.HTML = nil
+	}
+	return a
+}
+
+// abstractSource returns the lines of the title block at the start of input and
+// the text of the abstract: the lines after .# Abstract up to the next header
+// or {mainmatter}.
+func abstractSource(input []byte) (titleBlock, abstract []byte) {
+	lines := bytes.SplitAfter(input, []byte("\n"))
+	i := 0
+	for i < len(lines) && len(bytes.TrimSpace(lines[i])) == 0 {
+		i++
+	}
+	beg := i
+	for i < len(lines) && bytes.HasPrefix(lines[i], []byte("%")) {
+		i++
+	}
+	titleBlock = bytes.Join(lines[beg:i], nil)
+
+	fence := ""
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(string(lines[i]))
+		if abstract != nil {
+			if fence == "" && (strings.HasPrefix(line, "#") || strings.HasPrefix(line, ".#") ||
+				strings.HasPrefix(line, "-#") || strings.HasPrefix(line, "{mainmatter}") || strings.HasPrefix(line, "{backmatter}")) {
+				break
+			}
+			abstract = append(abstract, lines[i]...)
+			if f := fenceMarker(line); f != "" && (fence == "" || f == fence) {
+				if fence == "" {
+					fence = f
+				} else {
+					fence = ""
+				}
+			}
+			continue
+		}
+		if isAbstractHeader(line) {
+			abstract = []byte{}
+		}
+	}
+	return titleBlock, abstract
+}
+
+// isAbstractHeader returns true if line is the .# Abstract header, with or without an {#id}.
+func isAbstractHeader(line string) bool {
+	if !strings.HasPrefix(line, ".#") {
+		return false
+	}
+	f := strings.Fields(line[2:])
+	return len(f) > 0 && strings.EqualFold(f[0], "abstract")
+}
+
+// fenceMarker returns the fence, ``` or ~~~, that line starts with.
+func fenceMarker(line string) string {
+	for _, f := range []string{"```", "~~~"} {
+		if strings.HasPrefix(line, f) {
+			return f
+		}
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package mmark
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAbstract(t *testing.T) {
+	input := `% title = "The Title"
+% [[author]]
+% fullname = "Jane Doe"
+
+.# Abstract
+
+This *document* describes "things".
+
+~~~
+# not a header
+~~~
+
+.# Note
+
+Not part of the abstract.
+
+{mainmatter}
+
+# Introduction
+`
+	a := ParseAbstract([]byte(input), commonXmlExtensions|EXTENSION_TITLEBLOCK_TOML)
+	if a.TitleBlock == nil || a.TitleBlock.Title != "The Title" || len(a.TitleBlock.Author) != 1 || a.TitleBlock.Author[0].Fullname != "Jane Doe" {
+		t.Errorf("expected the title block, got %+v", a.TitleBlock)
+	}
+	expected := "<p>This <em>document</em> describes &quot;things&quot;.</p>\n\n<pre><code># not a header\n</code></pre>"
+	if string(a.HTML) != expected {
+		t.Errorf("expected %q, got %q", expected, a.HTML)
+	}
+	if expected := "This document describes \"things\".\n\n# not a header"; a.Text != expected {
+		t.Errorf("expected %q, got %q", expected, a.Text)
+	}
+	if strings.Contains(string(a.HTML), "Not part") {
+		t.Errorf("expected the abstract to end at the next header, got %q", a.HTML)
+	}
+
+	if a := ParseAbstract([]byte("# Introduction\n\nText.\n"), commonXmlExtensions); a.HTML != nil || a.Text != "" || a.TitleBlock != nil {
+		t.Errorf("expected no abstract, got %+v", a)
+	}
+}
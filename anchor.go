@@ -0,0 +1,121 @@
+// Header anchors: prefixes, suffixes, aliases of renamed sections and conflicts.
+
+package mmark
+
+import (
+	"sort"
+	"strings"
+)
+
+// HeaderIDPrefix and HeaderIDSuffix are added to the header IDs created from the
+// header text with EXTENSION_AUTO_HEADER_IDS, e.g. "sec-", not to IDs given with {#id}.
+var (
+	HeaderIDPrefix string
+	HeaderIDSuffix string
+)
+
+// headerID returns the ID for a header with text.
+func headerID(text string) string {
+	return HeaderIDPrefix + createSanitizedAnchorName(text) + HeaderIDSuffix
+}
+
+// anchorRef is a cross reference to an anchor on a line.
+type anchorRef struct {
+	id   string
+	line int
+}
+
+// headerAliases records the aliases of the header with id, the former IDs of a renamed
+// section: {aliases="old-name older-name"}. HTML keeps them as extra anchors.
+func (p *parser) headerAliases(id string) {
+	if p.ial == nil || id == "" {
+		return
+	}
+	for _, a := range strings.Fields(p.ial.Value("aliases")) {
+		if p.anchorAliases == nil {
+			p.anchorAliases = map[string]string{}
+		}
+		p.anchorAliases[a] = id
+	}
+}
+
+// anchorReference records a cross reference to id, see renamedAnchors.
+func (p *parser) anchorReference(id string) {
+	p.anchorRefs = append(p.anchorRefs, anchorRef{id, p.line})
+}
+
+// renamedAnchors warns about the cross references to an alias of a header.
+func (p *parser) renamedAnchors() {
+	defer p.phaseEnd("validation", p.phaseStart())
+	line := p.line
+	defer func() { p.line = line }()
+	for _, r := range p.anchorRefs {
+		if id, ok := p.anchorAliases[r.id]; ok {
+			p.line = r.line
+			warnf(p, "cross reference to `%s', which is now `%s'", r.id, id)
+		}
+	}
+}
+
+// elementAnchor records id as the anchor of a section, figure or other element, see
+// anchorConflicts.
+func (p *parser) elementAnchor(id string) {
+	if id == "" {
+		return
+	}
+	if p.elementAnchors == nil {
+		p.elementAnchors = map[string]int{}
+	}
+	if _, ok := p.elementAnchors[id]; !ok {
+		p.elementAnchors[id] = p.line
+	}
+}
+
+// captionAnchor records id, which the renderer made up for a numbered figure
+// or table, see anchorConflicts.
+func (p *parser) captionAnchor(id string) {
+	if p == nil {
+		return
+	}
+	if p.captionAnchors == nil {
+		p.captionAnchors = map[string]int{}
+	}
+	if _, ok := p.captionAnchors[id]; !ok {
+		p.captionAnchors[id] = p.line
+	}
+}
+
+// anchorConflicts reports the citations whose anchor is also the anchor of an
+// element in the document, XML2RFC rejects the duplicate anchors. It also
+// reports the generated figure and table anchors that a section already uses.
+func (p *parser) anchorConflicts() {
+	defer p.phaseEnd("validation", p.phaseStart())
+	line := p.line
+	defer func() { p.line = line }()
+	_, _, keys := countCitationsAndSort(p.citations)
+	for _, k := range keys {
+		if l, ok := p.elementAnchors[k]; ok {
+			p.line = l
+			errorf(p, "reference anchor `%s' is also the anchor of a section or figure", k)
+		}
+	}
+	keys = keys[:0]
+	for k := range p.captionAnchors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if l, ok := p.elementAnchors[k]; ok {
+			p.line = p.captionAnchors[k]
+			errorf(p, "generated anchor `%s' is also the anchor of the section or figure on line %d, give it an id", k, l)
+		}
+	}
+}
+
+// aliasList returns the aliases in ial, sorted, and drops them from ial.
+func aliasList(ial *inlineAttr) []string {
+	aliases := strings.Fields(ial.Value("aliases"))
+	ial.DropAttr("aliases")
+	sort.Strings(aliases)
+	return aliases
+}
@@ -0,0 +1,148 @@
+// Authors read from vCard and JSON contact files.
+
+package mmark
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// authorFiles fills the empty fields of the authors in a from the contact file
+// they reference with file = "alice.vcf". The file is either a vCard (.vcf) or
+// JSON with the same fields as the author table (.json). Like other included files
+// they are only read with EXTENSION_INCLUDE and are found with includeFile.
+func (p *parser) authorFiles(a []author) {
+	for i := range a {
+		if a[i].File == "" {
+			continue
+		}
+		if p.flags&EXTENSION_INCLUDE == 0 {
+			errorf(p, "author file `%s' is not read, includes are not enabled", a[i].File)
+			continue
+		}
+		file, err := includeFile(a[i].File)
+		if err != nil {
+			errorf(p, "error in author file: %s", err.Error())
+			continue
+		}
+		c, err := readAuthorFile(file)
+		if err != nil {
+			errorf(p, "error in author file: %s", err.Error())
+			continue
+		}
+		a[i].merge(c)
+	}
+}
+
+func readAuthorFile(file string) (author, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return author{}, err
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".vcf", ".vcard":
+		return parseVCard(data)
+	case ".json":
+		var a author
+		if err := json.Unmarshal(data, &a); err != nil {
+			return author{}, fmt.Errorf("`%s': %s", file, err)
+		}
+		return a, nil
+	}
+	return author{}, fmt.Errorf("`%s': not a .vcf or .json file", file)
+}
+
+// parseVCard returns the author in the first card of data, it uses FN, N, ORG,
+// ROLE, EMAIL, TEL, URL and ADR. Of properties given multiple times the first is used.
+func parseVCard(data []byte) (author, error) {
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	// unfold lines, continuation lines start with a space or a tab
+	data = bytes.Replace(data, []byte("\n "), nil, -1)
+	data = bytes.Replace(data, []byte("\n\t"), nil, -1)
+
+	var a author
+	begin := false
+	for _, line := range strings.Split(string(data), "\n") {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		name, value := strings.ToUpper(line[:i]), line[i+1:]
+		if j := strings.Index(name, ";"); j >= 0 {
+			name = name[:j] // drop parameters, TYPE=work etc.
+		}
+		if j := strings.LastIndex(name, "."); j >= 0 {
+			name = name[j+1:] // drop group, item1.EMAIL
+		}
+
+		switch name {
+		case "BEGIN":
+			begin = true
+		case "END":
+			return a, nil
+		case "FN":
+			mergeString(&a.Fullname, vcardValue(value))
+		case "N":
+			n := vcardValues(value)
+			mergeString(&a.Surname, n[0])
+			if len(n) > 1 && a.Initials == "" {
+				for _, given := range strings.Fields(n[1]) {
+					a.Initials += string([]rune(given)[:1]) + "."
+				}
+			}
+		case "ORG":
+			mergeString(&a.Organization, vcardValues(value)[0])
+		case "ROLE":
+			mergeString(&a.Role, vcardValue(value))
+		case "EMAIL":
+			mergeString(&a.Address.Email, vcardValue(value))
+		case "TEL":
+			mergeString(&a.Address.Phone, strings.TrimPrefix(vcardValue(value), "tel:"))
+		case "URL":
+			mergeString(&a.Address.Uri, vcardValue(value))
+		case "ADR":
+			if !a.Address.Postal.empty() {
+				continue
+			}
+			// post office box; extended address; street; locality; region; postal code; country
+			adr := vcardValues(value)
+			for len(adr) < 7 {
+				adr = append(adr, "")
+			}
+			a.Address.Postal.Street = strings.TrimSpace(strings.Join([]string{adr[1], adr[2]}, " "))
+			a.Address.Postal.City = adr[3]
+			a.Address.Postal.Region = adr[4]
+			a.Address.Postal.Code = adr[5]
+			a.Address.Postal.Country = adr[6]
+		}
+	}
+	if !begin {
+		return a, fmt.Errorf("no BEGIN:VCARD found")
+	}
+	return a, nil
+}
+
+// vcardValues splits a structured vCard value on unescaped semicolons.
+func vcardValues(value string) []string {
+	values := []string{}
+	beg := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ';':
+			values = append(values, vcardValue(value[beg:i]))
+			beg = i + 1
+		}
+	}
+	return append(values, vcardValue(value[beg:]))
+}
+
+// vcardValue removes the escaping from a vCard value.
+func vcardValue(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(strings.TrimSpace(value))
+}
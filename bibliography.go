@@ -0,0 +1,201 @@
+// Export the bibliography of a document as bibxml, BibTeX, CSL-JSON or text.
+
+package mmark
+
+import (
+	"encoding/json"
+	xmllib "encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// bibXML is the part of a raw XML reference the bibliography needs.
+type bibXML struct {
+	Target string `xml:"target,attr"`
+	Front  struct {
+		Title  string      `xml:"title"`
+		Author []refAuthor `xml:"author"`
+		Date   refDate     `xml:"date"`
+	} `xml:"front"`
+	Format refFormat `xml:"format"`
+}
+
+// newReference returns the reference for the citation c of anchor.
+func newReference(p *parser, anchor string, c *citation) Reference {
+	ref := Reference{Anchor: anchor, Normative: c.typ == 'n'}
+	if len(c.xml) == 0 {
+		ref.URL = referenceFile(p, c)
+		return ref
+	}
+	ref.xml = c.xml
+	var b bibXML
+	if err := xmllib.Unmarshal(c.xml, &b); err != nil {
+		warnf(p, "failed to unmarshal reference: `%s': %s", anchor, err)
+		return ref
+	}
+	ref.Title, ref.Year, ref.Target = b.Front.Title, b.Front.Date.Year, b.Target
+	if ref.Target == "" {
+		ref.Target = b.Format.Target
+	}
+	for _, a := range b.Front.Author {
+		name := a.Fullname
+		if name == "" {
+			name = strings.TrimSpace(a.Initials + " " + a.Surname)
+		}
+		ref.Authors = append(ref.Authors, name)
+	}
+	return ref
+}
+
+// Bibliography returns the references input cites, sorted on anchor.
+func Bibliography(input []byte, extensions int) []Reference {
+	return ParseDocument(input, XmlRenderer(0), extensions).References
+}
+
+// name returns the title of r, or for RFCs and I-Ds without one, their name.
+func (r Reference) name() string {
+	switch {
+	case r.Title != "":
+		return r.Title
+	case strings.HasPrefix(r.Anchor, "RFC"):
+		return "RFC " + r.Anchor[3:]
+	case strings.HasPrefix(r.Anchor, "I-D."):
+		return "draft-" + r.Anchor[4:]
+	}
+	return r.Anchor
+}
+
+// link returns the URL where r can be read.
+func (r Reference) link() string {
+	switch {
+	case r.Target != "":
+		return r.Target
+	case strings.HasPrefix(r.Anchor, "RFC"):
+		return "https://www.rfc-editor.org/info/rfc" + r.Anchor[3:]
+	case strings.HasPrefix(r.Anchor, "I-D."):
+		return "https://datatracker.ietf.org/doc/draft-" + r.Anchor[4:] + "/"
+	}
+	return ""
+}
+
+// WriteBibXML writes refs as a bibxml <references> element: the included XML of a
+// reference or an xi:include of its URL.
+func WriteBibXML(w io.Writer, refs []Reference) error {
+	if _, err := io.WriteString(w, "<references xmlns:xi=\"http://www.w3.org/2001/XInclude\">\n"); err != nil {
+		return err
+	}
+	for _, r := range refs {
+		var err error
+		if r.xml != nil {
+			_, err = fmt.Fprintf(w, "%s\n", r.xml)
+		} else {
+			_, err = fmt.Fprintf(w, "<xi:include href=\"%s\"/>\n", escapeString(r.URL))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</references>\n")
+	return err
+}
+
+// bibTeXEscaper escapes the characters that are special in a BibTeX field value,
+// bibTeXURLEscaper only those that would break the url field.
+var (
+	bibTeXEscaper = strings.NewReplacer(
+		`\`, `\textbackslash{}`, "{", `\{`, "}", `\}`, "%", `\%`, "&", `\&`, "#", `\#`)
+	bibTeXURLEscaper = strings.NewReplacer("%", `\%`, "#", `\#`)
+)
+
+// WriteBibTeX writes refs as BibTeX @misc entries.
+func WriteBibTeX(w io.Writer, refs []Reference) error {
+	for _, r := range refs {
+		fields := [][2]string{{"title", bibTeXEscaper.Replace(r.name())}}
+		if len(r.Authors) > 0 {
+			fields = append(fields, [2]string{"author", bibTeXEscaper.Replace(strings.Join(r.Authors, " and "))})
+		}
+		if r.Year != "" {
+			fields = append(fields, [2]string{"year", bibTeXEscaper.Replace(r.Year)})
+		}
+		if l := r.link(); l != "" {
+			fields = append(fields, [2]string{"url", bibTeXURLEscaper.Replace(l)})
+		}
+		if _, err := fmt.Fprintf(w, "@misc{%s,\n", r.Anchor); err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if _, err := fmt.Fprintf(w, "  %s = {%s},\n", f[0], f[1]); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "}\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type cslName struct {
+	Literal string `json:"literal"`
+}
+
+type cslDate struct {
+	DateParts [][]string `json:"date-parts"`
+}
+
+type cslItem struct {
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	Title  string    `json:"title"`
+	Author []cslName `json:"author,omitempty"`
+	Issued *cslDate  `json:"issued,omitempty"`
+	URL    string    `json:"URL,omitempty"`
+}
+
+// WriteCSLJSON writes refs as CSL-JSON, as used by citeproc and pandoc.
+func WriteCSLJSON(w io.Writer, refs []Reference) error {
+	items := []cslItem{}
+	for _, r := range refs {
+		item := cslItem{ID: r.Anchor, Type: "document", Title: r.name(), URL: r.link()}
+		if strings.HasPrefix(r.Anchor, "RFC") || strings.HasPrefix(r.Anchor, "I-D.") {
+			item.Type = "report"
+		}
+		for _, a := range r.Authors {
+			item.Author = append(item.Author, cslName{a})
+		}
+		if r.Year != "" {
+			item.Issued = &cslDate{[][]string{{r.Year}}}
+		}
+		items = append(items, item)
+	}
+	buf, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", buf)
+	return err
+}
+
+// WriteBibText writes refs as text, one reference per paragraph:
+//
+//	[RFC2119]  "RFC 2119", <https://www.rfc-editor.org/info/rfc2119>.
+func WriteBibText(w io.Writer, refs []Reference) error {
+	for _, r := range refs {
+		s := "[" + r.Anchor + "]  "
+		if len(r.Authors) > 0 {
+			s += strings.Join(r.Authors, ", ") + ", "
+		}
+		s += "\"" + r.name() + "\""
+		if r.Year != "" {
+			s += ", " + r.Year
+		}
+		if l := r.link(); l != "" {
+			s += ", <" + l + ">"
+		}
+		if _, err := io.WriteString(w, s+".\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
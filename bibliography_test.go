@@ -0,0 +1,73 @@
+package mmark
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBibliography(t *testing.T) {
+	input := `See [@!RFC2119] and [@haskell].
+
+<reference anchor='haskell' target='http://www.haskell.org/'>
+<front>
+<title>Haskell</title>
+<author fullname='Simon Peyton Jones'/>
+<author initials='P.' surname='Hudak'/>
+<date year='1990'/>
+</front>
+</reference>
+
+That's all.
+`
+	refs := Bibliography([]byte(input), EXTENSION_CITATION)
+	if len(refs) != 2 {
+		t.Fatalf("expected 2 references, got %+v", refs)
+	}
+	if r := refs[1]; r.Anchor != "haskell" || r.Title != "Haskell" || r.Year != "1990" || len(r.Authors) != 2 || r.Authors[1] != "P. Hudak" {
+		t.Errorf("unexpected reference: %+v", r)
+	}
+
+	for _, test := range []struct {
+		write    func(w *bytes.Buffer) error
+		expected []string
+	}{
+		{func(w *bytes.Buffer) error { return WriteBibXML(w, refs) }, []string{
+			"<xi:include href=\"" + CitationsRFC + "reference.RFC.2119.xml\"/>\n",
+			"<reference anchor='haskell' target='http://www.haskell.org/'>",
+		}},
+		{func(w *bytes.Buffer) error { return WriteBibTeX(w, refs) }, []string{
+			"@misc{RFC2119,\n  title = {RFC 2119},\n  url = {https://www.rfc-editor.org/info/rfc2119},\n}\n",
+			"  author = {Simon Peyton Jones and P. Hudak},\n  year = {1990},\n",
+		}},
+		{func(w *bytes.Buffer) error { return WriteCSLJSON(w, refs) }, []string{
+			"\"id\": \"RFC2119\",\n    \"type\": \"report\"",
+			"\"date-parts\": [\n        [\n          \"1990\"",
+		}},
+		{func(w *bytes.Buffer) error { return WriteBibText(w, refs) }, []string{
+			"[haskell]  Simon Peyton Jones, P. Hudak, \"Haskell\", 1990, <http://www.haskell.org/>.\n",
+		}},
+	} {
+		buf := &bytes.Buffer{}
+		if err := test.write(buf); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range test.expected {
+			if !strings.Contains(buf.String(), e) {
+				t.Errorf("expected %q in %q", e, buf)
+			}
+		}
+	}
+}
+
+func TestBibliographyBibTeXEscape(t *testing.T) {
+	refs := []Reference{{Anchor: "x", Title: "100% {Fast} & #1", Authors: []string{`A\B`}, Target: "http://example.com/a%20b#c"}}
+	buf := &bytes.Buffer{}
+	if err := WriteBibTeX(buf, refs); err != nil {
+		t.Fatal(err)
+	}
+	expected := "@misc{x,\n  title = {100\\% \\{Fast\\} \\& \\#1},\n  author = {A\\textbackslash{}B},\n  url = {http://example.com/a\\%20b\\#c},\n}\n\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf)
+	}
+}
@@ -0,0 +1,461 @@
+// References from the bibliography sources of the title block.
+
+package mmark
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// bibliography are the sources of the references, for instance:
+//
+//	[bibliography]
+//	directories = ["refs"]
+//	files = ["extra.bib", "extra.xml"]
+//	template = "https://bib.ietf.org/public/rfc/bibxml-nist/{{.Anchor}}.xml"
+//	[bibliography.cache]
+//	directory = "refcache"
+//	expiry = "168h"
+//
+// A cited reference is looked up in the files, then in the directories and
+// otherwise its file is given by the template, see ReferenceFile. With a cache
+// directory a reference given by an http or https URL is fetched and kept in the
+// cache. The files and directories are only read with EXTENSION_INCLUDE.
+type bibliography struct {
+	Directories []string // bibxml directories, with reference.RFC.2119.xml or RFC2119.xml files
+	Files       []string // BibTeX (.bib) files and XML files with <reference> elements
+	Template    string   // like ReferenceFile, the file or URL of the other references
+	Cache       bibCache
+}
+
+// bibCache is where fetched references are kept and for how long.
+type bibCache struct {
+	Directory string // the references are fetched only when set
+	Expiry    string // a duration, like "24h", the default is defaultBibCacheExpiry
+}
+
+const defaultBibCacheExpiry = 7 * 24 * time.Hour
+
+// referenceSources fills in the XML, or the file, of the citations without one
+// from the bibliography sources of the title block.
+func (p *parser) referenceSources() {
+	b := p.bibliography
+	if len(b.Directories) == 0 && len(b.Files) == 0 && b.Template == "" && b.Cache.Directory == "" {
+		return
+	}
+	if p.flags&EXTENSION_INCLUDE == 0 && (len(b.Directories) > 0 || len(b.Files) > 0 || b.Cache.Directory != "") {
+		// the files and directories are read like included files
+		errorf(p, "bibliography files and directories are not read, includes are not enabled")
+		b.Directories, b.Files, b.Cache.Directory = nil, nil, ""
+		p.bibliography = b
+	}
+	expiry := defaultBibCacheExpiry
+	if b.Cache.Expiry != "" {
+		var err error
+		if expiry, err = time.ParseDuration(b.Cache.Expiry); err != nil {
+			errorf(p, "error in bibliography cache expiry: %s", err)
+			expiry = defaultBibCacheExpiry
+		}
+	}
+	refs := map[string][]byte{}
+	for _, f := range b.Files {
+		p.readReferences(f, refs)
+	}
+	var tmpl *template.Template
+	if b.Template != "" {
+		var err error
+		if tmpl, err = template.New("reference").Parse(b.Template); err != nil {
+			errorf(p, "error in bibliography template: %s", err)
+		}
+	}
+
+	for anchor, c := range p.citations {
+		if c.xml != nil || c.link == nil {
+			continue
+		}
+		if xml, ok := refs[anchor]; ok {
+			c.xml = xml
+			continue
+		}
+		if xml := p.directoryReference(c); xml != nil {
+			c.xml = xml
+			continue
+		}
+		if tmpl != nil {
+			f := defaultReferenceFile(c)
+			if file, err := executeReferenceTemplate(tmpl, c, f); err == nil {
+				c.file = file
+			} else {
+				referenceTemplateError(p, c, err, f)
+			}
+		}
+		if b.Cache.Directory != "" {
+			c.xml = p.cachedReference(referenceFile(p, c), expiry)
+		}
+	}
+}
+
+// cachedReference returns the XML of the reference at url from the cache directory,
+// when it is younger than expiry, or fetches it and puts it in the cache. If the
+// fetch fails an expired copy is used. Nil is returned if url isn't http or https,
+// or there is no reference.
+func (p *parser) cachedReference(url string, expiry time.Duration) []byte {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil
+	}
+	dir, err := includeFile(p.bibliography.Cache.Directory)
+	if err != nil {
+		errorf(p, "error in bibliography cache: %s", err)
+		return nil
+	}
+	file := filepath.Join(dir, path.Base(url))
+	cached, err := ioutil.ReadFile(file)
+	if err == nil {
+		if fi, err := os.Stat(file); err == nil && time.Since(fi.ModTime()) < expiry {
+			return firstReference(cached)
+		}
+	}
+
+	data, err := fetchReference(url)
+	if err != nil {
+		if cached != nil {
+			warnf(p, "error fetching reference %s: %s, using the expired copy in the cache", url, err)
+			return firstReference(cached)
+		}
+		warnf(p, "error fetching reference %s: %s", url, err)
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err == nil {
+		err = ioutil.WriteFile(file, data, 0644)
+	}
+	if err != nil {
+		warnf(p, "error writing bibliography cache: %s", err)
+	}
+	return firstReference(data)
+}
+
+// fetchReference returns the content of url.
+func fetchReference(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// firstReference returns the first <reference> element in data.
+func firstReference(data []byte) []byte {
+	if refs := xmlReferences(normalizeInput(data)); len(refs) > 0 {
+		return refs[0].xml
+	}
+	return nil
+}
+
+// readReferences adds the references in the BibTeX or XML file f to refs.
+func (p *parser) readReferences(f string, refs map[string][]byte) {
+	name, err := includeFile(f)
+	if err != nil {
+		errorf(p, "error in bibliography: %s", err)
+		return
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		errorf(p, "error in bibliography: %s", err)
+		return
+	}
+	data = normalizeInput(data)
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".bib":
+		entries, err := parseBibTeX(data)
+		if err != nil {
+			errorf(p, "error in bibliography: `%s': %s", f, err)
+		}
+		for _, e := range entries {
+			refs[e.key] = e.xml()
+		}
+	case ".xml":
+		for _, ref := range xmlReferences(data) {
+			refs[ref.anchor] = ref.xml
+		}
+	default:
+		errorf(p, "error in bibliography: `%s': not a .bib or .xml file", f)
+	}
+}
+
+// directoryReference returns the XML of c from the first bibliography directory
+// that has it, as the file of the xml2rfc tools site or as the anchor with .xml.
+func (p *parser) directoryReference(c *citation) []byte {
+	names := []string{string(c.link) + ".xml"}
+	if f := defaultReferenceFile(c); f != "" {
+		names = append([]string{path.Base(f)}, names...)
+	}
+	for _, dir := range p.bibliography.Directories {
+		for _, n := range names {
+			name, err := includeFile(filepath.Join(dir, n))
+			if err != nil {
+				continue
+			}
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				continue
+			}
+			if xml := firstReference(data); xml != nil {
+				return xml
+			}
+		}
+	}
+	return nil
+}
+
+type xmlReference struct {
+	anchor string
+	xml    []byte
+}
+
+// xmlReferences returns the <reference> elements in data.
+func xmlReferences(data []byte) []xmlReference {
+	refs := []xmlReference{}
+	for {
+		beg := bytes.Index(data, []byte("<reference "))
+		if beg < 0 {
+			return refs
+		}
+		end := bytes.Index(data[beg:], []byte("</reference>"))
+		if end < 0 {
+			return refs
+		}
+		end += beg + len("</reference>")
+		ref := data[beg:end]
+		if anchor := xmlAttr(ref, "anchor"); anchor != "" {
+			refs = append(refs, xmlReference{anchor: anchor, xml: ref})
+		}
+		data = data[end:]
+	}
+}
+
+// xmlAttr returns the value of the attribute name of the element that starts tag.
+func xmlAttr(tag []byte, name string) string {
+	end := bytes.IndexByte(tag, '>')
+	if end < 0 {
+		return ""
+	}
+	tag = tag[:end]
+	i := bytes.Index(tag, []byte(" "+name+"="))
+	if i < 0 {
+		return ""
+	}
+	i += len(name) + 2
+	if i >= len(tag) {
+		return ""
+	}
+	quote := tag[i]
+	j := bytes.IndexByte(tag[i+1:], quote)
+	if j < 0 {
+		return ""
+	}
+	return string(tag[i+1 : i+1+j])
+}
+
+// bibEntry is an entry of a BibTeX file.
+type bibEntry struct {
+	typ    string // article, book, misc, ...
+	key    string
+	fields map[string]string
+}
+
+// parseBibTeX returns the entries of the BibTeX data. Field values can be given
+// between braces, between quotes or as a number; @string, @preamble and @comment
+// are skipped. Entries up to a syntax error are returned with the error.
+func parseBibTeX(data []byte) ([]bibEntry, error) {
+	s := string(data)
+	entries := []bibEntry{}
+	for {
+		at := strings.IndexByte(s, '@')
+		if at < 0 {
+			return entries, nil
+		}
+		s = s[at+1:]
+		open := strings.IndexAny(s, "{(")
+		if open < 0 {
+			return entries, fmt.Errorf("no { after @%s", firstWord(s))
+		}
+		typ := strings.ToLower(strings.TrimSpace(s[:open]))
+		body, rest, ok := balanced(s[open:])
+		if !ok {
+			return entries, fmt.Errorf("unbalanced braces in @%s", typ)
+		}
+		s = rest
+		switch typ {
+		case "string", "preamble", "comment":
+			continue
+		}
+		e, err := parseBibEntry(typ, body)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+// parseBibEntry parses the body of an entry: key, name = value, ...
+func parseBibEntry(typ, body string) (bibEntry, error) {
+	e := bibEntry{typ: typ, fields: map[string]string{}}
+	comma := strings.IndexByte(body, ',')
+	if comma < 0 {
+		e.key = strings.TrimSpace(body)
+		return e, nil
+	}
+	e.key = strings.TrimSpace(body[:comma])
+	s := body[comma+1:]
+	for {
+		s = strings.TrimLeft(s, " \t\n,")
+		if s == "" {
+			return e, nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return e, fmt.Errorf("no = after %s in @%s{%s", firstWord(s), typ, e.key)
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t\n")
+		var value string
+		switch {
+		case strings.HasPrefix(s, "{"):
+			v, rest, ok := balanced(s)
+			if !ok {
+				return e, fmt.Errorf("unbalanced braces in %s of @%s{%s", name, typ, e.key)
+			}
+			value, s = v, rest
+		case strings.HasPrefix(s, `"`):
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return e, fmt.Errorf("unterminated string in %s of @%s{%s", name, typ, e.key)
+			}
+			value, s = s[1:end+1], s[end+2:]
+		default:
+			end := strings.IndexAny(s, ",\n")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = strings.TrimSpace(s[:end]), s[end:]
+		}
+		value = strings.NewReplacer("{", "", "}", "").Replace(value)
+		e.fields[name] = strings.Join(strings.Fields(value), " ")
+	}
+}
+
+// balanced returns what is between the opening brace or parenthesis s starts
+// with and the matching closing one, and the rest of s after that.
+func balanced(s string) (inside, rest string, ok bool) {
+	open, end := s[0], byte('}')
+	if open == '(' {
+		end = ')'
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case open:
+			depth++
+		case end:
+			depth--
+			if depth == 0 {
+				return s[1:i], s[i+1:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func firstWord(s string) string {
+	if f := strings.Fields(s); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+// xml returns e as an XML2RFC reference.
+func (e bibEntry) xml() []byte {
+	var b bytes.Buffer
+	target := e.fields["url"]
+	if target == "" && e.fields["doi"] != "" {
+		target = "https://doi.org/" + e.fields["doi"]
+	}
+	b.WriteString("<reference anchor=\"" + escapeString(e.key) + "\"")
+	if target != "" {
+		b.WriteString(" target=\"" + escapeString(target) + "\"")
+	}
+	b.WriteString(">\n<front>\n")
+	b.WriteString("<title>" + escapeString(e.fields["title"]) + "</title>\n")
+	for _, a := range e.authors() {
+		b.WriteString("<author fullname=\"" + escapeString(a) + "\"/>\n")
+	}
+	if org := e.organization(); org != "" {
+		b.WriteString("<author><organization>" + escapeString(org) + "</organization></author>\n")
+	}
+	b.WriteString("<date")
+	if y := e.fields["year"]; y != "" {
+		b.WriteString(" year=\"" + escapeString(y) + "\"")
+	}
+	if m := bibMonth(e.fields["month"]); m != "" {
+		b.WriteString(" month=\"" + m + "\"")
+	}
+	b.WriteString("/>\n</front>\n")
+	if doi := e.fields["doi"]; doi != "" {
+		b.WriteString("<seriesInfo name=\"DOI\" value=\"" + escapeString(doi) + "\"/>\n")
+	}
+	b.WriteString("</reference>")
+	return b.Bytes()
+}
+
+// authors returns the authors of e as "First Last", from "Last, First and First Last".
+func (e bibEntry) authors() []string {
+	if e.fields["author"] == "" {
+		return nil
+	}
+	authors := []string{}
+	for _, a := range strings.Split(e.fields["author"], " and ") {
+		if i := strings.Index(a, ","); i >= 0 {
+			a = strings.TrimSpace(a[i+1:]) + " " + strings.TrimSpace(a[:i])
+		}
+		authors = append(authors, strings.TrimSpace(a))
+	}
+	return authors
+}
+
+// organization returns the organization of e, when it has no authors.
+func (e bibEntry) organization() string {
+	if e.fields["author"] != "" {
+		return ""
+	}
+	for _, f := range []string{"organization", "institution", "publisher"} {
+		if e.fields[f] != "" {
+			return e.fields[f]
+		}
+	}
+	return ""
+}
+
+// bibMonth returns the name of the month m, given as a number or an abbreviation.
+func bibMonth(m string) string {
+	m = strings.ToLower(strings.TrimSpace(m))
+	for i := time.January; i <= time.December; i++ {
+		name := i.String()
+		if m == fmt.Sprint(int(i)) || (len(m) >= 3 && strings.HasPrefix(strings.ToLower(name), m)) {
+			return name
+		}
+	}
+	return ""
+}
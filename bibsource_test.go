@@ -0,0 +1,133 @@
+package mmark
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBibTeX(t *testing.T) {
+	input := `@comment{ignored}
+@string{ietf = "IETF"}
+@article{knuth84,
+  author = {Knuth, Donald E. and Leslie Lamport},
+  title = "Literate {P}rogramming",
+  year = 1984, month = may,
+  doi = {10.1093/comjnl/27.2.97}
+}
+@misc(nist, title = {SHA-3 Standard}, organization = {NIST})
+`
+	entries, err := parseBibTeX([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v", entries)
+	}
+	expected := `<reference anchor="knuth84" target="https://doi.org/10.1093/comjnl/27.2.97">
+<front>
+<title>Literate Programming</title>
+<author fullname="Donald E. Knuth"/>
+<author fullname="Leslie Lamport"/>
+<date year="1984" month="May"/>
+</front>
+<seriesInfo name="DOI" value="10.1093/comjnl/27.2.97"/>
+</reference>`
+	if actual := string(entries[0].xml()); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if actual := string(entries[1].xml()); !strings.Contains(actual, "<author><organization>NIST</organization></author>") {
+		t.Errorf("expected NIST as the organization, got %q", actual)
+	}
+}
+
+func TestTitleBlockBibliography(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "refs"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "refs", "reference.RFC.2119.xml"),
+		[]byte("<?xml version='1.0' encoding='UTF-8'?>\r\n<reference anchor='RFC2119'><front><title>Key words</title></front></reference>\r\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "extra.bib"), []byte("@misc{foo, title = {Foo}}\n"), 0644)
+
+	input := `% title = "x"
+% [bibliography]
+% directories = ["` + filepath.Join(dir, "refs") + `"]
+% files = ["` + filepath.Join(dir, "extra.bib") + `"]
+% template = "https://example.org/{{.Anchor}}.xml"
+
+See [@RFC2119], [@foo] and [@bar].
+`
+	output, diags := ParseDiagnostics([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML|EXTENSION_CITATION|EXTENSION_INCLUDE)
+	for _, expected := range []string{
+		"<reference anchor='RFC2119'><front><title>Key words</title></front></reference>\n",
+		"<reference anchor=\"foo\">\n<front>\n<title>Foo</title>\n",
+		"<xi:include href=\"https://example.org/bar.xml\"/>",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+	if len(diags) != 0 {
+		t.Errorf("expected no diagnostics, got %v", diags)
+	}
+	output, diags = ParseDiagnostics([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML|EXTENSION_CITATION)
+	if strings.Contains(output.String(), "Key words") || len(diags) != 1 || !strings.Contains(diags[0].Message, "includes are not enabled") {
+		t.Errorf("expected the bibliography files not to be read without includes, got %v", diags)
+	}
+}
+
+func TestBibliographyCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fetched := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		w.Write([]byte("<reference anchor='RFC2119'><front><title>Key words</title></front></reference>\n"))
+	}))
+
+	input := `% title = "x"
+% [bibliography]
+% template = "` + server.URL + `/{{.Anchor}}.xml"
+% [bibliography.cache]
+% directory = "` + filepath.Join(dir, "cache") + `"
+% expiry = "1h"
+
+See [@RFC2119].
+`
+	extensions := EXTENSION_TITLEBLOCK_TOML | EXTENSION_CITATION | EXTENSION_INCLUDE
+	for i := 0; i < 2; i++ {
+		output, diags := ParseDiagnostics([]byte(input), XmlRenderer(XML_STANDALONE), extensions)
+		if expected := "<reference anchor='RFC2119'><front><title>Key words</title></front></reference>\n"; !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+		if len(diags) != 0 {
+			t.Errorf("expected no diagnostics, got %v", diags)
+		}
+	}
+	if fetched != 1 {
+		t.Errorf("expected the reference to be fetched once, got %d", fetched)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cache", "RFC2119.xml")); err != nil {
+		t.Errorf("expected the reference in the cache: %s", err)
+	}
+
+	// expired, and the server is gone: the expired copy is used
+	server.Close()
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "cache", "RFC2119.xml"), old, old)
+	output, diags := ParseDiagnostics([]byte(input), XmlRenderer(XML_STANDALONE), extensions)
+	if !strings.Contains(output.String(), "Key words") || len(diags) != 1 || !strings.Contains(diags[0].Message, "using the expired copy") {
+		t.Errorf("expected the expired copy with a warning, got %v", diags)
+	}
+}
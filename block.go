@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"strconv"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Parse block-level data.
@@ -18,18 +19,32 @@ func (p *parser) block(out *bytes.Buffer, data []byte) {
 
 	// this is called recursively: enforce a maximum depth
 	if p.nesting >= p.maxNesting {
+		p.flatten(out, data)
 		return
 	}
 	p.nesting++
 
 	// parse out one block-level construct at a time
 	for len(data) > 0 {
+		p.trackLine(data)
+		p.transliterateBlock(out)
+		p.section.mark(p, out)
+		if DebugLogger != nil {
+			trace(p, "block", "nesting", p.nesting, "size", len(data))
+		}
+
 		// IAL
 		//
 		// {.class #id key=value}
 		if data[0] == '{' {
 			if j := p.isInlineAttr(data); j > 0 {
 				data = data[j:]
+				if p.ial != nil {
+					p.elementAnchor(p.ial.id)
+				}
+				if p.ial != nil && p.ial.Key("format") != " " {
+					data = data[p.formatBlock(out, data):]
+				}
 				continue
 			}
 		}
@@ -319,6 +334,8 @@ func (p *parser) block(out *bytes.Buffer, data []byte) {
 		// note: this finds underlined headers, too
 		data = data[p.paragraph(out, data):]
 	}
+	p.transliterateBlock(out)
+	p.section.end(p, out)
 
 	p.nesting--
 }
@@ -407,7 +424,7 @@ func (p *parser) prefixHeader(out *bytes.Buffer, data []byte) int {
 	}
 	if end > i {
 		if id == "" && p.flags&EXTENSION_AUTO_HEADER_IDS != 0 {
-			id = createSanitizedAnchorName(string(data[i:end]))
+			id = headerID(string(data[i:end]))
 		}
 		work := func() bool {
 			p.inline(out, data[i:end])
@@ -423,6 +440,9 @@ func (p *parser) prefixHeader(out *bytes.Buffer, data []byte) int {
 			}
 		}
 
+		p.sectionFootnotes(out, level)
+		p.headerAliases(id)
+		p.elementAnchor(id)
 		p.r.SetAttr(p.ial)
 		p.ial = nil
 
@@ -576,7 +596,7 @@ func (p *parser) specialHeader(out *bytes.Buffer, data []byte) int {
 	}
 	if end > i {
 		if id == "" && p.flags&EXTENSION_AUTO_HEADER_IDS != 0 {
-			id = createSanitizedAnchorName(string(data[i:end]))
+			id = headerID(string(data[i:end]))
 		}
 		work := func() bool {
 			p.inline(out, data[i:end])
@@ -601,6 +621,7 @@ func (p *parser) specialHeader(out *bytes.Buffer, data []byte) int {
 					p.anchors[id] = 1
 				}
 			}
+			p.elementAnchor(id)
 			p.r.SpecialHeader(out, name, work, id)
 		default: // A note section
 			// There is no id for notes, but we still give it to the method.
@@ -670,7 +691,7 @@ func (p *parser) partHeader(out *bytes.Buffer, data []byte) int {
 	}
 	if end > i {
 		if id == "" && p.flags&EXTENSION_AUTO_HEADER_IDS != 0 {
-			id = createSanitizedAnchorName(string(data[i:end]))
+			id = headerID(string(data[i:end]))
 		}
 		work := func() bool {
 			p.inline(out, data[i:end])
@@ -686,6 +707,7 @@ func (p *parser) partHeader(out *bytes.Buffer, data []byte) int {
 			}
 		}
 
+		p.elementAnchor(id)
 		p.r.SetAttr(p.ial)
 		p.ial = nil
 
@@ -757,8 +779,9 @@ func (p *parser) documentMatter(out *bytes.Buffer, what int) int {
 		p.r.DocumentMatter(out, what)
 		return len(main)
 	case _DOC_BACK_MATTER:
+		p.sectionFootnotes(out, 1)
 		p.r.DocumentMatter(out, what)
-		p.r.References(out, p.citations)
+		p.references(out)
 		p.appendix = true
 		return len(back)
 	}
@@ -967,8 +990,11 @@ func (p *parser) htmlReference(out *bytes.Buffer, data []byte, doRender bool) in
 			}
 			anchorStr := string(data[anchor+7+1 : i-1])
 			if c, ok := p.citations[anchorStr]; !ok {
-				p.citations[anchorStr] = &citation{xml: data[:end]}
+				p.citations[anchorStr] = &citation{xml: data[:end], line: p.line}
 			} else {
+				if c.xml != nil {
+					errorf(p, "reference anchor `%s' is defined twice", anchorStr)
+				}
 				c.xml = data[:end]
 			}
 		}
@@ -1152,6 +1178,18 @@ func (p *parser) isFencedCode(data []byte, syntax **string, oldmarker string) (s
 		}
 
 		language := string(data[syntaxStart : syntaxStart+syn])
+
+		// the rest of the line holds key=value pairs
+		paramStart := i
+		for i < len(data) && data[i] != '\n' {
+			i++
+		}
+		if params := bytes.TrimSpace(data[paramStart:i]); len(params) > 0 {
+			if c == '`' && bytes.IndexByte(params, '`') >= 0 { // a code span
+				return
+			}
+			language += " " + string(params)
+		}
 		*syntax = &language
 	}
 
@@ -1261,21 +1299,31 @@ func (p *parser) fencedCode(out *bytes.Buffer, data []byte, doRender bool) int {
 		}
 	}
 
-	syntax := ""
+	info := CodeInfo{}
 	if lang != nil {
-		syntax = *lang
+		info = parseCodeInfo(*lang)
 	}
 
 	if doRender {
+		if p.flags&EXTENSION_IANA != 0 && info.Lang == "iana" {
+			p.ial = nil
+			p.iana(out, work.Bytes())
+			return j
+		}
+		if p.flags&EXTENSION_CODE_COMPONENTS != 0 && p.ial != nil && p.ial.Value("component") == "true" {
+			p.components = append(p.components, component{info: info, code: append([]byte{}, work.Bytes()...)})
+			p.ial = nil
+			return j
+		}
 		p.r.SetAttr(p.ial)
 		p.ial = nil
 		if co != "" {
 			var callout bytes.Buffer
 			callouts(p, &callout, work.Bytes(), 0, co)
-			p.r.BlockCode(out, callout.Bytes(), syntax, caption.Bytes(), p.insideFigure, true)
+			p.r.BlockCode(out, callout.Bytes(), info, caption.Bytes(), p.insideFigure, true)
 		} else {
 			p.callouts = nil
-			p.r.BlockCode(out, work.Bytes(), syntax, caption.Bytes(), p.insideFigure, false)
+			p.r.BlockCode(out, work.Bytes(), info, caption.Bytes(), p.insideFigure, false)
 		}
 	}
 
@@ -1295,6 +1343,7 @@ func (p *parser) table(out *bytes.Buffer, data []byte) int {
 
 	foot := false
 
+	defer func(line int) { p.line = line }(p.line)
 	for i < len(data) {
 		if j := p.isTableFooter(data[i:]); j > 0 && !foot {
 			foot = true
@@ -1315,6 +1364,7 @@ func (p *parser) table(out *bytes.Buffer, data []byte) int {
 
 		// include the newline in data sent to tableRow
 		i++
+		p.line = p.lineAt(bytes.Count(data[:rowStart], []byte("\n")))
 		if foot {
 			p.tableRow(&footer, data[rowStart:i], columns, false)
 			continue
@@ -1601,6 +1651,12 @@ func (p *parser) tableRow(out *bytes.Buffer, data []byte, columns []int, header
 	i, col := 0, 0
 	var rowWork bytes.Buffer
 
+	if cells := tableCells(data); cells < len(columns) {
+		warnf(p, "table row has %d cells instead of %d, padding it with empty cells", cells, len(columns))
+	} else if cells > len(columns) {
+		warnf(p, "table row has %d cells instead of %d, dropping the extra cells", cells, len(columns))
+	}
+
 	if data[i] == '|' && !isBackslashEscaped(data, i) {
 		i++
 	}
@@ -1663,11 +1719,30 @@ func (p *parser) tableRow(out *bytes.Buffer, data []byte, columns []int, header
 		}
 	}
 
-	// silently ignore rows with too many cells
-
 	p.r.TableRow(out, rowWork.Bytes())
 }
 
+// tableCells returns the number of cells in the table row data, pipes at the
+// beginning or end of the line don't start a cell.
+func tableCells(data []byte) int {
+	i, cells := 0, 1
+	for i = 0; i < len(data) && data[i] != '\n'; i++ {
+		if data[i] == '|' && !isBackslashEscaped(data, i) {
+			cells++
+		}
+	}
+	for i > 0 && data[i-1] == ' ' {
+		i--
+	}
+	if i > 0 && data[0] == '|' {
+		cells--
+	}
+	if i > 1 && data[i-1] == '|' && !isBackslashEscaped(data, i-1) {
+		cells--
+	}
+	return cells
+}
+
 func (p *parser) blockTableRow(out []bytes.Buffer, colspans []int, data []byte) {
 	i, col := 0, 0
 
@@ -1836,11 +1911,11 @@ func (p *parser) code(out *bytes.Buffer, data []byte) int {
 		var callout bytes.Buffer
 		callouts(p, &callout, work.Bytes(), 0, co)
 		p.inline(&capb, caption)
-		p.r.BlockCode(out, callout.Bytes(), "", capb.Bytes(), p.insideFigure, true)
+		p.r.BlockCode(out, callout.Bytes(), CodeInfo{}, capb.Bytes(), p.insideFigure, true)
 	} else {
 		p.callouts = nil
 		p.inline(&capb, caption)
-		p.r.BlockCode(out, work.Bytes(), "", capb.Bytes(), p.insideFigure, false)
+		p.r.BlockCode(out, work.Bytes(), CodeInfo{}, capb.Bytes(), p.insideFigure, false)
 	}
 
 	return j
@@ -2314,11 +2389,166 @@ gatherlines:
 	return line
 }
 
+// ParagraphSentences is the maximum number of sentences in a top-level paragraph,
+// longer paragraphs are split at sentence boundaries and rendered as several
+// paragraphs. Zero, the default, disables the splitting.
+var ParagraphSentences int
+
 // render a single paragraph that has already been parsed out
 func (p *parser) renderParagraph(out *bytes.Buffer, data []byte) {
 	if len(data) == 0 {
 		return
 	}
+	// {wrap="hard"} keeps the line breaks of this paragraph, {wrap="soft"} joins them
+	// even with EXTENSION_HARD_LINE_BREAK.
+	if p.ial != nil && p.ial.Key("wrap") != " " {
+		wrap := p.ial.Value("wrap")
+		p.ial.DropAttr("wrap")
+		defer func(flags int) { p.flags = flags }(p.flags)
+		switch wrap {
+		case "hard":
+			p.flags |= EXTENSION_HARD_LINE_BREAK
+		case "soft":
+			p.flags &^= EXTENSION_HARD_LINE_BREAK
+		default:
+			warnf(p, "unknown wrap %q, use hard or soft", wrap)
+		}
+	}
+	// {dir="rtl" lang="he"} sets the direction and language of this paragraph.
+	dir := textDirection(p.ial)
+	if dir != nil {
+		switch d := dir.Value("dir"); d {
+		case "", "ltr", "rtl", "auto":
+		default:
+			warnf(p, "unknown dir %q, use ltr, rtl or auto", d)
+		}
+	}
+	if p.nesting == 1 {
+		p.paragraphSrc = data
+		defer func() { p.paragraphSrc = nil }()
+		if ParagraphSentences > 0 {
+			for _, part := range splitSentences(data, ParagraphSentences) {
+				p.renderParagraphPart(out, part, dir)
+			}
+			return
+		}
+	}
+	p.renderParagraphPart(out, data, dir)
+}
+
+// splitSentences splits the paragraph data into parts of at most max sentences,
+// each ending in a newline. Sentences end in '.', '!' or '?' followed by a word
+// starting with an upper case letter; code spans, links and emphasis are never split.
+func splitSentences(data []byte, max int) [][]byte {
+	parts := [][]byte{}
+	beg, n := 0, 0
+	code := 0        // length of the backtick run that opened the code span
+	nest := []byte{} // closing ']' and ')' of the links we're in
+	emph := []byte{} // the delimiters of the open emphasis, one per character
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '\\':
+			i++
+		case c == '`':
+			l := runLength(data[i:], c)
+			switch code {
+			case 0:
+				code = l
+			case l:
+				code = 0
+			}
+			i += l - 1
+		case code > 0:
+		case c == '[':
+			nest = append(nest, ']')
+		case c == '(' && (i > 0 && data[i-1] == ']' || len(nest) > 0 && nest[len(nest)-1] == ')'):
+			nest = append(nest, ')')
+		case len(nest) > 0 && c == nest[len(nest)-1]:
+			nest = nest[:len(nest)-1]
+		case len(nest) > 0 && nest[len(nest)-1] == ')': // link destination
+		case c == '*' || c == '_' || c == '~':
+			l := runLength(data[i:], c)
+			emph = emphasisDelimiter(data, i, l, emph)
+			i += l - 1
+		case (c == ' ' || c == '\n') && len(nest) == 0 && len(emph) == 0 && sentenceEnd(data[beg:i]):
+			k := i
+			for k < len(data) && (data[k] == ' ' || data[k] == '\n') {
+				k++
+			}
+			if k == len(data) {
+				break
+			}
+			w := k
+			for w < len(data) && bytes.IndexByte([]byte(`("'*_`), data[w]) >= 0 {
+				w++
+			}
+			if r, _ := utf8.DecodeRune(data[w:]); !unicode.IsUpper(r) {
+				i = k - 1
+				continue
+			}
+			if n++; n < max {
+				i = k - 1
+				continue
+			}
+			part := make([]byte, i-beg+1)
+			copy(part, data[beg:i])
+			part[len(part)-1] = '\n'
+			parts = append(parts, part)
+			beg, n, i = k, 0, k-1
+		}
+	}
+	return append(parts, data[beg:])
+}
+
+// runLength returns the number of times c is repeated at the start of data.
+func runLength(data []byte, c byte) int {
+	l := 0
+	for l < len(data) && data[l] == c {
+		l++
+	}
+	return l
+}
+
+// emphasisDelimiter returns the open emphasis after the run of l delimiters at
+// data[i]. A run after text closes the open emphasis of the same character, a run
+// before text opens emphasis. An underscore within a word and a single tilde
+// don't count.
+func emphasisDelimiter(data []byte, i, l int, emph []byte) []byte {
+	c := data[i]
+	before, after := i > 0 && !isspace(data[i-1]), i+l < len(data) && !isspace(data[i+l])
+	if c == '_' && i > 0 && isalnum(data[i-1]) && i+l < len(data) && isalnum(data[i+l]) {
+		return emph
+	}
+	if c == '~' && l != 2 {
+		return emph
+	}
+	if before && len(emph) > 0 && emph[len(emph)-1] == c {
+		for ; l > 0 && len(emph) > 0 && emph[len(emph)-1] == c; l-- {
+			emph = emph[:len(emph)-1]
+		}
+		return emph
+	}
+	if after {
+		for ; l > 0; l-- {
+			emph = append(emph, c)
+		}
+	}
+	return emph
+}
+
+// sentenceEnd returns true if text ends in an unescaped '.', '!' or '?', possibly
+// followed by closing quotes, parentheses or emphasis.
+func sentenceEnd(text []byte) bool {
+	text = bytes.TrimRight(text, `)"'*_`)
+	l := len(text)
+	if l == 0 || bytes.IndexByte([]byte(".!?"), text[l-1]) < 0 {
+		return false
+	}
+	return l < 2 || text[l-2] != '\\'
+}
+
+// renderParagraphPart renders data, which must end in a newline, as a paragraph.
+func (p *parser) renderParagraphPart(out *bytes.Buffer, data []byte, dir *inlineAttr) {
 	// trim leading spaces
 	beg := 0
 	for data[beg] == ' ' {
@@ -2361,6 +2591,7 @@ func (p *parser) renderParagraph(out *bytes.Buffer, data []byte) {
 	} else {
 		flags &= ^_LIST_INSIDE_LIST // Not really, just in a list
 	}
+	p.r.SetAttr(dir)
 	p.r.Paragraph(out, work, flags)
 }
 
@@ -2417,9 +2648,12 @@ func (p *parser) paragraph(out *bytes.Buffer, data []byte) int {
 
 				id := ""
 				if p.flags&EXTENSION_AUTO_HEADER_IDS != 0 {
-					id = createSanitizedAnchorName(string(data[prev:eol]))
+					id = headerID(string(data[prev:eol]))
 				}
 
+				p.sectionFootnotes(out, level)
+				p.headerAliases(id)
+				p.elementAnchor(id)
 				p.r.SetAttr(p.ial)
 				p.ial = nil
 
@@ -3,10 +3,14 @@
 package mmark
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/miekg/mmark/mmarktest"
 )
 
 func init() {
@@ -32,65 +36,15 @@ func runMarkdownBlockXML(input string, extensions int) string {
 }
 
 func doTestsBlock(t *testing.T, tests []string, extensions int) {
-	// catch and report panics
-	var candidate string
-	defer func() {
-		if err := recover(); err != nil {
-			t.Errorf("\npanic while processing [%#v]: %s\n", candidate, err)
-		}
-	}()
-
-	for i := 0; i+1 < len(tests); i += 2 {
-		input := tests[i]
-		candidate = input
-		expected := tests[i+1]
-		actual := runMarkdownBlock(candidate, extensions)
-		if actual != expected {
-			t.Errorf("\nInput   [%#v]\nExpected[%#v]\nActual  [%#v]",
-				candidate, expected, actual)
-		}
-
-		// now test every substring to stress test bounds checking
-		if !testing.Short() {
-			for start := 0; start < len(input); start++ {
-				for end := start + 1; end <= len(input); end++ {
-					candidate = input[start:end]
-					_ = runMarkdownBlock(candidate, extensions)
-				}
-			}
-		}
-	}
+	mmarktest.Table(t, tests, func(input []byte) []byte {
+		return []byte(runMarkdownBlock(string(input), extensions))
+	})
 }
 
 func doTestsBlockXML(t *testing.T, tests []string, extensions int) {
-	// catch and report panics
-	var candidate string
-	defer func() {
-		if err := recover(); err != nil {
-			t.Errorf("\npanic while processing [%#v]: %s\n", candidate, err)
-		}
-	}()
-
-	for i := 0; i+1 < len(tests); i += 2 {
-		input := tests[i]
-		candidate = input
-		expected := tests[i+1]
-		actual := runMarkdownBlockXML(candidate, extensions)
-		if actual != expected {
-			t.Errorf("\nInput   [%#v]\nExpected[%#v]\nActual  [%#v]",
-				candidate, expected, actual)
-		}
-
-		// now test every substring to stress test bounds checking
-		if !testing.Short() {
-			for start := 0; start < len(input); start++ {
-				for end := start + 1; end <= len(input); end++ {
-					candidate = input[start:end]
-					_ = runMarkdownBlockXML(candidate, extensions)
-				}
-			}
-		}
-	}
+	mmarktest.Table(t, tests, func(input []byte) []byte {
+		return []byte(runMarkdownBlockXML(string(input), extensions))
+	})
 }
 
 func TestPrefixHeaderNoExtensions(t *testing.T) {
@@ -961,6 +915,56 @@ func TestFencedCodeBlock(t *testing.T) {
 	doTestsBlock(t, tests, EXTENSION_FENCED_CODE)
 }
 
+func TestFencedCodeInfo(t *testing.T) {
+	var tests = []string{
+		"``` go title=\"client.go\" lines=10-20 hl=3\nfunc foo()\n```\n",
+		"<div class=\"code-title\">client.go</div>\n<pre data-line=\"3\" data-start=\"10\"><code class=\"language-go\">func foo()\n</code></pre>\n",
+
+		"``` {go} title=main.go\nfunc foo()\n```\n",
+		"<div class=\"code-title\">main.go</div>\n<pre><code class=\"language-go\">func foo()\n</code></pre>\n",
+
+		"``` not `a` fence ```\n",
+		"<p><code>not `a` fence</code></p>\n",
+	}
+	doTestsBlock(t, tests, EXTENSION_FENCED_CODE)
+
+	tests = []string{
+		"``` go title=\"client.go\"\nfunc foo()\n```\n",
+		"\n<sourcecode name=\"client.go\" type=\"go\">\nfunc foo()\n</sourcecode>\n",
+	}
+	doTestsBlockXML(t, tests, EXTENSION_FENCED_CODE)
+
+	info := parseCodeInfo(`go title="a b.go" hl=3,5-7 flag`)
+	if info.Lang != "go" || info.Title != "a b.go" || info.Highlight != "3,5-7" || len(info.Params) != 2 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
+
+func TestNestedBlockquotes(t *testing.T) {
+	input := "> One\n>\n> > Two\n> >\n> > > Three\n> >\n> > * item\n"
+	var tests = []string{
+		input,
+		"<blockquote>\n<p>One</p>\n\n<blockquote>\n<p>Two</p>\n\n<blockquote>\n<p>Three</p>\n</blockquote>\n\n" +
+			"<ul>\n<li>item</li>\n</ul>\n</blockquote>\n</blockquote>\n",
+	}
+	doTestsBlock(t, tests, 0)
+
+	tests = []string{
+		input,
+		"<blockquote>\n<t>\nOne\n</t>\n<blockquote>\n<t>\nTwo\n</t>\n<blockquote>\n<t>\nThree\n</t>\n</blockquote>\n" +
+			"<ul>\n<li>item</li>\n</ul>\n</blockquote>\n</blockquote>\n",
+	}
+	doTestsBlockXML(t, tests, 0)
+
+	actual := Parse([]byte(input), Xml2Renderer(0), 0).String()
+	expected := "<t><list style=\"empty\">\n<t>One\n</t>\n<t><list style=\"empty\">\n<t>Two\n</t>\n" +
+		"<t><list style=\"empty\">\n<t>Three\n</t>\n</list></t>\n" +
+		"<t>\n<list style=\"symbols\">\n<t>item</t>\n</list>\n</t>\n</list></t>\n</list></t>\n"
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
 func TestFencedCodeInsideBlockquotes(t *testing.T) {
 	cat := func(s ...string) string { return strings.Join(s, "\n") }
 	var tests = []string{
@@ -1655,6 +1659,351 @@ func testTitleBlockTOML(t *testing.T) {
 	doTestsBlockXML(t, tests, EXTENSION_TITLEBLOCK_TOML)
 }
 
+func TestTitleBlockDefaults(t *testing.T) {
+	TitleBlockDefaults = `ipr = "pre5378Trust200902"
+[pi]
+private = "yes"
+[[author]]
+fullname = "Miek Gieben"
+organization = "Google"
+[author.address]
+email = "miek@google.com"
+`
+	defer func() { TitleBlockDefaults = "" }()
+
+	p := new(parser)
+	block := p.titleBlockTOML(nil, []byte(`title = "Test"
+[pi]
+toc = "yes"
+[[author]]
+fullname = "Miek Gieben"
+role = "editor"
+`))
+	if block.Ipr != "pre5378Trust200902" || block.PI.Private != "yes" || block.PI.Toc != "yes" {
+		t.Errorf("defaults not merged: %q %q %q", block.Ipr, block.PI.Private, block.PI.Toc)
+	}
+	if len(block.Author) != 1 {
+		t.Fatalf("expected 1 author, got %d", len(block.Author))
+	}
+	a := block.Author[0]
+	if a.Organization != "Google" || a.Address.Email != "miek@google.com" || a.Role != "editor" {
+		t.Errorf("author not merged: %+v", a)
+	}
+
+	block = p.titleBlockTOML(nil, []byte(`title = "Test"`))
+	if len(block.Author) != 1 || block.Author[0].Fullname != "Miek Gieben" {
+		t.Errorf("default authors not used: %+v", block.Author)
+	}
+
+	// List values of the document replace the defaults.
+	TitleBlockDefaults = "obsoletes = [1, 3]\nkeyword = [\"a\", \"b\"]\ninternal = [\"x\"]\n"
+	block = p.titleBlockTOML(nil, []byte("title = \"Test\"\nobsoletes = [2]\nkeyword = [\"c\"]\ninternal = [\"y\"]\n"))
+	if !reflect.DeepEqual(block.Obsoletes, []int{2}) || !reflect.DeepEqual(block.Keyword, keywords{"c"}) || !reflect.DeepEqual(block.Internal, []string{"y"}) {
+		t.Errorf("expected the lists to replace the defaults, got %v %v %v", block.Obsoletes, block.Keyword, block.Internal)
+	}
+}
+
+func TestRunningText(t *testing.T) {
+	p := new(parser)
+	block := p.titleBlockTOML(nil, []byte(`title = "A Test"
+date = 2017-01-02T00:00:00Z
+[[author]]
+fullname = "Miek Gieben"
+[[author]]
+surname = "O'Brien"
+`))
+	actual := runningText(p, "{{.Authors}} - {{.Abbrev}} - Expires {{.Expires}}", block)
+	if expected := "Gieben & O'Brien - A Test - Expires July 6, 2017"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	if actual := runningText(p, "Internet-Draft", block); actual != "Internet-Draft" {
+		t.Errorf("expected the header as is, got %q", actual)
+	}
+
+	input := "% title = \"A <Test>\"\n% [[author]]\n% surname = \"Smith & Sons\"\n% [pi]\n% header = \"{{.Authors}}: {{.Title}}\"\n% footer = \"A & B\"\n\nText\n"
+	output := Parse([]byte(input), Xml2Renderer(XML2_STANDALONE), EXTENSION_TITLEBLOCK_TOML).String()
+	for _, expected := range []string{
+		"<?rfc header=\"Smith &amp; Sons: A &lt;Test&gt;\"?>\n",
+		"<?rfc footer=\"A &amp; B\"?>\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+}
+
+func TestTitleBlockPI(t *testing.T) {
+	input := "% title = \"x\"\n% [pi]\n% toc = \"no\"\n% compact = \"yes\"\n% tocdepth = 2\n% rfcedstyle = true\n\nText\n"
+	output, _ := ParseDiagnostics([]byte(input), Xml2Renderer(XML2_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+	for _, expected := range []string{
+		"<?rfc toc=\"no\"?>\n",
+		"<?rfc compact=\"yes\"?>\n",
+		"<?rfc rfcedstyle=\"yes\"?>\n<?rfc tocdepth=\"2\"?>\n",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+
+	output, diags := ParseDiagnostics([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+	if expected := "docName=\"\" tocInclude=\"false\" tocDepth=\"2\">\n"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+	if len(diags) != 2 || diags[0].Message != "PI compact has no xml2rfc v3 equivalent, ignoring it" {
+		t.Errorf("expected warnings for compact and rfcedstyle, got %v", diags)
+	}
+
+	input = "% title = \"x\"\n% [pi]\n% strict = \"a \\\"b\\\" & c\"\n% \"x\\\"?><y\" = \"yes\"\n\nText\n"
+	output, diags = ParseDiagnostics([]byte(input), Xml2Renderer(XML2_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+	if expected := "<?rfc strict=\"a &quot;b&quot; &amp; c\"?>\n"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+	if strings.Contains(output.String(), "<y") {
+		t.Errorf("expected the invalid PI name to be dropped in %q", output)
+	}
+	if len(diags) != 1 {
+		t.Errorf("expected a warning for the invalid PI name, got %v", diags)
+	}
+}
+
+func TestTitleBlockCodingTocDepth(t *testing.T) {
+	input := "% title = \"x\"\n% coding = \"us-ascii\"\n% tocdepth = 2\n\nText\n"
+	output := Parse([]byte(input), Xml2Renderer(XML2_STANDALONE|XML2_TRANSLITERATE), EXTENSION_TITLEBLOCK_TOML).String()
+	for _, expected := range []string{
+		"<?xml version=\"1.0\" encoding=\"US-ASCII\"?>\n<!DOCTYPE",
+		"<?rfc tocdepth=\"2\"?>\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+	out, diags := ParseDiagnostics([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+	if output = out.String(); !strings.HasPrefix(output, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<rfc ") || !strings.Contains(output, " tocDepth=\"2\">\n") {
+		t.Errorf("expected UTF-8 and the tocDepth in %q", output)
+	}
+	if len(diags) != 1 || diags[0].Message != "coding US-ASCII in TOML titleblock needs transliterated xml2rfc v2 output, using UTF-8" {
+		t.Errorf("expected a diagnostic for the coding, got %v", diags)
+	}
+	out, diags = ParseDiagnostics([]byte(input), HtmlRenderer(HTML_COMPLETE_PAGE, "", ""), EXTENSION_TITLEBLOCK_TOML)
+	if expected := "<meta charset=\"utf-8\">\n"; !strings.Contains(out.String(), expected) || len(diags) != 1 {
+		t.Errorf("expected %q and one diagnostic in %q, got %v", expected, out, diags)
+	}
+
+	input = "% title = \"x\"\n% coding = \"latin1\"\n% tocdepth = 2\n% [pi]\n% tocdepth = 3\n\nText\n"
+	out, diags = ParseDiagnostics([]byte(input), Xml2Renderer(XML2_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+	if !strings.Contains(out.String(), "encoding=\"UTF-8\"") || !strings.Contains(out.String(), "<?rfc tocdepth=\"2\"?>\n") {
+		t.Errorf("expected UTF-8 and a tocdepth of 2 in %q", out)
+	}
+	if len(diags) != 2 || diags[0].Message != "unknown coding in TOML titleblock: latin1, using UTF-8" ||
+		diags[1].Message != "tocdepth is set in the TOML titleblock and in [pi], using 2" {
+		t.Errorf("expected diagnostics for the coding and tocdepth, got %v", diags)
+	}
+}
+
+func TestTitleBlockKeywords(t *testing.T) {
+	for _, input := range []string{
+		"% title = \"x\"\n% keyword = [\" DNS \", \"DNSSEC\", \"\", \"dns\"]\n\nText\n",
+		"% title = \"x\"\n% keyword = \"DNS, DNSSEC,, dns\"\n\nText\n",
+	} {
+		output, diags := ParseDiagnostics([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+		if expected := "<workgroup></workgroup>\n<keyword>DNS</keyword>\n<keyword>DNSSEC</keyword>\n\n"; !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+		if len(diags) != 2 || diags[0].Message != "empty keyword in TOML titleblock" || diags[1].Message != "duplicate keyword in TOML titleblock: dns" {
+			t.Errorf("expected warnings for the empty and duplicate keyword, got %v", diags)
+		}
+	}
+
+	defer func() { LowercaseKeywords = false }()
+	LowercaseKeywords = true
+	output, _ := ParseDiagnostics([]byte("% title = \"x\"\n% keyword = \"DNS\"\n\nText\n"), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+	if expected := "<keyword>dns</keyword>\n"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+	LowercaseKeywords = false
+
+	defer func() { TitleBlockDefaults = "" }()
+	TitleBlockDefaults = "keyword = [\"IETF\"]\n"
+	for _, input := range []string{
+		"% title = \"x\"\n% keyword = [\"DNS\"]\n\nText\n",
+		"% title = \"x\"\n% keyword = \"DNS\"\n\nText\n",
+	} {
+		output := Parse([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+		if expected := "<workgroup></workgroup>\n<keyword>DNS</keyword>\n\n"; !strings.Contains(output.String(), expected) {
+			t.Errorf("expected the keywords to replace the defaults, %q in %q", expected, output)
+		}
+	}
+}
+
+func TestTitleBlockAffiliation(t *testing.T) {
+	input := `% title = "x"
+% [[author]]
+% fullname = "R. Gieben"
+% organization = "Google"
+% abbrev = "G"
+% [[author.affiliation]]
+% organization = "Example University"
+% abbrev = "EU"
+% [[author.affiliation]]
+% organization = "IETF"
+
+Text
+`
+	output := Parse([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+	if expected := "<organization abbrev=\"G, EU\">Google, Example University, IETF</organization>\n"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+	output = Parse([]byte(input), HtmlRenderer(HTML_COMPLETE_PAGE, "", ""), EXTENSION_TITLEBLOCK_TOML)
+	if expected := "<p class=\"author\">R. Gieben, Google (G), Example University (EU), IETF</p>\n"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+}
+
+func TestTitleBlockEscape(t *testing.T) {
+	input := `% title = "Foo & Bar <draft>"
+% abbrev = "F&B"
+% docName = "draft-\"foo\""
+% workgroup = "<wg>"
+% keyword = ["a&b"]
+% [[author]]
+% fullname = "R. \"Miek\" Gieben"
+% organization = "A&B"
+% abbrev = "\"AB\""
+% [author.address]
+% email = "<miek@example.org>"
+
+Text
+`
+	for _, r := range []Renderer{XmlRenderer(XML_STANDALONE), Xml2Renderer(XML2_STANDALONE)} {
+		output := Parse([]byte(input), r, EXTENSION_TITLEBLOCK_TOML).String()
+		for _, expected := range []string{
+			"docName=\"draft-&quot;foo&quot;\"",
+			"<title abbrev=\"F&amp;B\">Foo &amp; Bar &lt;draft&gt;</title>\n",
+			"fullname=\"R. &quot;Miek&quot; Gieben\">\n",
+			"<organization abbrev=\"&quot;AB&quot;\">A&amp;B</organization>\n",
+			"<email>&lt;miek@example.org&gt;</email>\n",
+			"<workgroup>&lt;wg&gt;</workgroup>\n<keyword>a&amp;b</keyword>\n",
+		} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("expected %q in %q", expected, output)
+			}
+		}
+	}
+}
+
+func TestTitleBlockContributors(t *testing.T) {
+	input := `% title = "x"
+% acknowledgements = "Thanks to *everyone*."
+% [[contributor]]
+% fullname = "Jane Doe"
+% organization = "Example"
+% [contributor.address]
+% email = "jane@example.org"
+
+Text
+`
+	output := Parse([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+	for _, expected := range []string{
+		"<section anchor=\"acknowledgements\" numbered=\"false\">\n<name>Acknowledgements</name>\n<t>\nThanks to <em>everyone</em>.\n</t>\n",
+		"<section anchor=\"contributors\" numbered=\"false\">\n<name>Contributors</name>\n<t>\nJane Doe\n<br/>\nExample\n<br/>\nEmail: jane@example.org\n</t>\n",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+}
+
+func TestTitleBlockPrivateAddresses(t *testing.T) {
+	input := `% title = "x"
+% [[author]]
+% fullname = "R. Gieben"
+% [author.address]
+% phone = "+31 555"
+% email = "miek@example.org"
+% [author.address.postal]
+% street = "Main Street 1"
+% code = "1234 AB"
+% city = "Amsterdam"
+
+Text
+`
+	defer func() { PrivateAddresses = false }()
+	PrivateAddresses = true
+	output := Parse([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+	if expected := "<street></street>\n<city>Amsterdam</city>\n<code></code>\n"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+	if expected := "<phone></phone>\n<email>miek@example.org</email>\n"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+}
+
+func TestParseVCard(t *testing.T) {
+	vcard := "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Alice Example\r\nN:Example;Alice;;;\r\nORG:Example\\, Inc.;Research\r\n" +
+		"EMAIL;TYPE=work:alice@example.org\r\nTEL;VALUE=uri:tel:+1-555-0100\r\n" +
+		"ADR;TYPE=work:;;1 Main Street;Springfield;;12345;USA\r\nNOTE:a long note\r\n  folded\r\nEND:VCARD\r\n"
+	a, err := parseVCard([]byte(vcard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := author{Initials: "A.", Surname: "Example", Fullname: "Alice Example", Organization: "Example, Inc.",
+		Address: address{Phone: "+1-555-0100", Email: "alice@example.org",
+			Postal: addressPostal{Street: "1 Main Street", City: "Springfield", Code: "12345", Country: "USA"}}}
+	if !reflect.DeepEqual(a, expected) {
+		t.Errorf("expected %+v, got %+v", expected, a)
+	}
+	if _, err := parseVCard([]byte("FN:Alice\n")); err == nil {
+		t.Errorf("expected an error for a vCard without BEGIN:VCARD")
+	}
+}
+
+func TestTitleBlockAuthorFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "mmark_test.*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"fullname": "Alice Example", "organization": "Example", "abbrev": "EX", "address": {"email": "alice@example.org"}}`)
+	f.Close()
+
+	input := "% title = \"x\"\n% [[author]]\n% file = \"" + f.Name() + "\"\n% organization = \"Other\"\n\nText\n"
+	output := Parse([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML|EXTENSION_INCLUDE)
+	for _, expected := range []string{
+		"fullname=\"Alice Example\"",
+		"<organization abbrev=\"EX\">Other</organization>",
+		"<email>alice@example.org</email>",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+
+	output, diags := ParseDiagnostics([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML)
+	if strings.Contains(output.String(), "Alice") || len(diags) != 1 || !strings.Contains(diags[0].Message, "includes are not enabled") {
+		t.Errorf("expected the author file not to be read without includes, got %v", diags)
+	}
+
+	defer func() { IncludeRoot = "" }()
+	IncludeRoot = os.TempDir() + "/mmark-sandbox"
+	_, diags = ParseDiagnostics([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML|EXTENSION_INCLUDE)
+	if len(diags) != 1 || !strings.Contains(diags[0].Message, "absolute include paths are not allowed") {
+		t.Errorf("expected the absolute author file to be rejected, got %v", diags)
+	}
+}
+
+func TestDocNameRevision(t *testing.T) {
+	for docName, expected := range map[string]int{
+		"draft-gieben-mmark-03": 3,
+		"draft-gieben-mmark-1":  -1,
+		"draft-gieben-mmark":    -1,
+		"draft-gieben-mmark-xx": -1,
+	} {
+		if _, rev := DocNameRevision(docName); rev != expected {
+			t.Errorf("%s: expected revision %d, got %d", docName, expected, rev)
+		}
+	}
+}
+
 func TestSubFiguresXML(t *testing.T) {
 	var tests = []string{`
 *   Item1
@@ -1740,7 +2089,457 @@ As you can see in <1> we do some funky stuff above here.
 	doTestsBlockXML(t, tests, 0)
 }
 
+func TestCaptionNumbers(t *testing.T) {
+	input := "| a |\n|---|\n| 1 |\nTable: Numbers\n\n{#code}\n```\nx\n```\nFigure: Some *code*\n"
+	actual := Parse([]byte(input), HtmlRenderer(HTML_CAPTION_NUMBERS|HTML_LIST_OF_FIGURES, "", ""), EXTENSION_TABLES|EXTENSION_FENCED_CODE|EXTENSION_INLINE_ATTR).String()
+	for _, expected := range []string{
+		"<table id=\"table-1\">\n<caption>\nTable 1: Numbers\n",
+		"<figure id=\"code\">",
+		"<figcaption>\nFigure 1: Some <em>code</em></figcaption>",
+		"<ul class=\"list-of-figures\">\n<li><a href=\"#code\">Figure 1: Some code</a></li>\n</ul>\n",
+		"<h1 id=\"list-of-tables\" class=\"list-of-tables\">List of Tables</h1>\n" +
+			"<ul class=\"list-of-tables\">\n<li><a href=\"#table-1\">Table 1: Numbers</a></li>\n</ul>\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected %q in %q", expected, actual)
+		}
+	}
+
+	actual = Parse([]byte(input), HtmlRenderer(0, "", ""), EXTENSION_TABLES|EXTENSION_FENCED_CODE|EXTENSION_INLINE_ATTR).String()
+	if strings.Contains(actual, "table-1") || strings.Contains(actual, "Figure 1") {
+		t.Errorf("expected no numbers without the flags, got %q", actual)
+	}
+
+	input = "# Table 1\n\n| a |\n|---|\n| 1 |\nTable: Numbers\n"
+	extensions := EXTENSION_TABLES | EXTENSION_AUTO_HEADER_IDS
+	_, diags := ParseDiagnostics([]byte(input), HtmlRenderer(HTML_CAPTION_NUMBERS, "", ""), extensions)
+	expected := "generated anchor `table-1' is also the anchor of the section or figure on line 1, give it an id"
+	if len(diags) != 1 || diags[0].Message != expected || diags[0].Severity != SeverityError || diags[0].Line == 1 {
+		t.Errorf("expected error %q, got %v", expected, diags)
+	}
+	input = "# Table 1\n\n{#numbers}\n| a |\n|---|\n| 1 |\nTable: Numbers\n"
+	if _, diags := ParseDiagnostics([]byte(input), HtmlRenderer(HTML_CAPTION_NUMBERS, "", ""), extensions|EXTENSION_INLINE_ATTR); len(diags) != 0 {
+		t.Errorf("expected no diagnostics with an id, got %v", diags)
+	}
+}
+
+func TestCodeComponents(t *testing.T) {
+	input := "# Intro\n\n{component=\"true\"}\n``` go title=\"main.go\"\npackage main\n```\n\nText\n"
+	extensions := EXTENSION_FENCED_CODE | EXTENSION_INLINE_ATTR | EXTENSION_CODE_COMPONENTS
+	actual := Parse([]byte(input), XmlRenderer(0), extensions).String()
+	expected := "<section anchor=\"code-component-1\">\n<name>main.go</name>\n\n" +
+		"<sourcecode name=\"main.go\" type=\"go\">\n&lt;CODE BEGINS&gt; file \"main.go\"\npackage main\n&lt;CODE ENDS&gt;\n</sourcecode>\n"
+	if !strings.Contains(actual, expected) || strings.Index(actual, "Text") > strings.Index(actual, "Code Components") {
+		t.Errorf("expected the code at the end in %q", actual)
+	}
+
+	actual = Parse([]byte(input), XmlRenderer(0), extensions&^EXTENSION_CODE_COMPONENTS).String()
+	if strings.Contains(actual, "Code Components") || strings.Contains(actual, "CODE BEGINS") {
+		t.Errorf("expected no Code Components appendix, got %q", actual)
+	}
+}
+
+func TestIANA(t *testing.T) {
+	input := "``` iana\n[[registry]]\nname = \"Types\"\n[[registry.entry]]\nvalue = \"65\"\ndescription = \"HTTPS\"\nreference = \"[@RFC9460]\"\n" +
+		"[[registry.entry]]\ndescription = \"SVCB\"\n```\n"
+	output, diags := ParseDiagnostics([]byte(input), XmlRenderer(0), EXTENSION_FENCED_CODE|EXTENSION_CITATION|EXTENSION_IANA)
+	for _, expected := range []string{
+		"<t>\nIANA is requested to register the following entries in the &quot;Types&quot; registry:\n</t>\n",
+		"<tr><td>65</td><td>HTTPS</td><td><xref target=\"RFC9460\"/></td></tr>\n<tr><td></td><td>SVCB</td><td></td></tr>\n",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+	if len(diags) != 1 || diags[0].Message != "IANA registry \"Types\": entry 2 needs a value and a reference" {
+		t.Errorf("expected a warning for entry 2, got %v", diags)
+	}
+}
+
+func TestHRuleXML(t *testing.T) {
+	var tests = []string{
+		"One\n\n***\n\nTwo\n",
+		"<t>\nOne\n</t>\n<t>* * *</t>\n<t>\nTwo\n</t>\n",
+	}
+	doTestsBlockXML(t, tests, 0)
+
+	defer func(t string) { Transition = t }(Transition)
+	Transition = ""
+	tests = []string{
+		"One\n\n---\n\nTwo\n",
+		"<t>\nOne\n</t>\n<t />\n<t>\nTwo\n</t>\n",
+	}
+	doTestsBlockXML(t, tests, 0)
+}
+
+func TestParagraphSentencesXML(t *testing.T) {
+	defer func(n int) { ParagraphSentences = n }(ParagraphSentences)
+	ParagraphSentences = 2
+	var tests = []string{
+		"One. Two! Three? Four.\n",
+		"<t>\nOne. Two!\n</t>\n<t>\nThree? Four.\n</t>\n",
+
+		"One e.g. two. Three\nfour. Five.\n",
+		"<t>\nOne e.g. two. Three\nfour.\n</t>\n<t>\nFive.\n</t>\n",
+
+		"One `a. B. C.` two. [Three. Four.](#x) Five. Six. Seven.\n",
+		"<t>\nOne <tt>a. B. C.</tt> two. <xref target=\"x\"/> Five. Six.\n</t>\n<t>\nSeven.\n</t>\n",
+
+		"* One. Two. Three.\n",
+		"<ul>\n<li>One. Two. Three.</li>\n</ul>\n",
+
+		"*One. Two. Three.* Four. **Five. Six.** Seven.\n",
+		"<t>\n<em>One. Two. Three.</em> Four.\n</t>\n<t>\n<strong>Five. Six.</strong> Seven.\n</t>\n",
+
+		"One `` a`. B. `` two. [Three](http://example.com/a._B) Four. Five. Six.\n",
+		"<t>\nOne <tt>a`. B.</tt> two. <eref target=\"http://example.com/a._B\">Three</eref> Four. Five.\n</t>\n<t>\nSix.\n</t>\n",
+	}
+	doTestsBlockXML(t, tests, 0)
+
+	ParagraphSentences = 1
+	tests = []string{
+		"*A. B.* C_d. E_f. G.\n",
+		"<t>\n<em>A. B.</em>\n</t>\n<t>\nC_d.\n</t>\n<t>\nE_f.\n</t>\n<t>\nG.\n</t>\n",
+	}
+	doTestsBlockXML(t, tests, 0)
+}
+
+func TestParagraphWrap(t *testing.T) {
+	var tests = []string{
+		"Roses are red,\nviolets are blue.\n",
+		"<p>Roses are red,\nviolets are blue.</p>\n",
+
+		"{wrap=\"hard\"}\nRoses are red,\nviolets are blue.\n\nSugar is\nsweet.\n",
+		"<p>Roses are red,<br>\nviolets are blue.</p>\n\n<p>Sugar is\nsweet.</p>\n",
+	}
+	doTestsBlock(t, tests, 0)
+
+	tests = []string{
+		"Roses are red,\nviolets are blue.\n",
+		"<p>Roses are red,<br>\nviolets are blue.</p>\n",
+
+		"{wrap=\"soft\"}\nRoses are red,\nviolets are blue.\n",
+		"<p>Roses are red,\nviolets are blue.</p>\n",
+	}
+	doTestsBlock(t, tests, EXTENSION_HARD_LINE_BREAK)
+}
+
+func TestParagraphDirection(t *testing.T) {
+	var tests = []string{
+		"{dir=\"rtl\" lang=\"he\"}\nשלום עולם\n\nHello.\n",
+		"<p dir=\"rtl\" lang=\"he\">שלום עולם</p>\n\n<p>Hello.</p>\n",
+
+		"{lang=\"ar\" .x}\nمرحبا\n",
+		"<p lang=\"ar\">مرحبا</p>\n",
+	}
+	doTestsBlock(t, tests, 0)
+
+	input := "% title = \"Test\"\n% language = \"he-IL\"\n\nשלום\n"
+	actual := Parse([]byte(input), HtmlRenderer(HTML_COMPLETE_PAGE, "", ""), EXTENSION_TITLEBLOCK_TOML).String()
+	if expected := "<body lang=\"he-IL\" dir=\"rtl\">\n"; !strings.Contains(actual, expected) {
+		t.Errorf("expected %q in %q", expected, actual)
+	}
+}
+
+func TestLanguageXML(t *testing.T) {
+	var tests = []string{
+		"{lang=\"de\"}\nGuten Tag.\n",
+		"<t xml:lang=\"de\">\nGuten Tag.\n</t>\n",
+
+		"{lang=\"de\"}\n> Guten Tag.\n",
+		"<blockquote xml:lang=\"de\">\n<t>\nGuten Tag.\n</t>\n</blockquote>\n",
+
+		"{lang=\"a<b&c\"}\nOdd.\n",
+		"<t xml:lang=\"a&lt;b&amp;c\">\nOdd.\n</t>\n",
+	}
+	doTestsBlockXML(t, tests, 0)
+
+	input := "% title = \"Test\"\n% language = \"de\"\n\nText.\n"
+	actual := Parse([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_TITLEBLOCK_TOML).String()
+	if expected := " xml:lang=\"de\""; !strings.Contains(actual, expected) {
+		t.Errorf("expected %q in %q", expected, actual)
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+	input := "Café “Zürich” — 東.\n"
+	output, diags := ParseDiagnostics([]byte(input), Xml2Renderer(XML2_TRANSLITERATE), 0)
+	if expected := "<t>Cafe &quot;Zuerich&quot; -- ?.\n</t>\n"; output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+	if len(diags) != 6 {
+		t.Fatalf("expected 6 diagnostics, got %v", diags)
+	}
+	if expected := "no transliteration for '東' (U+6771) in '東.', using '?'"; diags[5].Message != expected {
+		t.Errorf("expected %q, got %q", expected, diags[5].Message)
+	}
+
+	arrows := "Text.\n\na ← b ≤ c\n"
+	output, diags = ParseDiagnostics([]byte(arrows), Xml2Renderer(XML2_TRANSLITERATE), 0)
+	if expected := "<t>a &lt;- b &lt;= c\n</t>\n"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+	if len(diags) != 2 || diags[0].Line != 3 || diags[1].Line != 3 {
+		t.Errorf("expected 2 diagnostics on line 3, got %v", diags)
+	}
+
+	defer func() { TransliterateFunc = nil }()
+	TransliterateFunc = func(r rune) (string, bool) { return "dong", r == '東' }
+	if output, _ = ParseDiagnostics([]byte(input), Xml2Renderer(XML2_TRANSLITERATE), 0); !strings.Contains(output.String(), "dong.") {
+		t.Errorf("expected dong in %q", output)
+	}
+}
+
+func TestPlainXML2(t *testing.T) {
+	input := "Term [@RFC2119]\n:   Definition\n\n| `a` | b |\n|-----|---|\n| [@RFC2119] | [](#x) |\nTable: See [@RFC2119].\n"
+	output, diags := ParseDiagnostics([]byte(input), Xml2Renderer(0), EXTENSION_TABLES|EXTENSION_CITATION|EXTENSION_DEFINITION_LISTS)
+	for _, expected := range []string{
+		"<t hangText=\"Term [RFC2119]\">",
+		"<texttable title=\"See [RFC2119].\">",
+		"<ttcol align=\"center\">a</ttcol>",
+		"<c><xref target=\"RFC2119\"/></c><c><xref target=\"x\"/></c>",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+	if len(diags) != 3 || diags[0].Line != 1 {
+		t.Errorf("expected 3 diagnostics, the first on line 1, got %v", diags)
+	}
+
+	output, diags = ParseDiagnostics([]byte("# The *\"must\"* of [@RFC2119]\n"), Xml2Renderer(0), EXTENSION_CITATION)
+	if expected := "<section title=\"The &quot;must&quot; of [RFC2119]\">"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+	if len(diags) != 1 || diags[0].Message != "elements are not allowed in a section title, using its text: 'The &quot;must&quot; of [RFC2119]'" {
+		t.Errorf("expected 1 diagnostic, got %v", diags)
+	}
+}
+
+func TestAsideNoteXML2(t *testing.T) {
+	actual := Parse([]byte("A> An aside.\n"), Xml2Renderer(0), 0).String()
+	if expected := "<t><list style=\"empty\">\n<t>Aside:</t>\n<t>An aside.\n</t>\n</list></t>\n"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	input := "% title = \"x\"\n\n{mainmatter}\n\n# Introduction\n\n.# A note\n\nText\n"
+	extensions := EXTENSION_TITLEBLOCK_TOML | EXTENSION_MATTER | EXTENSION_STRICT
+	_, diags := ParseDiagnostics([]byte(input), Xml2Renderer(XML2_STANDALONE), extensions)
+	if len(diags) != 1 || diags[0].Construct != "Note" || diags[0].Line != 7 {
+		t.Errorf("expected a note error on line 7, got %v", diags)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	input := "Para\n\n[1]: http://example.org\n\n~~gone~~\n\n% title = \"x\n"
+	_, diags := ParseDiagnostics([]byte(input), Xml2Renderer(0), EXTENSION_TITLEBLOCK_TOML)
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %v", diags)
+	}
+	if d := diags[0]; d.Severity != SeverityWarning || d.Line != 5 || d.Message != "syntax not supported: StrikeThrough" {
+		t.Errorf("unexpected diagnostic: %s", d)
+	}
+
+	_, diags = ParseDiagnostics([]byte(input), Xml2Renderer(0), EXTENSION_TITLEBLOCK_TOML|EXTENSION_STRICT)
+	if len(diags) != 1 || diags[0].Severity != SeverityError || diags[0].Construct != "StrikeThrough" {
+		t.Errorf("expected a StrikeThrough error in strict mode, got %v", diags)
+	}
+
+	_, diags = ParseDiagnostics([]byte("% title = \"x\"\n% ipr = \"trust2009\"\n\nPara\n"), Xml2Renderer(0), EXTENSION_TITLEBLOCK_TOML)
+	if len(diags) != 1 || diags[0].Message != "unknown ipr in TOML titleblock: trust2009, using trust200902" {
+		t.Errorf("expected an unknown ipr error, got %v", diags)
+	}
+
+	_, diags = ParseDiagnostics([]byte("% title = \"x\n\nPara\n"), Xml2Renderer(0), EXTENSION_TITLEBLOCK_TOML)
+	if len(diags) != 1 || diags[0].Severity != SeverityError || diags[0].Line != 1 {
+		t.Errorf("expected a titleblock error on line 1, got %v", diags)
+	}
+}
+
+// failParagraph makes the text function of every paragraph fail.
+type failParagraph struct{ Renderer }
+
+func (f *failParagraph) setParser(p *parser) { f.Renderer.(parserSetter).setParser(p) }
+
+func (f *failParagraph) Paragraph(out *bytes.Buffer, text func() bool, flags int) {
+	f.Renderer.Paragraph(out, func() bool { text(); return false }, flags)
+}
+
+func TestTruncated(t *testing.T) {
+	for _, r := range []Renderer{HtmlRenderer(0, "", ""), XmlRenderer(0), Xml2Renderer(0)} {
+		output, diags := ParseDiagnostics([]byte("# Header\n\nOne\n\nTwo\n"), &failParagraph{r}, 0)
+		if strings.Contains(output.String(), "One") || strings.Contains(output.String(), "Two") {
+			t.Errorf("%s: expected paragraphs to be dropped, got %q", backendName(r), output)
+		}
+		if len(diags) != 2 {
+			t.Fatalf("%s: expected 2 diagnostics, got %v", backendName(r), diags)
+		}
+		if d := diags[1]; d.Severity != SeverityWarning || d.Line != 5 || d.Construct != "Paragraph" ||
+			d.Message != "failed to render Paragraph, its content is dropped" {
+			t.Errorf("%s: unexpected diagnostic: %s", backendName(r), d)
+		}
+	}
+
+	_, diags := ParseDiagnostics([]byte("One\n"), &failParagraph{HtmlRenderer(0, "", "")}, EXTENSION_STRICT)
+	if len(diags) != 1 || diags[0].Severity != SeverityError {
+		t.Errorf("expected an error in strict mode, got %v", diags)
+	}
+}
+
+func TestParagraphNumbers(t *testing.T) {
+	input := ".# Abstract\n\nAbstract.\n\n{mainmatter}\n\n# One\n\nFirst.\n\n> Quoted.\n\nSecond.\n\n## Two\n\nFirst.\n\n{backmatter}\n\n# Appendix\n\nFirst.\n"
+	extensions := commonXmlExtensions | EXTENSION_UNIQUE_HEADER_IDS
+	expected := []string{"section-abstract-1", "section-1-1", "section-1-2", "section-1.1-1", "section-appendix.a-1"}
+
+	xml := Parse([]byte(input), XmlRenderer(XML_PARAGRAPH_NUMBERS), extensions).String()
+	html := Parse([]byte(input), HtmlRenderer(HTML_PARAGRAPH_NUMBERS, "", ""), extensions).String()
+	if n := strings.Count(xml, " pn="); n != len(expected) {
+		t.Errorf("expected %d pn attributes, got %d: %s", len(expected), n, xml)
+	}
+	for _, pn := range expected {
+		if !strings.Contains(xml, "<t pn=\""+pn+"\">") {
+			t.Errorf("expected pn %s in %s", pn, xml)
+		}
+		if !strings.Contains(html, "<p id=\""+pn+"\">") {
+			t.Errorf("expected id %s in %s", pn, html)
+		}
+	}
+}
+
+type testLogger []string
+
+func (l *testLogger) Debug(msg string, args ...interface{}) { *l = append(*l, msg) }
+
+func TestDebugLogger(t *testing.T) {
+	l := &testLogger{}
+	DebugLogger = l
+	defer func() { DebugLogger = nil }()
+
+	Parse([]byte("> [@!RFC2119]\n"), XmlRenderer(0), EXTENSION_CITATION)
+	if strings.Join(*l, ",") != "block,block,citation" {
+		t.Errorf("unexpected traces: %v", *l)
+	}
+}
+
 // TODO:
 // figure caption
 // table caption
 // frontmatter
+
+func TestHeaderIDPrefixAndAliases(t *testing.T) {
+	defer func() { HeaderIDPrefix, HeaderIDSuffix = "", "" }()
+	HeaderIDPrefix = "sec-"
+
+	input := "See (#old-intro) and [this](#intro2).\n\n{aliases=\"old-intro intro2\"}\n# Introduction\n\n# Explicit {#expl}\n"
+	extensions := EXTENSION_AUTO_HEADER_IDS | EXTENSION_HEADER_IDS | EXTENSION_INLINE_ATTR | EXTENSION_SHORT_REF
+	output, diags := ParseDiagnostics([]byte(input), HtmlRenderer(0, "", ""), extensions)
+	for _, expected := range []string{
+		"<h1 id=\"sec-introduction\"><a id=\"intro2\"></a><a id=\"old-intro\"></a>Introduction</h1>",
+		"<h1 id=\"expl\">Explicit</h1>",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+	if len(diags) != 2 || diags[0].Message != "cross reference to `old-intro', which is now `sec-introduction'" || diags[0].Line != 1 {
+		t.Errorf("expected warnings for the references to the aliases, got %v", diags)
+	}
+
+	output = Parse([]byte(input), XmlRenderer(0), extensions)
+	if expected := "<section anchor=\"sec-introduction\">"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+
+	output = Parse([]byte("{aliases=\"a<b&c\"}\n# Odd\n"), HtmlRenderer(0, "", ""), extensions)
+	if expected := "<a id=\"a&lt;b&amp;c\"></a>"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+}
+
+func TestAnchorConflicts(t *testing.T) {
+	input := "# Haskell\n\nSee [@haskell] and [@fig-a].\n\n{#fig-a}\n![A](a.png)\n\n" +
+		"<reference anchor='other'><front><title>One</title></front></reference>\n\n" +
+		"<reference anchor='other'><front><title>Two</title></front></reference>\n\nEnd.\n"
+	extensions := commonXmlExtensions | EXTENSION_AUTO_HEADER_IDS | EXTENSION_CITATION
+	_, diags := ParseDiagnostics([]byte(input), XmlRenderer(0), extensions)
+	expected := []string{
+		"reference anchor `other' is defined twice",
+		"reference anchor `fig-a' is also the anchor of a section or figure",
+		"reference anchor `haskell' is also the anchor of a section or figure",
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags)
+	}
+	for i, d := range diags {
+		if d.Message != expected[i] || d.Severity != SeverityError {
+			t.Errorf("expected error %q, got %v", expected[i], d)
+		}
+	}
+	if diags[2].Line != 1 || diags[1].Line != 5 {
+		t.Errorf("expected the lines of the anchors, got %v", diags)
+	}
+}
+
+func TestEmptyIAL(t *testing.T) {
+	for _, input := range []string{"{}\nText\n", "{ }\nText\n"} {
+		if actual := Parse([]byte(input), HtmlRenderer(0, "", ""), 0).String(); actual != "<p>Text</p>\n" {
+			t.Errorf("%q: expected %q, got %q", input, "<p>Text</p>\n", actual)
+		}
+	}
+}
+
+func TestCodeLanguageAliases(t *testing.T) {
+	defer func() { CodeLanguageAliases = map[string]string{} }()
+	CodeLanguageAliases = map[string]string{"shell": "bash", "c++": "cc"}
+
+	input := "```Shell\nls\n```\n\n```c++ title=\"a.cc\"\nint a;\n```\n\n```python\npass\n```\n"
+	for _, r := range []struct {
+		renderer Renderer
+		expected []string
+	}{
+		{XmlRenderer(0), []string{"<sourcecode type=\"bash\">", "<sourcecode name=\"a.cc\" type=\"cc\">", "<sourcecode type=\"python\">"}},
+		{HtmlRenderer(0, "", ""), []string{"class=\"language-bash\"", "class=\"language-cc\"", "class=\"language-python\""}},
+	} {
+		output := Parse([]byte(input), r.renderer, commonXmlExtensions).String()
+		for _, expected := range r.expected {
+			if !strings.Contains(output, expected) {
+				t.Errorf("expected %q in %q", expected, output)
+			}
+		}
+	}
+}
+
+func TestFigureAttributesXML2(t *testing.T) {
+	input := "{#fig suppress-title=\"true\" align=\"left\" alt=\"A box\" width=\"40\" foo=\"bar\"}\n```\ncode\n```\nFigure: A box\n\n" +
+		"{suppress-title=\"yes\" height=\"3\"}\n![alt](img.png \"Title\")\n"
+	output, diags := ParseDiagnostics([]byte(input), Xml2Renderer(0), EXTENSION_FENCED_CODE)
+	for _, expected := range []string{
+		"<figure anchor=\"fig\" align=\"left\" alt=\"A box\" suppress-title=\"true\" title=\"A box",
+		"<figure align=\"center\" height=\"3\" title=\"Title\">\n",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+	if len(diags) != 2 || diags[0].Message != "attribute foo is not valid on a figure in xml2rfc v2, dropping it" ||
+		diags[1].Message != "attribute suppress-title of a figure must be one of true, false, not \"yes\", dropping it" {
+		t.Errorf("expected warnings for foo and suppress-title, got %v", diags)
+	}
+}
+
+func TestImageXML2(t *testing.T) {
+	input := "{align=\"left\"}\n![A \"box\"](box.png \"The box\")\n\n![remote](https://example.org/a.png)\n\n![remote](https://example.org/a.png \"Remote\")\n"
+	actual := Parse([]byte(input), Xml2Renderer(0), 0).String()
+	for _, expected := range []string{
+		"<figure align=\"left\" title=\"The box\">\n<artwork align=\"left\" alt=\"A &quot;box&quot;\" src=\"box.png\"/>\n</figure>\n<t><eref target=\"https://example.org/a.png\">remote</eref>\n</t>\n",
+		"<figure align=\"center\" title=\"Remote\">\n<artwork align=\"center\"/>\n<postamble><eref target=\"https://example.org/a.png\">remote</eref></postamble>\n</figure>\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected %q in %q", expected, actual)
+		}
+	}
+	actual = Parse([]byte("Text ![A box](box.png) more.\n"), Xml2Renderer(0), 0).String()
+	if expected := "<t>Text \n</t>\n<figure align=\"center\">\n<artwork align=\"center\" alt=\"A box\" src=\"box.png\"/>\n</figure>\n<t> more.\n</t>\n"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,84 @@
+// Boilerplate of Internet-Drafts.
+
+package mmark
+
+import (
+	"fmt"
+	"strings"
+)
+
+// iprs are the ipr values xml2rfc knows.
+var iprs = map[string]bool{
+	"trust200902":               true,
+	"noModificationTrust200902": true,
+	"noDerivativesTrust200902":  true,
+	"pre5378Trust200902":        true,
+	"trust200811":               true,
+	"noModificationTrust200811": true,
+	"noDerivativesTrust200811":  true,
+	"full3978":                  true,
+	"noModification3978":        true,
+	"noDerivatives3978":         true,
+	"full3667":                  true,
+	"noModification3667":        true,
+	"noDerivatives3667":         true,
+	"full2026":                  true,
+	"noDerivativeWorks2026":     true,
+	"none":                      true,
+}
+
+// boilerplate returns the paragraphs of the Status of This Memo and the Copyright
+// Notice sections of an Internet-Draft with the title block block, per the Trust
+// Legal Provisions the ipr selects. For older or no provisions both are nil.
+func boilerplate(block *TitleBlock) (status, copyright []string) {
+	modify := ""
+	switch block.Ipr {
+	case "trust200902", "pre5378Trust200902":
+	case "noModificationTrust200902":
+		modify = "This document may not be modified, and derivative works of it may not be created, " +
+			"except to format it for publication as an RFC or to translate it into languages other than English."
+	case "noDerivativesTrust200902":
+		modify = "This document may not be modified, and derivative works of it may not be created, " +
+			"and it may not be published except as an Internet-Draft."
+	default:
+		return nil, nil
+	}
+
+	status = []string{
+		"This Internet-Draft is submitted in full conformance with the provisions of BCP 78 and BCP 79.",
+		"Internet-Drafts are working documents of the Internet Engineering Task Force (IETF). " +
+			"Note that other groups may also distribute working documents as Internet-Drafts. " +
+			"The list of current Internet-Drafts is at https://datatracker.ietf.org/drafts/current/.",
+		"Internet-Drafts are draft documents valid for a maximum of six months and may be updated, " +
+			"replaced, or obsoleted by other documents at any time. It is inappropriate to use " +
+			"Internet-Drafts as reference material or to cite them other than as \"work in progress.\"",
+		"This Internet-Draft will expire on " + expires(block.Date).Format("January 2, 2006") + ".",
+	}
+	if modify != "" {
+		status = append(status, modify)
+	}
+
+	legal := "This document is subject to BCP 78 and the IETF Trust's Legal Provisions Relating to IETF " +
+		"Documents (https://trustee.ietf.org/license-info) in effect on the date of publication of this " +
+		"document. Please review these documents carefully, as they describe your rights and restrictions " +
+		"with respect to this document."
+	// Only IETF stream documents have Code Components.
+	if block.SubmissionType == "" || strings.EqualFold(block.SubmissionType, "IETF") {
+		legal += " " + codeComponentsLicense
+	}
+	copyright = []string{
+		fmt.Sprintf("Copyright (c) %d IETF Trust and the persons identified as the document authors. All rights reserved.", block.Date.Year()),
+		legal,
+	}
+	if block.Ipr == "pre5378Trust200902" {
+		copyright = append(copyright, "This document may contain material from IETF Documents or IETF "+
+			"Contributions published or made publicly available before November 10, 2008. The person(s) "+
+			"controlling the copyright in some of this material may not have granted the IETF Trust the "+
+			"right to allow modifications of such material outside the IETF Standards Process. Without "+
+			"obtaining an adequate license from the person(s) controlling the copyright in such materials, "+
+			"this document may not be modified outside the IETF Standards Process, and derivative works of "+
+			"it may not be created outside the IETF Standards Process, except to format it for publication "+
+			"as an RFC or to translate it into languages other than English.")
+	}
+	return status, copyright
+}
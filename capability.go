@@ -0,0 +1,102 @@
+// What the renderers can output.
+
+package mmark
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// Constructs a renderer may not be able to output, the renderers drop these with a
+// warning (or an error with EXTENSION_STRICT).
+const (
+	CAPABILITY_FOOTNOTES     = 1 << iota // footnotes
+	CAPABILITY_MATH                      // $$...$$ math
+	CAPABILITY_SVG                       // SVG images
+	CAPABILITY_COLSPAN                   // table cells spanning columns
+	CAPABILITY_STRIKETHROUGH             // ~~strike through~~
+	CAPABILITY_PARTS                     // part headers (-#)
+
+	capabilityAll = CAPABILITY_FOOTNOTES | CAPABILITY_MATH | CAPABILITY_SVG | CAPABILITY_COLSPAN |
+		CAPABILITY_STRIKETHROUGH | CAPABILITY_PARTS
+)
+
+var capabilityNames = []ExtensionInfo{
+	{"footnotes", CAPABILITY_FOOTNOTES, "footnotes"},
+	{"math", CAPABILITY_MATH, "math"},
+	{"svg", CAPABILITY_SVG, "SVG images"},
+	{"colspan", CAPABILITY_COLSPAN, "table cells spanning columns"},
+	{"strikethrough", CAPABILITY_STRIKETHROUGH, "strike through"},
+	{"parts", CAPABILITY_PARTS, "part headers"},
+}
+
+// capabilityRenderer is implemented by renderers that tell which constructs they can output.
+type capabilityRenderer interface {
+	Capabilities() int
+}
+
+// Capabilities returns the constructs r can output. A renderer tells by implementing
+// Capabilities() int, otherwise it is assumed to output all.
+func Capabilities(r Renderer) int {
+	for ; r != nil; r = wrapped(r) {
+		if c, ok := r.(capabilityRenderer); ok {
+			return c.Capabilities()
+		}
+	}
+	return capabilityAll
+}
+
+var (
+	footnoteRe      = regexp.MustCompile(`\[\^[^\]\s]+\]|\^\[`)
+	svgRe           = regexp.MustCompile(`!\[[^\]]*\]\([^)\s]*\.svg[)\s]`)
+	colspanRe       = regexp.MustCompile(`(?m)^\|.*[^\\]\|\|`)
+	strikethroughRe = regexp.MustCompile(`~~[^~\s][^~]*~~`)
+	partRe          = regexp.MustCompile(`(?m)^-#`)
+)
+
+// constructs returns the constructs that are (likely) used in data, a quick scan of
+// the output of the first pass.
+func (p *parser) constructs(data []byte) int {
+	c := 0
+	if p.flags&EXTENSION_FOOTNOTES != 0 && footnoteRe.Match(data) {
+		c |= CAPABILITY_FOOTNOTES
+	}
+	if bytes.Contains(data, []byte("$$")) {
+		c |= CAPABILITY_MATH
+	}
+	if svgRe.Match(data) {
+		c |= CAPABILITY_SVG
+	}
+	if p.flags&EXTENSION_TABLES != 0 && colspanRe.Match(data) {
+		c |= CAPABILITY_COLSPAN
+	}
+	if strikethroughRe.Match(data) {
+		c |= CAPABILITY_STRIKETHROUGH
+	}
+	if p.flags&EXTENSION_PARTS != 0 && partRe.Match(data) {
+		c |= CAPABILITY_PARTS
+	}
+	return c
+}
+
+// CheckCapabilities warns, before rendering, about the constructs in the document
+// the renderer will drop, next to the diagnostics for every occurrence.
+var CheckCapabilities = false
+
+// checkCapabilities warns about every construct used in data the renderer will drop.
+func (p *parser) checkCapabilities(data []byte) {
+	defer p.phaseEnd("validation", p.phaseStart())
+	missing := p.constructs(data) &^ Capabilities(p.r)
+	if missing == 0 {
+		return
+	}
+	names := []string{}
+	for _, c := range capabilityNames {
+		if missing&c.Flag != 0 {
+			names = append(names, c.Description)
+		}
+	}
+	p.line = 0 // the whole document
+	warnf(p, "the %s renderer does not support %s, used in this document", backendName(p.r), strings.Join(names, ", "))
+}
@@ -0,0 +1,37 @@
+package mmark
+
+import "testing"
+
+func TestCapabilities(t *testing.T) {
+	input := "Text[^1] and ~~gone~~.\n\n[^1]: A note.\n\n![logo](logo.svg)\n"
+	extensions := EXTENSION_FOOTNOTES | EXTENSION_STRICT
+	defer func() { CheckCapabilities = false }()
+	CheckCapabilities = true
+
+	_, diags := ParseDiagnostics([]byte(input), Xml2Renderer(0), extensions)
+	if len(diags) == 0 || diags[0].Message != "the xml2 renderer does not support footnotes, SVG images, strike through, used in this document" {
+		t.Errorf("expected an early warning about footnotes, SVG and strike through, got %v", diags)
+	}
+
+	_, diags = ParseDiagnostics([]byte(input), HtmlRenderer(0, "", ""), extensions)
+	if len(diags) != 0 {
+		t.Errorf("expected no diagnostics for HTML, got %v", diags)
+	}
+
+	if c := Capabilities(XmlRenderer(0)); c&CAPABILITY_FOOTNOTES != 0 || c&CAPABILITY_SVG == 0 {
+		t.Errorf("expected SVG and no footnotes for xml, got %d", c)
+	}
+	for _, r := range []Renderer{
+		&review{Renderer: Xml2Renderer(0)},
+		&links{Renderer: &issues{Renderer: Xml2Renderer(0)}},
+		&section{Renderer: Xml2Renderer(0)},
+		&symbols{Renderer: Xml2Renderer(0), render: true},
+	} {
+		if c := Capabilities(r); c != CAPABILITY_MATH {
+			t.Errorf("expected only math for a wrapped xml2 renderer %T, got %d", r, c)
+		}
+	}
+	if c := Capabilities(SlidesRenderer(0, "")); c != capabilityAll {
+		t.Errorf("expected everything for slides, got %d", c)
+	}
+}
@@ -4,6 +4,8 @@ package mmark
 
 import (
 	"testing"
+
+	"github.com/miekg/mmark/mmarktest"
 )
 
 func runMarkdownCommonMark(input string, extensions int) string {
@@ -15,34 +17,9 @@ func runMarkdownCommonMark(input string, extensions int) string {
 }
 
 func doTestsCommonMark(t *testing.T, tests []string, extensions int) {
-	// catch and report panics
-	var candidate string
-	defer func() {
-		if err := recover(); err != nil {
-			t.Errorf("\npanic while processing [%#v]: %s\n", candidate, err)
-		}
-	}()
-
-	for i := 0; i+1 < len(tests); i += 2 {
-		input := tests[i]
-		candidate = input
-		expected := tests[i+1]
-		actual := runMarkdownCommonMark(candidate, extensions)
-		if actual != expected {
-			t.Errorf("\nInput   [%#v]\nExpected[%#v]\nActual  [%#v]",
-				candidate, expected, actual)
-		}
-
-		// now test every substring to stress test bounds checking
-		if !testing.Short() {
-			for start := 0; start < len(input); start++ {
-				for end := start + 1; end <= len(input); end++ {
-					candidate = input[start:end]
-					_ = runMarkdownBlock(candidate, extensions)
-				}
-			}
-		}
-	}
+	mmarktest.Table(t, tests, func(input []byte) []byte {
+		return []byte(runMarkdownCommonMark(string(input), extensions))
+	})
 }
 
 func TestPrefixHeaderCommonMark_29(t *testing.T) {
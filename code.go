@@ -13,9 +13,115 @@ import (
 	"io/ioutil"
 	"regexp"
 	"strconv"
+	"strings"
 	"unicode/utf8"
 )
 
+// CodeInfo is the info string of a fenced code block, i.e. ```go title="client.go" hl=3.
+type CodeInfo struct {
+	Lang      string            // the first word, the language of the code
+	Title     string            // title=, a file name or caption to show with the code
+	Lines     string            // lines=, the lines of the source file the code comes from
+	Highlight string            // hl=, the lines to highlight, e.g. 3 or 3,5-7
+	Params    map[string]string // all key=value pairs
+}
+
+// CodeLanguageAliases maps the language of a code block, as written in the source,
+// to the language used in the output: the type attribute in XML2RFC and the
+// language- class in HTML, e.g. "shell": "bash". Keys are lower case.
+var CodeLanguageAliases = map[string]string{}
+
+// codeLanguage returns the language lang is an alias for, or lang.
+func codeLanguage(lang string) string {
+	if a, ok := CodeLanguageAliases[strings.ToLower(lang)]; ok {
+		return a
+	}
+	return lang
+}
+
+// parseCodeInfo parses an info string, values may be quoted with double quotes.
+func parseCodeInfo(info string) CodeInfo {
+	c := CodeInfo{Params: map[string]string{}}
+	for i := 0; i < len(info); {
+		for i < len(info) && info[i] == ' ' {
+			i++
+		}
+		beg := i
+		for i < len(info) && info[i] != ' ' && info[i] != '=' {
+			i++
+		}
+		key := info[beg:i]
+		if i >= len(info) || info[i] != '=' {
+			if key != "" && c.Lang == "" && len(c.Params) == 0 {
+				c.Lang = codeLanguage(key)
+			}
+			continue
+		}
+		i++
+		beg = i
+		value := ""
+		if i < len(info) && info[i] == '"' {
+			i++
+			for i < len(info) && info[i] != '"' {
+				i++
+			}
+			value = info[beg+1 : i]
+			if i < len(info) {
+				i++
+			}
+		} else {
+			for i < len(info) && info[i] != ' ' {
+				i++
+			}
+			value = info[beg:i]
+		}
+		c.Params[key] = value
+	}
+	c.Title, c.Lines, c.Highlight = c.Params["title"], c.Params["lines"], c.Params["hl"]
+	return c
+}
+
+// component is a code block marked with {component="true"}, it is moved to the
+// Code Components appendix when EXTENSION_CODE_COMPONENTS is set.
+type component struct {
+	info CodeInfo
+	code []byte
+}
+
+// codeComponentsLicense is the boilerplate of the Code Components appendix, it
+// ends the copyright notice of IETF stream documents as well.
+const codeComponentsLicense = "Code Components extracted from this document must include Revised BSD License " +
+	"text as described in Section 4.e of the Trust Legal Provisions and are provided without warranty as " +
+	"described in the Revised BSD License."
+
+// codeComponents renders the Code Components appendix: the license boilerplate
+// and a section per component, titled with its file name, with the code between
+// <CODE BEGINS> and <CODE ENDS> markers.
+func (p *parser) codeComponents(out *bytes.Buffer) {
+	if len(p.components) == 0 {
+		return
+	}
+	p.r.SetAttr(nil)
+	p.r.Header(out, func() bool { p.r.NormalText(out, []byte("Code Components")); return true }, 1, "code-components")
+	p.r.SetAttr(nil)
+	p.r.Paragraph(out, func() bool { p.r.NormalText(out, []byte(codeComponentsLicense)); return true }, 0)
+	for i, c := range p.components {
+		name := c.info.Title
+		begins := "<CODE BEGINS>"
+		if name == "" {
+			name = "Component " + strconv.Itoa(i+1)
+		} else {
+			begins += " file \"" + name + "\""
+		}
+		p.r.SetAttr(nil)
+		p.r.Header(out, func() bool { p.r.NormalText(out, []byte(name)); return true }, 2, "code-component-"+strconv.Itoa(i+1))
+		code := append([]byte(begins+"\n"), c.code...)
+		code = append(code, "<CODE ENDS>\n"...)
+		p.r.SetAttr(nil)
+		p.r.BlockCode(out, code, c.info, nil, false, false)
+	}
+}
+
 // SourceCodeTypes are the different languages that are supported as
 // a type attribute in sourcecode, see Section 2.48.4 of XML2RFC v3 (-21).
 var SourceCodeTypes = map[string]bool{
@@ -40,18 +146,24 @@ var SourceCodeTypes = map[string]bool{
 }
 
 // parseAddress parses a code address directive and returns the bytes.
-func parseAddress(addr []byte, file []byte) []byte {
+func parseAddress(p *parser, addr []byte, file []byte) []byte {
 	bytes.TrimSpace(addr)
 
-	textBytes, err := ioutil.ReadFile(string(file))
+	name, err := includeFile(string(file))
+	if err != nil {
+		errorf(p, "failed: %s", err)
+		return nil
+	}
+	textBytes, err := ioutil.ReadFile(name)
 	if err != nil {
-		printf(nil, "failed: `%s': %s", string(file), err)
+		errorf(p, "failed: `%s': %s", string(file), err)
 		return nil
 	}
+	textBytes = normalizeInput(textBytes)
 
 	lo, hi, err := addrToByteRange(string(addr), 0, textBytes)
 	if err != nil {
-		printf(nil, "code include address: %s", err.Error())
+		errorf(p, "code include address: %s", err.Error())
 		return textBytes
 	}
 
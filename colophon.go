@@ -0,0 +1,35 @@
+// Colophon noting the version, time and extensions of a conversion.
+
+package mmark
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Colophon adds a comment to the end of the output with the version of mmark, the
+// time of the conversion and the enabled extensions. When SOURCE_DATE_EPOCH is set
+// it is used as the time, to keep builds reproducible.
+var Colophon = false
+
+// conversionTime returns the time from SOURCE_DATE_EPOCH, or the current time.
+func conversionTime(p *parser) time.Time {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now().UTC()
+	}
+	sec, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		warnf(p, "invalid SOURCE_DATE_EPOCH: %s, using the current time", epoch)
+		return time.Now().UTC()
+	}
+	return time.Unix(sec, 0).UTC()
+}
+
+// colophon writes the colophon as a comment, which is valid in HTML, XML and markdown.
+func (p *parser) colophon(out *bytes.Buffer) {
+	out.WriteString("<!-- mmark " + Version + ", " + conversionTime(p).Format(time.RFC3339))
+	out.WriteString(", " + backendName(p.r) + ", extensions: " + flagString(extensionFlags, p.flags) + " -->\n")
+}
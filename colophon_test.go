@@ -0,0 +1,25 @@
+package mmark
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestColophon(t *testing.T) {
+	defer func() { Colophon = false }()
+	Colophon = true
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	os.Setenv("SOURCE_DATE_EPOCH", "1500000000")
+
+	output := Parse([]byte("Text\n"), XmlRenderer(0), EXTENSION_TABLES|EXTENSION_FENCED_CODE)
+	if expected := "</t>\n<!-- mmark " + Version + ", 2017-07-14T02:40:00Z, xml, extensions: fenced_code,tables -->\n"; !strings.HasSuffix(output.String(), expected) {
+		t.Errorf("expected %q at the end of %q", expected, output)
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	_, diags := ParseDiagnostics([]byte("Text\n"), HtmlRenderer(0, "", ""), 0)
+	if len(diags) != 1 || diags[0].Message != "invalid SOURCE_DATE_EPOCH: yesterday, using the current time" {
+		t.Errorf("expected a warning for the invalid SOURCE_DATE_EPOCH, got %v", diags)
+	}
+}
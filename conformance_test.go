@@ -0,0 +1,206 @@
+//go:build conformance
+// +build conformance
+
+// Conformance tests: convert the RFCs in rfc/ to xml2rfc v2, v3 and HTML and check
+// the XML is well-formed. When jing is installed the v3 output is validated
+// against xml2rfcv3.rnc, when xml2rfc is installed the v2 and v3 output are
+// compared after running them through its preptool. Run with:
+// go test -tags conformance -run 'Conformance|Preptool'.
+
+package mmark
+
+import (
+	"bytes"
+	xmllib "encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	files, err := filepath.Glob("rfc/*.md")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no documents in rfc/: %v", err)
+	}
+	jing, _ := exec.LookPath("jing")
+
+	extensions := commonXmlExtensions | EXTENSION_TITLEBLOCK_TOML | EXTENSION_FOOTNOTES | EXTENSION_INCLUDE
+	for _, file := range files {
+		input, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range []struct {
+			name     string
+			renderer Renderer
+			xml      bool
+		}{
+			{"xml2", Xml2Renderer(XML2_STANDALONE), true},
+			{"xml", XmlRenderer(XML_STANDALONE), true},
+			{"html", HtmlRenderer(HTML_COMPLETE_PAGE, "", ""), false},
+		} {
+			out, diags := ParseDiagnostics(input, r.renderer, extensions)
+			for _, d := range diags {
+				if d.Severity == SeverityError {
+					t.Errorf("%s (%s): %s", file, r.name, d)
+				}
+			}
+			if !r.xml {
+				if !bytes.Contains(out.Bytes(), []byte("</html>")) {
+					t.Errorf("%s (%s): incomplete page", file, r.name)
+				}
+				continue
+			}
+			if err := wellFormed(out.Bytes()); err != nil {
+				t.Errorf("%s (%s): not well-formed: %v", file, r.name, err)
+				continue
+			}
+			if r.name == "xml" && jing != "" {
+				cmd := exec.Command(jing, "-c", "xml2rfcv3.rnc", "/dev/stdin")
+				cmd.Stdin = out
+				if msg, err := cmd.CombinedOutput(); err != nil {
+					t.Errorf("%s (%s): not valid: %s", file, r.name, msg)
+				}
+			}
+		}
+	}
+}
+
+// wellFormed returns an error if doc is not well-formed XML. The HTML entities
+// are allowed, xml2rfc knows them.
+func wellFormed(doc []byte) error {
+	d := xmllib.NewDecoder(bytes.NewReader(doc))
+	d.Entity = xmllib.HTMLEntity
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// TestPreptool runs the v3 output, and the v2 output converted to v3 with
+// xml2rfc --v2v3, through xml2rfc's preptool and reports where the two differ in
+// sections, paragraphs or cross references. It is skipped when xml2rfc is not
+// installed.
+func TestPreptool(t *testing.T) {
+	xml2rfc, err := exec.LookPath("xml2rfc")
+	if err != nil {
+		t.Skip("xml2rfc not installed")
+	}
+	dir, err := ioutil.TempDir("", "mmark-preptool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	run := func(args ...string) error {
+		if msg, err := exec.Command(xml2rfc, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("xml2rfc %s: %v: %s", strings.Join(args, " "), err, msg)
+		}
+		return nil
+	}
+
+	files, _ := filepath.Glob("rfc/*.md")
+	extensions := commonXmlExtensions | EXTENSION_TITLEBLOCK_TOML | EXTENSION_FOOTNOTES | EXTENSION_INCLUDE
+	for _, file := range files {
+		input, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		base := filepath.Join(dir, filepath.Base(file))
+		v2, v3 := base+".2.xml", base+".3.xml"
+		ioutil.WriteFile(v2, Parse(input, Xml2Renderer(XML2_STANDALONE), extensions).Bytes(), 0644)
+		ioutil.WriteFile(v3, Parse(input, XmlRenderer(XML_STANDALONE), extensions).Bytes(), 0644)
+
+		if err := run("--v2v3", v2, "--out", v2+".v3"); err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if err := run("--preptool", v2+".v3", "--out", v2+".prep"); err != nil {
+			t.Errorf("%s (xml2): %v", file, err)
+			continue
+		}
+		if err := run("--preptool", v3, "--out", v3+".prep"); err != nil {
+			t.Errorf("%s (xml): %v", file, err)
+			continue
+		}
+
+		s2, err := semantics(v2 + ".prep")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s3, err := semantics(v3 + ".prep")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(s2) || i < len(s3); i++ {
+			a, b := "", ""
+			if i < len(s2) {
+				a = s2[i]
+			}
+			if i < len(s3) {
+				b = s3[i]
+			}
+			if a != b {
+				t.Errorf("%s: v2 and v3 differ at item %d:\nxml2: %s\nxml:  %s", file, i, a, b)
+				break
+			}
+		}
+	}
+}
+
+// semantics returns the sections, paragraphs and cross references of the prepped
+// document in file, in document order, with the whitespace normalized.
+func semantics(file string) ([]string, error) {
+	doc, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	d := xmllib.NewDecoder(bytes.NewReader(doc))
+	d.Entity = xmllib.HTMLEntity
+	items := []string{}
+	texts := []*bytes.Buffer{}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xmllib.StartElement:
+			switch tok.Name.Local {
+			case "section":
+				items = append(items, "section")
+			case "xref":
+				for _, a := range tok.Attr {
+					if a.Name.Local == "target" {
+						items = append(items, "xref "+a.Value)
+					}
+				}
+			case "t", "name":
+				texts = append(texts, &bytes.Buffer{})
+			}
+		case xmllib.CharData:
+			for _, b := range texts {
+				b.Write(tok)
+			}
+		case xmllib.EndElement:
+			if n := tok.Name.Local; (n == "t" || n == "name") && len(texts) > 0 {
+				text := texts[len(texts)-1]
+				texts = texts[:len(texts)-1]
+				items = append(items, n+" "+strings.Join(strings.Fields(text.String()), " "))
+			}
+		}
+	}
+}
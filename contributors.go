@@ -0,0 +1,65 @@
+// Acknowledgements and Contributors sections from the title block.
+
+package mmark
+
+import "bytes"
+
+// unnumberer is a renderer that numbers sections unless their attributes say
+// otherwise, Unnumbered sets those in ial.
+type unnumberer interface {
+	Unnumbered(ial *inlineAttr)
+}
+
+// unnumberedHeader renders an unnumbered level 1 section header.
+func (p *parser) unnumberedHeader(out *bytes.Buffer, title, id string) {
+	ial := newInlineAttr()
+	for r := p.r; r != nil; r = wrapped(r) {
+		if u, ok := r.(unnumberer); ok {
+			u.Unnumbered(ial)
+			break
+		}
+	}
+	p.r.SetAttr(ial)
+	p.r.Header(out, func() bool { p.r.NormalText(out, []byte(title)); return true }, 1, id)
+}
+
+// acknowledgementsSection renders the acknowledgements of the title block as
+// markdown in an unnumbered Acknowledgements section.
+func (p *parser) acknowledgementsSection(out *bytes.Buffer) {
+	if p.acknowledgements == "" {
+		return
+	}
+	p.unnumberedHeader(out, "Acknowledgements", "acknowledgements")
+	p.block(out, []byte(p.acknowledgements+"\n"))
+}
+
+// contributorsSection renders the contributors of the title block in an unnumbered
+// Contributors section, one paragraph per contributor with the name, organizations
+// and email on separate lines.
+func (p *parser) contributorsSection(out *bytes.Buffer) {
+	if len(p.contributors) == 0 {
+		return
+	}
+	p.unnumberedHeader(out, "Contributors", "contributors")
+	for _, c := range p.contributors {
+		lines := []string{c.Fullname}
+		for _, o := range c.organizations() {
+			if o.Organization != "" {
+				lines = append(lines, o.Organization)
+			}
+		}
+		if c.Address.Email != "" {
+			lines = append(lines, "Email: "+c.Address.Email)
+		}
+		p.r.SetAttr(nil)
+		p.r.Paragraph(out, func() bool {
+			for i, l := range lines {
+				if i > 0 {
+					p.r.LineBreak(out)
+				}
+				p.r.NormalText(out, []byte(l))
+			}
+			return true
+		}, 0)
+	}
+}
@@ -0,0 +1,36 @@
+// Convert a document in one call, for use from other languages.
+
+package mmark
+
+import "fmt"
+
+// ConvertExtensions are the extensions Convert uses, includes are not enabled.
+const ConvertExtensions = commonXmlExtensions | EXTENSION_TITLEBLOCK_TOML | EXTENSION_FOOTNOTES | EXTENSION_PARTS
+
+// Convert renders input for target, which is one of html, xml (xml2rfc v3), xml2
+// (xml2rfc v2) or slides. The flags are the renderer flags of that target, e.g.
+// HTML_COMPLETE_PAGE or XML_STANDALONE.
+func Convert(input []byte, target string, flags int) ([]byte, error) {
+	out, _, err := ConvertDiagnostics(input, target, flags)
+	return out, err
+}
+
+// ConvertDiagnostics is like Convert, but also returns the diagnostics, see
+// ParseDiagnostics.
+func ConvertDiagnostics(input []byte, target string, flags int) ([]byte, []Diagnostic, error) {
+	var renderer Renderer
+	switch target {
+	case "html":
+		renderer = HtmlRenderer(flags, "", "")
+	case "xml":
+		renderer = XmlRenderer(flags)
+	case "xml2":
+		renderer = Xml2Renderer(flags)
+	case "slides":
+		renderer = SlidesRenderer(flags, "")
+	default:
+		return nil, nil, fmt.Errorf("mmark: unknown target: %s", target)
+	}
+	out, diags := ParseDiagnostics(input, renderer, ConvertExtensions)
+	return out.Bytes(), diags, nil
+}
@@ -0,0 +1,109 @@
+// CriticMarkup, see http://criticmarkup.com.
+
+package mmark
+
+import "bytes"
+
+var criticClose = map[byte][]byte{
+	'+': []byte("++}"),
+	'-': []byte("--}"),
+	'~': []byte("~~}"),
+	'>': []byte("<<}"),
+	'=': []byte("==}"),
+}
+
+// critic parses {++insertion++}, {--deletion--}, {~~old~>new~~}, {>>comment<<}
+// and {==highlight==}. With EXTENSION_CRITIC_ACCEPT or EXTENSION_CRITIC_REJECT
+// the changes are accepted or rejected and comments are dropped, otherwise they
+// are handed to the renderer.
+func critic(p *parser, out *bytes.Buffer, data []byte) int {
+	if len(data) < 3 || data[2] != data[1] {
+		return 0
+	}
+	closing, ok := criticClose[data[1]]
+	if !ok {
+		return 0
+	}
+	end := bytes.Index(data[3:], closing)
+	if end < 0 {
+		return 0
+	}
+	text := data[3 : 3+end]
+	consumed := 3 + end + len(closing)
+
+	accept := p.flags&EXTENSION_CRITIC_ACCEPT != 0
+	reject := p.flags&EXTENSION_CRITIC_REJECT != 0
+
+	r := p.criticRenderer()
+	if r == nil {
+		r = plainCritic{p.r}
+	}
+	render := func(f func(*bytes.Buffer, []byte), text []byte) {
+		var work bytes.Buffer
+		p.inline(&work, text)
+		if accept || reject {
+			out.Write(work.Bytes())
+			return
+		}
+		f(out, work.Bytes())
+	}
+
+	switch data[1] {
+	case '+':
+		if !reject {
+			render(r.Insertion, text)
+		}
+	case '-':
+		if !accept {
+			render(r.Deletion, text)
+		}
+	case '~':
+		i := bytes.Index(text, []byte("~>"))
+		if i < 0 {
+			return 0
+		}
+		if !accept {
+			render(r.Deletion, text[:i])
+		}
+		if !reject {
+			render(r.Insertion, text[i+2:])
+		}
+	case '>':
+		if !accept && !reject {
+			var work bytes.Buffer
+			attrEscape(&work, text)
+			r.CriticComment(out, work.Bytes())
+		}
+	case '=':
+		render(r.Highlight, text)
+	}
+	return consumed
+}
+
+// criticRenderer is a renderer that renders CriticMarkup.
+type criticRenderer interface {
+	Insertion(out *bytes.Buffer, text []byte)
+	Deletion(out *bytes.Buffer, text []byte)
+	CriticComment(out *bytes.Buffer, text []byte)
+	Highlight(out *bytes.Buffer, text []byte)
+}
+
+// criticRenderer returns the renderer, or the one it wraps, that renders
+// CriticMarkup, nil if there is none.
+func (p *parser) criticRenderer() criticRenderer {
+	for r := p.r; r != nil; r = wrapped(r) {
+		if c, ok := r.(criticRenderer); ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// plainCritic renders CriticMarkup for a renderer that doesn't: insertions and
+// highlights as text, deletions struck through and comments not at all.
+type plainCritic struct{ r Renderer }
+
+func (c plainCritic) Insertion(out *bytes.Buffer, text []byte)     { out.Write(text) }
+func (c plainCritic) Deletion(out *bytes.Buffer, text []byte)      { c.r.StrikeThrough(out, text) }
+func (c plainCritic) CriticComment(out *bytes.Buffer, text []byte) {}
+func (c plainCritic) Highlight(out *bytes.Buffer, text []byte)     { out.Write(text) }
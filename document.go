@@ -0,0 +1,86 @@
+// Convert a document and return its metadata along with the output.
+
+package mmark
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// Reference is a document that is cited.
+type Reference struct {
+	Anchor    string
+	Normative bool
+	URL       string // URL of the bibxml reference, empty if the reference XML is included in the document
+
+	// These are only known when the reference XML is included in the document.
+	Title   string
+	Authors []string
+	Year    string
+	Target  string
+
+	xml []byte
+}
+
+// Document is a converted document and its metadata.
+type Document struct {
+	Body       []byte
+	TitleBlock *TitleBlock
+	TOC        []TOCEntry
+	References []Reference // sorted on anchor
+}
+
+// ParseDocument parses and renders input like Parse does, but also returns the
+// title block, table of contents and references of the document, so callers
+// don't need to parse the document more than once. With the Html renderer (without
+// HTML_COMPLETE_PAGE) Body is the HTML body a static site generator needs.
+func ParseDocument(input []byte, renderer Renderer, extensions int) *Document {
+	if renderer == nil {
+		return nil
+	}
+	r := &symbols{Renderer: renderer, render: true}
+	body := parse(input, r, extensions, nil)
+	doc := &Document{Body: body.Bytes(), TitleBlock: r.titleBlock, TOC: tocEntries(r.symbols, r.titleBlock)}
+
+	for anchor, c := range r.p.citations {
+		doc.References = append(doc.References, newReference(r.p, anchor, c))
+	}
+	sort.Sort(referencesByAnchor(doc.References))
+	return doc
+}
+
+type referencesByAnchor []Reference
+
+func (r referencesByAnchor) Len() int           { return len(r) }
+func (r referencesByAnchor) Less(i, j int) bool { return r[i].Anchor < r[j].Anchor }
+func (r referencesByAnchor) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// HtmlPage is the data given to a user supplied html/template that wraps the
+// HTML body of a document in a complete page.
+type HtmlPage struct {
+	Body       template.HTML
+	TitleBlock *TitleBlock
+	TOC        []TOCEntry
+	References []Reference
+	Date       time.Time // from the title block, or the current time
+	Version    string    // of mmark
+}
+
+// ExecuteTemplate executes t with the HtmlPage of d and writes the result to w.
+// Body is used as is, so d must have been rendered by the Html renderer.
+func (d *Document) ExecuteTemplate(w io.Writer, t *template.Template) error {
+	page := HtmlPage{
+		Body:       template.HTML(d.Body),
+		TitleBlock: d.TitleBlock,
+		TOC:        d.TOC,
+		References: d.References,
+		Date:       time.Now(),
+		Version:    Version,
+	}
+	if d.TitleBlock != nil {
+		page.Date = d.TitleBlock.Date
+	}
+	return t.Execute(w, page)
+}
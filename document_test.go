@@ -0,0 +1,116 @@
+package mmark
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+)
+
+func TestParseDocument(t *testing.T) {
+	input := []byte(`% title = "Test"
+
+# Introduction
+
+See [@!RFC2119] and [@I-D.ietf-foo].
+
+## More
+`)
+	extensions := EXTENSION_TITLEBLOCK_TOML | EXTENSION_CITATION | EXTENSION_AUTO_HEADER_IDS
+	doc := ParseDocument(input, HtmlRenderer(0, "", ""), extensions)
+	if expected := Parse(input, HtmlRenderer(0, "", ""), extensions).Bytes(); !bytes.Equal(doc.Body, expected) {
+		t.Errorf("expected body %q, got %q", expected, doc.Body)
+	}
+	if doc.TitleBlock == nil || doc.TitleBlock.Title != "Test" {
+		t.Errorf("expected title block, got %+v", doc.TitleBlock)
+	}
+	if len(doc.TOC) != 2 || doc.TOC[1].Title != "More" || doc.TOC[1].Level != 2 {
+		t.Errorf("unexpected TOC: %+v", doc.TOC)
+	}
+	if len(doc.References) != 2 {
+		t.Fatalf("expected 2 references, got %+v", doc.References)
+	}
+	if r := doc.References[1]; r.Anchor != "RFC2119" || !r.Normative || r.URL != CitationsRFC+"reference.RFC.2119.xml" {
+		t.Errorf("unexpected reference: %+v", r)
+	}
+	if r := doc.References[0]; r.Anchor != "I-D.ietf-foo" || r.Normative {
+		t.Errorf("unexpected reference: %+v", r)
+	}
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	input := []byte("% title = \"A & B\"\n% date = 2016-01-02T00:00:00Z\n\n# Intro\n\nText\n")
+	doc := ParseDocument(input, HtmlRenderer(0, "", ""), EXTENSION_TITLEBLOCK_TOML|EXTENSION_AUTO_HEADER_IDS)
+	tmpl := template.Must(template.New("page").Parse(
+		`<title>{{.TitleBlock.Title}}</title>{{range .TOC}}<a href="#{{.Anchor}}">{{.Title}}</a>{{end}}{{.Date.Year}}{{.Body}}`))
+
+	var out bytes.Buffer
+	if err := doc.ExecuteTemplate(&out, tmpl); err != nil {
+		t.Fatal(err)
+	}
+	expected := "<title>A &amp; B</title><a href=\"#intro\">Intro</a>2016" + string(doc.Body)
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestParseReview(t *testing.T) {
+	input := "# Header\n\nA paragraph\nover two lines.\n\n* item\n\n    more item\n\n> quote\n"
+	out, anchors := ParseReview([]byte(input), HtmlRenderer(0, "", ""), 0)
+	expected := []ReviewAnchor{
+		{"review-1", 1, "header"},
+		{"review-2", 3, "paragraph"},
+		{"review-3", 6, "list"},
+		{"review-4", 10, "quote"},
+	}
+	if len(anchors) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, anchors)
+	}
+	for i := range expected {
+		if anchors[i] != expected[i] {
+			t.Errorf("anchor %d: expected %+v, got %+v", i, expected[i], anchors[i])
+		}
+		if !bytes.Contains(out.Bytes(), []byte(`<a id="`+expected[i].Anchor+`"></a>`)) {
+			t.Errorf("anchor %s not in output: %s", expected[i].Anchor, out)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	out, err := Convert([]byte("# Intro\n"), "xml", 0)
+	if err != nil || !bytes.Contains(out, []byte(`<section anchor="intro">`)) {
+		t.Errorf("unexpected output %q (%v)", out, err)
+	}
+	if _, err := Convert([]byte("# Intro\n"), "latex", 0); err == nil {
+		t.Errorf("expected an error for an unknown target")
+	}
+}
+
+func TestBoilerplate(t *testing.T) {
+	input := []byte(`% title = "Test"
+% ipr = "noDerivativesTrust200902"
+% submissionType = "independent"
+% date = 2017-01-02T00:00:00Z
+
+# Introduction
+`)
+	out := Parse(input, HtmlRenderer(HTML_COMPLETE_PAGE, "", ""), EXTENSION_TITLEBLOCK_TOML).String()
+	for _, s := range []string{
+		`<h2 id="status-of-memo">Status of This Memo</h2>`,
+		"This Internet-Draft will expire on July 6, 2017.",
+		"it may not be published except as an Internet-Draft.",
+		"Copyright (c) 2017 IETF Trust",
+	} {
+		if !bytes.Contains([]byte(out), []byte(s)) {
+			t.Errorf("expected %q in %s", s, out)
+		}
+	}
+	if bytes.Contains([]byte(out), []byte("Code Components")) {
+		t.Errorf("expected no Code Components text for an independent submission")
+	}
+
+	rfc := bytes.Replace(input, []byte("% title"), []byte("% number = 1234\n% title"), 1)
+	out = Parse(rfc, HtmlRenderer(HTML_COMPLETE_PAGE, "", ""), EXTENSION_TITLEBLOCK_TOML).String()
+	if bytes.Contains([]byte(out), []byte("Status of This Memo")) {
+		t.Errorf("expected no Internet-Draft boilerplate in an RFC")
+	}
+}
@@ -0,0 +1,103 @@
+// Emoji shortcodes, like :warning:.
+
+package mmark
+
+import (
+	"bytes"
+	"strings"
+)
+
+// emoji maps the shortcodes GitHub uses to their emoji.
+var emoji = map[string]string{
+	"+1":                    "\U0001F44D",
+	"-1":                    "\U0001F44E",
+	"thumbsup":              "\U0001F44D",
+	"thumbsdown":            "\U0001F44E",
+	"smile":                 "\U0001F604",
+	"smiley":                "\U0001F603",
+	"grin":                  "\U0001F601",
+	"laughing":              "\U0001F606",
+	"wink":                  "\U0001F609",
+	"blush":                 "\U0001F60A",
+	"confused":              "\U0001F615",
+	"cry":                   "\U0001F622",
+	"thinking":              "\U0001F914",
+	"tada":                  "\U0001F389",
+	"rocket":                "\U0001F680",
+	"fire":                  "\U0001F525",
+	"bug":                   "\U0001F41B",
+	"sparkles":              "✨",
+	"star":                  "⭐",
+	"heart":                 "❤️",
+	"warning":               "⚠️",
+	"no_entry":              "⛔",
+	"x":                     "❌",
+	"heavy_check_mark":      "✔️",
+	"white_check_mark":      "✅",
+	"ballot_box_with_check": "☑️",
+	"question":              "❓",
+	"exclamation":           "❗",
+	"information_source":    "ℹ️",
+	"bulb":                  "\U0001F4A1",
+	"memo":                  "\U0001F4DD",
+	"pencil2":               "✏️",
+	"book":                  "\U0001F4D6",
+	"books":                 "\U0001F4DA",
+	"link":                  "\U0001F517",
+	"lock":                  "\U0001F512",
+	"unlock":                "\U0001F513",
+	"key":                   "\U0001F511",
+	"wrench":                "\U0001F527",
+	"hammer":                "\U0001F528",
+	"gear":                  "⚙️",
+	"package":               "\U0001F4E6",
+	"construction":          "\U0001F6A7",
+	"zap":                   "⚡",
+	"hourglass":             "⌛",
+	"clock":                 "\U0001F552",
+	"calendar":              "\U0001F4C6",
+	"email":                 "\U0001F4E7",
+	"mag":                   "\U0001F50D",
+	"eyes":                  "\U0001F440",
+	"point_right":           "\U0001F449",
+	"arrow_right":           "➡️",
+	"arrow_left":            "⬅️",
+	"arrow_up":              "⬆️",
+	"arrow_down":            "⬇️",
+	"recycle":               "♻️",
+	"100":                   "\U0001F4AF",
+}
+
+// emojiRenderer is a renderer that renders emoji, the others get the name of the
+// shortcode as text.
+type emojiRenderer interface {
+	Emoji(out *bytes.Buffer, emoji string)
+}
+
+// '[:]' for emoji shortcodes, falls back to autoLink if that is enabled. An
+// emojiRenderer, like HTML, gets the emoji, the others its name, e.g. "warning".
+func emojiShortcode(p *parser, out *bytes.Buffer, data []byte, offset int) int {
+	if offset == 0 || !isalnum(data[offset-1]) {
+		end := offset + 1
+		for end < len(data) && end-offset <= 32 && (isalnum(data[end]) || bytes.IndexByte([]byte("_+-"), data[end]) >= 0) {
+			end++
+		}
+		if end < len(data) && data[end] == ':' {
+			name := string(data[offset+1 : end])
+			if e, ok := emoji[name]; ok {
+				for r := p.r; r != nil; r = wrapped(r) {
+					if er, ok := r.(emojiRenderer); ok {
+						er.Emoji(out, e)
+						return end - offset + 1
+					}
+				}
+				p.r.NormalText(out, []byte(strings.Replace(name, "_", " ", -1)))
+				return end - offset + 1
+			}
+		}
+	}
+	if p.flags&EXTENSION_AUTOLINK != 0 {
+		return autoLink(p, out, data, offset)
+	}
+	return 0
+}
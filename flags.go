@@ -0,0 +1,200 @@
+// Names and descriptions of the extensions and the renderer flags.
+
+package mmark
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExtensionInfo describes an extension or a renderer flag.
+type ExtensionInfo struct {
+	Name        string // lower case name without the prefix, e.g. "fenced_code" for EXTENSION_FENCED_CODE
+	Flag        int
+	Description string
+}
+
+var extensionFlags = []ExtensionInfo{
+	{"abbreviations", EXTENSION_ABBREVIATIONS, "Render abbreviations `*[HTML]: Hyper Text Markup Language`"},
+	{"auto_header_ids", EXTENSION_AUTO_HEADER_IDS, "Create the header ID from the text"},
+	{"autolink", EXTENSION_AUTOLINK, "Detect embedded URLs that are not explicitly marked"},
+	{"citation", EXTENSION_CITATION, "Support citations via the link syntax"},
+	{"example_lists", EXTENSION_EXAMPLE_LISTS, "Render '(@tag)  ' example lists"},
+	{"fenced_code", EXTENSION_FENCED_CODE, "Render fenced code blocks"},
+	{"footnotes", EXTENSION_FOOTNOTES, "Pandoc-style footnotes"},
+	{"hard_line_break", EXTENSION_HARD_LINE_BREAK, "Translate newlines into line breaks"},
+	{"header_ids", EXTENSION_HEADER_IDS, "Specify header IDs with {#id}"},
+	{"include", EXTENSION_INCLUDE, "Include file with {{ syntax"},
+	{"inline_attr", EXTENSION_INLINE_ATTR, "Detect CommonMark's IAL syntax"},
+	{"lax_html_blocks", EXTENSION_LAX_HTML_BLOCKS, "Loosen up HTML block parsing rules"},
+	{"math", EXTENSION_MATH, "Detect $$...$$ and parse as math"},
+	{"matter", EXTENSION_MATTER, "Use {frontmatter} {mainmatter} {backmatter}"},
+	{"no_empty_line_before_block", EXTENSION_NO_EMPTY_LINE_BEFORE_BLOCK, "No need to insert an empty line to start a (code, quote, order list, unorder list) block"},
+	{"parts", EXTENSION_PARTS, "Detect part headers (-#)"},
+	{"quotes", EXTENSION_QUOTES, "Allow A> as asides"},
+	{"short_ref", EXTENSION_SHORT_REF, "(#id) will be a cross reference"},
+	{"space_headers", EXTENSION_SPACE_HEADERS, "Be strict about prefix header rules"},
+	{"tables", EXTENSION_TABLES, "Render tables"},
+	{"titleblock_toml", EXTENSION_TITLEBLOCK_TOML, "Titleblock in TOML"},
+	{"unique_header_ids", EXTENSION_UNIQUE_HEADER_IDS, "When detecting identical anchors add a sequence number -1, -2 etc"},
+	{"backslash_line_break", EXTENSION_BACKSLASH_LINE_BREAK, "Translate trailing backslashes into line breaks"},
+	{"rfc7328", EXTENSION_RFC7328, "Parse RFC 7328 markdown. Depends on FOOTNOTES extension."},
+	{"definition_lists", EXTENSION_DEFINITION_LISTS, "Render definition lists"},
+	{"critic", EXTENSION_CRITIC, "Render CriticMarkup changes and comments"},
+	{"critic_accept", EXTENSION_CRITIC_ACCEPT, "Accept all CriticMarkup changes and drop the comments"},
+	{"critic_reject", EXTENSION_CRITIC_REJECT, "Reject all CriticMarkup changes and drop the comments"},
+	{"strict", EXTENSION_STRICT, "Constructs the renderer can't output are errors instead of warnings"},
+	{"code_components", EXTENSION_CODE_COMPONENTS, "Move code blocks with {component=\"true\"} to a Code Components appendix"},
+	{"iana", EXTENSION_IANA, "Render ```iana code blocks with TOML registrations as tables"},
+	{"issue_links", EXTENSION_ISSUE_LINKS, "Link #123 and org/repo#45 to the issue tracker in HTML"},
+	{"emoji", EXTENSION_EMOJI, "Turn :warning: and other shortcodes into emoji in HTML"},
+	{"rfc_mentions", EXTENSION_RFC_MENTIONS, "Cite the RFC of a mention like RFC 2119 in the text, needs EXTENSION_CITATION"},
+}
+
+var htmlFlags = []ExtensionInfo{
+	{"skip_html", HTML_SKIP_HTML, "skip preformatted HTML blocks"},
+	{"skip_style", HTML_SKIP_STYLE, "skip embedded <style> elements"},
+	{"skip_images", HTML_SKIP_IMAGES, "skip embedded images"},
+	{"skip_links", HTML_SKIP_LINKS, "skip all links"},
+	{"safelink", HTML_SAFELINK, "only link to trusted protocols"},
+	{"nofollow_links", HTML_NOFOLLOW_LINKS, "only link with rel=\"nofollow\""},
+	{"href_target_blank", HTML_HREF_TARGET_BLANK, "add a blank target"},
+	{"omit_contents", HTML_OMIT_CONTENTS, "skip the main contents (for a standalone table of contents)"},
+	{"complete_page", HTML_COMPLETE_PAGE, "generate a complete HTML page"},
+	{"use_smartypants", HTML_USE_SMARTYPANTS, "enable smart punctuation substitutions"},
+	{"smartypants_fractions", HTML_SMARTYPANTS_FRACTIONS, "enable smart fractions (with HTML_USE_SMARTYPANTS)"},
+	{"smartypants_dashes", HTML_SMARTYPANTS_DASHES, "enable smart dashes (with HTML_USE_SMARTYPANTS)"},
+	{"smartypants_latex_dashes", HTML_SMARTYPANTS_LATEX_DASHES, "enable LaTeX-style dashes (with HTML_USE_SMARTYPANTS and HTML_SMARTYPANTS_DASHES)"},
+	{"smartypants_angled_quotes", HTML_SMARTYPANTS_ANGLED_QUOTES, "enable angled double quotes (with HTML_USE_SMARTYPANTS) for double quotes rendering"},
+	{"footnote_return_links", HTML_FOOTNOTE_RETURN_LINKS, "generate a link at the end of a footnote to return to the source"},
+	{"paragraph_numbers", HTML_PARAGRAPH_NUMBERS, "give top level paragraphs the ids the pn attributes of XML_PARAGRAPH_NUMBERS have"},
+	{"escape_html", HTML_ESCAPE_HTML, "output inline HTML as text"},
+	{"caption_numbers", HTML_CAPTION_NUMBERS, "prefix figure and table captions with \"Figure N:\" and \"Table N:\""},
+	{"list_of_figures", HTML_LIST_OF_FIGURES, "add a List of Figures and a List of Tables at the end of the document"},
+}
+
+var xmlFlags = []ExtensionInfo{
+	{"standalone", XML_STANDALONE, "create standalone document"},
+	{"paragraph_numbers", XML_PARAGRAPH_NUMBERS, "add pn attributes to top level paragraphs"},
+	{"skip_html", XML_SKIP_HTML, "skip inline HTML"},
+	{"escape_html", XML_ESCAPE_HTML, "output inline HTML as text"},
+}
+
+var xml2Flags = []ExtensionInfo{
+	{"standalone", XML2_STANDALONE, "create standalone document"},
+	{"skip_html", XML2_SKIP_HTML, "skip inline HTML"},
+	{"escape_html", XML2_ESCAPE_HTML, "output inline HTML as text"},
+	{"transliterate", XML2_TRANSLITERATE, "replace non-ASCII characters, see Transliterations"},
+}
+
+// Extensions returns the extensions in the order of their values.
+func Extensions() []ExtensionInfo { return append([]ExtensionInfo{}, extensionFlags...) }
+
+// HtmlFlags returns the flags of the Html renderer.
+func HtmlFlags() []ExtensionInfo { return append([]ExtensionInfo{}, htmlFlags...) }
+
+// XmlFlags returns the flags of the XML2RFC v3 renderer.
+func XmlFlags() []ExtensionInfo { return append([]ExtensionInfo{}, xmlFlags...) }
+
+// Xml2Flags returns the flags of the XML2RFC v2 renderer.
+func Xml2Flags() []ExtensionInfo { return append([]ExtensionInfo{}, xml2Flags...) }
+
+// flagString returns the names of the flags in info that are set in flags, separated by commas.
+func flagString(info []ExtensionInfo, flags int) string {
+	names := []string{}
+	for _, e := range info {
+		if flags&e.Flag != 0 {
+			names = append(names, e.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseExtensions parses a comma separated list of extension names, for instance
+// "tables,fenced_code,citation", into extensions that can be given to Parse. Names
+// are case insensitive and may have the EXTENSION_ prefix. Unknown names are an
+// error, that suggests the closest known name.
+func ParseExtensions(s string) (int, error) { return parseFlags(extensionFlags, "extension", s) }
+
+// ParseHtmlFlags is ParseExtensions for the flags of HtmlRenderer.
+func ParseHtmlFlags(s string) (int, error) { return parseFlags(htmlFlags, "html", s) }
+
+// ParseXmlFlags is ParseExtensions for the flags of XmlRenderer.
+func ParseXmlFlags(s string) (int, error) { return parseFlags(xmlFlags, "xml", s) }
+
+// ParseXml2Flags is ParseExtensions for the flags of Xml2Renderer.
+func ParseXml2Flags(s string) (int, error) { return parseFlags(xml2Flags, "xml2", s) }
+
+func parseFlags(info []ExtensionInfo, kind, s string) (int, error) {
+	prefix := strings.ToLower(kind) + "_"
+	flags := 0
+	unknown := []string{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), prefix)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, e := range info {
+			if e.Name == name {
+				flags |= e.Flag
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		if suggestion := closestName(info, name); suggestion != "" {
+			name += " (did you mean " + suggestion + "?)"
+		}
+		unknown = append(unknown, name)
+	}
+	if len(unknown) > 0 {
+		return flags, fmt.Errorf("unknown %s flags: %s", kind, strings.Join(unknown, ", "))
+	}
+	return flags, nil
+}
+
+// closestName returns the name in info that is the fewest edits away from name,
+// or the empty string if none is close.
+func closestName(info []ExtensionInfo, name string) string {
+	best, closest := len(name)/2+1, ""
+	for _, e := range info {
+		if d := editDistance(name, e.Name); d < best {
+			best, closest = d, e.Name
+		}
+	}
+	return closest
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,47 @@
+package mmark
+
+import "testing"
+
+func TestExtensions(t *testing.T) {
+	for _, info := range [][]ExtensionInfo{Extensions(), HtmlFlags(), XmlFlags(), Xml2Flags()} {
+		names := map[string]bool{}
+		all := 0
+		for _, e := range info {
+			if names[e.Name] {
+				t.Errorf("duplicate name %s", e.Name)
+			}
+			names[e.Name] = true
+			if all&e.Flag != 0 {
+				t.Errorf("%s: flag %d used twice", e.Name, e.Flag)
+			}
+			all |= e.Flag
+		}
+		// the flags are 1 << iota (the extensions start at 2), so no bits should be missing
+		if all |= 1; all&(all+1) != 0 {
+			t.Errorf("missing flags in %v", info)
+		}
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	ext, err := ParseExtensions("tables, FENCED_CODE,extension_citation,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := EXTENSION_TABLES | EXTENSION_FENCED_CODE | EXTENSION_CITATION; ext != expected {
+		t.Errorf("expected %d, got %d", expected, ext)
+	}
+
+	_, err = ParseExtensions("tables,citations,frobnicate")
+	if expected := "unknown extension flags: citations (did you mean citation?), frobnicate"; err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+
+	flags, err := ParseHtmlFlags("complete_page,html_use_smartypants")
+	if err != nil || flags != HTML_COMPLETE_PAGE|HTML_USE_SMARTYPANTS {
+		t.Errorf("expected complete_page and use_smartypants, got %d, %v", flags, err)
+	}
+	if _, err := ParseXml2Flags("standalone,transliterate"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+// Blocks for one output format only, marked with an IAL: {format="html"}.
+
+package mmark
+
+import (
+	"bytes"
+	"strings"
+)
+
+// formats are the values of the format attribute, none skips the block everywhere.
+var formats = map[string]bool{"html": true, "xml": true, "xml2": true, "slides": true, "reflow": true, "none": true}
+
+// formatBlock handles the block after an IAL with format="html" (or a comma separated
+// list of formats): the content of the block is copied to the output as is when
+// rendering one of those formats and is skipped otherwise. The content of a fenced
+// code block is the code, of other blocks the text up to the next empty line.
+// When the renderer skips or escapes raw HTML, the content is skipped or escaped.
+func (p *parser) formatBlock(out *bytes.Buffer, data []byte) int {
+	format := p.ial.Value("format")
+	p.ial = nil
+
+	i := 0
+	for i < len(data) {
+		n := p.isEmpty(data[i:])
+		if n == 0 {
+			break
+		}
+		i += n
+	}
+	raw, end := p.rawBlock(data[i:])
+
+	match := false
+	backend := backendName(p.r)
+	for _, f := range strings.Split(format, ",") {
+		f = strings.TrimSpace(f)
+		if !formats[f] {
+			warnf(p, "unknown format %q, use html, xml, xml2, slides, reflow or none", f)
+			continue
+		}
+		if f == backend || (f == "html" && backend == "slides") {
+			match = true
+		}
+	}
+	if !match {
+		return i + end
+	}
+	skip, escape := rawPolicy(p.r)
+	switch {
+	case skip:
+	case escape:
+		attrEscape(out, raw)
+	default:
+		out.Write(raw)
+	}
+	return i + end
+}
+
+// rawHTMLRenderer is implemented by renderers that can skip or escape raw HTML.
+type rawHTMLRenderer interface {
+	RawHTML() (skip, escape bool)
+}
+
+// rawPolicy returns if the renderer r skips or escapes raw HTML, which it then also
+// does for the content of a format block.
+func rawPolicy(r Renderer) (skip, escape bool) {
+	for ; r != nil; r = wrapped(r) {
+		if h, ok := r.(rawHTMLRenderer); ok {
+			return h.RawHTML()
+		}
+	}
+	return false, false
+}
+
+// rawBlock returns the content of the block at the start of data and its length.
+func (p *parser) rawBlock(data []byte) (raw []byte, end int) {
+	beg, marker := p.isFencedCode(data, nil, "")
+	if beg > 0 && p.flags&EXTENSION_FENCED_CODE != 0 {
+		for end = beg; end < len(data); {
+			if fence, _ := p.isFencedCode(data[end:], nil, marker); fence > 0 {
+				return data[beg:end], end + fence
+			}
+			for end < len(data) && data[end] != '\n' {
+				end++
+			}
+			end++
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+		return data[beg:end], end
+	}
+	for end < len(data) {
+		if n := p.isEmpty(data[end:]); n > 0 {
+			return data[:end], end + n
+		}
+		for end < len(data) && data[end] != '\n' {
+			end++
+		}
+		end++
+	}
+	if end > len(data) {
+		end = len(data)
+	}
+	return data[:end], end
+}
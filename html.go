@@ -6,6 +6,7 @@ import (
 	"bytes"
 	xmllib "encoding/xml"
 	"fmt"
+	htmllib "html"
 	"io/ioutil"
 	"sort"
 	"strconv"
@@ -29,6 +30,10 @@ const (
 	HTML_SMARTYPANTS_LATEX_DASHES              // enable LaTeX-style dashes (with HTML_USE_SMARTYPANTS and HTML_SMARTYPANTS_DASHES)
 	HTML_SMARTYPANTS_ANGLED_QUOTES             // enable angled double quotes (with HTML_USE_SMARTYPANTS) for double quotes rendering
 	HTML_FOOTNOTE_RETURN_LINKS                 // generate a link at the end of a footnote to return to the source
+	HTML_PARAGRAPH_NUMBERS                     // give top level paragraphs the ids the pn attributes of XML_PARAGRAPH_NUMBERS have
+	HTML_ESCAPE_HTML                           // output inline HTML as text
+	HTML_CAPTION_NUMBERS                       // prefix figure and table captions with "Figure N:" and "Table N:"
+	HTML_LIST_OF_FIGURES                       // add a List of Figures and a List of Tables at the end of the document
 )
 
 var (
@@ -48,6 +53,10 @@ type HtmlRendererParameters struct {
 	// HTML_FOOTNOTE_RETURN_LINKS flag is enabled. If blank, the string
 	// <sup>[return]</sup> is used.
 	FootnoteReturnLinkContents string
+	// Hide email addresses in autolinks from scrapers: "entities" writes the mailto link
+	// with every character as an entity, "munge" writes the address as text, as in
+	// "alice [at] example [dot] org", and "text" writes it as text without a link.
+	EmailObfuscation string
 }
 
 // Html is a type that implements the Renderer interface for HTML output.
@@ -63,7 +72,7 @@ type html struct {
 	ial *inlineAttr
 
 	// titleBlock in TOML
-	titleBlock *title
+	titleBlock *TitleBlock
 
 	parameters HtmlRendererParameters
 
@@ -73,21 +82,40 @@ type html struct {
 	toc          *bytes.Buffer
 
 	appendix bool
+	pn       paragraphNumbers
 
-	// index, map idx to id
-	index      map[idx][]string
+	// index, map idx to its references
+	index      map[idx][]indexRef
 	indexCount int
 
 	// (@good) example list group counter
 	group map[string]int
 
+	// captioned figures and tables, for numbering and listing them
+	figures []captioned
+	tables  []captioned
+
 	smartypants *smartypantsRenderer
+
+	p *parser // for reporting diagnostics
 }
 
 type idx struct {
 	primary, secondary string
 }
 
+// indexRef is a reference to a place in the text from the index.
+type indexRef struct {
+	id      string
+	primary bool // (((!item))), the main place of the item
+	end     bool // ends the range the previous reference starts
+}
+
+type captioned struct {
+	id      string
+	caption []byte
+}
+
 const htmlClose = ">"
 
 // HtmlRenderer creates and configures an Html object, which
@@ -118,7 +146,7 @@ func HtmlRendererWithParameters(flags int, css, head string, renderParameters Ht
 		currentLevel: 0,
 		toc:          new(bytes.Buffer),
 
-		index: make(map[idx][]string),
+		index: make(map[idx][]indexRef),
 		group: make(map[string]int),
 
 		smartypants: smartypants(flags),
@@ -202,11 +230,13 @@ func entityEscapeWithSkip(out *bytes.Buffer, src []byte, skipRanges [][]int) {
 	attrEscape(out, src[end:])
 }
 
+func (options *html) setParser(p *parser) { options.p = p }
+
 func (options *html) Flags() int {
 	return options.flags
 }
 
-func (options *html) TitleBlockTOML(out *bytes.Buffer, block *title) {
+func (options *html) TitleBlockTOML(out *bytes.Buffer, block *TitleBlock) {
 	if options.flags&HTML_COMPLETE_PAGE == 0 { // use STANDALONE
 		return
 	}
@@ -221,7 +251,7 @@ func (options *html) TitleBlockTOML(out *bytes.Buffer, block *title) {
 	out.WriteString("\"")
 	out.WriteString(ending)
 	out.WriteString(">\n")
-	out.WriteString("  <meta charset=\"utf-8\"")
+	out.WriteString("  <meta charset=\"" + strings.ToLower(block.Coding) + "\"")
 	out.WriteString(ending)
 	out.WriteString(">\n")
 	if options.css != "" {
@@ -234,16 +264,64 @@ func (options *html) TitleBlockTOML(out *bytes.Buffer, block *title) {
 	if options.head != "" {
 		headBytes, err := ioutil.ReadFile(options.head)
 		if err != nil {
-			printf(nil, "failed: `%s': %s", options.head, err)
+			errorf(options.p, "failed: `%s': %s", options.head, err)
 		} else {
 			out.Write(headBytes)
 		}
 
 	}
 	out.WriteString("</head>\n")
-	out.WriteString("<body>\n")
+	out.WriteString("<body")
+	if block.Language != "" {
+		out.WriteString(" lang=\"" + escapeString(block.Language) + "\"")
+	}
+	if dir := block.Direction(); dir != "ltr" {
+		out.WriteString(" dir=\"" + escapeString(dir) + "\"")
+	}
+	out.WriteString(">\n")
 
 	// Write some elements of the TOML block in the doc as well.
+	out.WriteString("<h1 class=\"title\">")
+	options.NormalText(out, []byte(block.Title))
+	out.WriteString("</h1>\n")
+	if block.DocName != "" {
+		out.WriteString("<p class=\"docname\">")
+		options.NormalText(out, []byte(block.DocName))
+		out.WriteString("</p>\n")
+	}
+	for _, a := range block.Author {
+		out.WriteString("<p class=\"author\">")
+		options.NormalText(out, []byte(a.Fullname))
+		for _, o := range a.organizations() {
+			out.WriteString(", ")
+			options.NormalText(out, []byte(o.Organization))
+			if o.Abbrev != "" {
+				out.WriteString(" (")
+				options.NormalText(out, []byte(o.Abbrev))
+				out.WriteString(")")
+			}
+		}
+		out.WriteString("</p>\n")
+	}
+	if block.Number > 0 { // an RFC, not a draft
+		return
+	}
+	status, copyright := boilerplate(block)
+	options.boilerplate(out, "status-of-memo", "Status of This Memo", status)
+	options.boilerplate(out, "copyright", "Copyright Notice", copyright)
+}
+
+// boilerplate writes a section with the paragraphs of an Internet-Draft's boilerplate.
+func (options *html) boilerplate(out *bytes.Buffer, id, header string, paras []string) {
+	if len(paras) == 0 {
+		return
+	}
+	out.WriteString("\n<h2 id=\"" + id + "\">" + header + "</h2>\n")
+	for _, p := range paras {
+		out.WriteString("<p>")
+		options.NormalText(out, []byte(p))
+		out.WriteString("</p>\n")
+	}
 }
 
 func (options *html) Part(out *bytes.Buffer, text func() bool, id string) {
@@ -258,6 +336,7 @@ func (options *html) Part(out *bytes.Buffer, text func() bool, id string) {
 
 func (options *html) Note(out *bytes.Buffer, text func() bool, id string) {
 	options.Attr() //reset the IAL
+	options.pn.specialSection("note")
 	if id != "" {
 		out.WriteString(fmt.Sprintf("<h1 class=\"note\" id=\"%s\">", id))
 	} else {
@@ -269,6 +348,7 @@ func (options *html) Note(out *bytes.Buffer, text func() bool, id string) {
 
 func (options *html) SpecialHeader(out *bytes.Buffer, what []byte, text func() bool, id string) {
 	options.Attr() //reset the IAL
+	options.pn.specialSection(string(what))
 	if id != "" {
 		out.WriteString(fmt.Sprintf("<h1 class=\""+string(what)+"\" id=\"%s\">", id))
 	} else {
@@ -287,11 +367,17 @@ func (options *html) Header(out *bytes.Buffer, text func() bool, level int, id s
 	if options.appendix {
 		ial.GetOrDefaultClass("appendix")
 	}
+	options.pn.header(level)
 
+	aliases := aliasList(ial)
 	out.WriteString(fmt.Sprintf("<h%d%s>", level, options.AttrString(ial)))
+	for _, a := range aliases {
+		out.WriteString("<a id=\"" + escapeString(a) + "\"></a>")
+	}
 
 	if !text() {
 		out.Truncate(marker)
+		truncated(options.p, "Header")
 		return
 	}
 	// special section closing etc. etc. TODO(miek)
@@ -343,17 +429,21 @@ func (options *html) CalloutText(out *bytes.Buffer, id string, ids []string) {
 	}
 }
 
-func (options *html) BlockCode(out *bytes.Buffer, text []byte, lang string, caption []byte, subfigure, callout bool) {
+func (options *html) BlockCode(out *bytes.Buffer, text []byte, info CodeInfo, caption []byte, subfigure, callout bool) {
 	doubleSpace(out)
 	ial := options.Attr()
+	lang := info.Lang
 
 	prefix := ial.Value("prefix")
 	ial.DropAttr("prefix") // it's a fake attribute, so drop it, works on text bytes
 
-	s := options.AttrString(ial)
-
 	text = blockCodePrefix(prefix, text)
 
+	if len(caption) > 0 && !subfigure {
+		caption = options.numberCaption(ial, "Figure", caption)
+	}
+	s := options.AttrString(ial)
+
 	// if there is a caption we wrap the thing in the figure
 	if len(caption) > 0 {
 		if subfigure {
@@ -374,7 +464,21 @@ func (options *html) BlockCode(out *bytes.Buffer, text []byte, lang string, capt
 		lang = " class=\"language-" + langOut.String() + "\""
 	}
 
-	out.WriteString("<pre><code" + lang + ">")
+	if info.Title != "" {
+		out.WriteString("<div class=\"code-title\">")
+		attrEscape(out, []byte(info.Title))
+		out.WriteString("</div>\n")
+	}
+	// These are the attributes Prism's line-highlight and line-numbers plugins use.
+	pre := ""
+	if info.Highlight != "" {
+		pre += " data-line=\"" + escapeString(info.Highlight) + "\""
+	}
+	if start := strings.SplitN(info.Lines, "-", 2)[0]; start != "" {
+		pre += " data-start=\"" + escapeString(start) + "\""
+	}
+
+	out.WriteString("<pre" + pre + "><code" + lang + ">")
 
 	if callout {
 		attrEscapeInCode(options, out, text)
@@ -424,6 +528,9 @@ func (options *html) Aside(out *bytes.Buffer, text []byte) {
 
 func (options *html) Table(out *bytes.Buffer, header []byte, body []byte, footer []byte, columnData []int, caption []byte) {
 	ial := options.Attr()
+	if len(caption) > 0 {
+		caption = options.numberCaption(ial, "Table", caption)
+	}
 
 	doubleSpace(out)
 	out.WriteString("<table" + options.AttrString(ial) + ">\n")
@@ -499,7 +606,7 @@ func (options *html) TableCell(out *bytes.Buffer, text []byte, align, colspan in
 }
 
 func (options *html) Footnotes(out *bytes.Buffer, text func() bool) {
-	if options.flags&HTML_COMPLETE_PAGE != 0 {
+	if options.flags&HTML_COMPLETE_PAGE != 0 && !FootnotesPerSection {
 		options.ial = &inlineAttr{class: map[string]bool{"footnotes": true}}
 		options.Header(out, func() bool { out.WriteString("Footnotes"); return true }, 1, "footnotes")
 	}
@@ -574,6 +681,7 @@ func (options *html) List(out *bytes.Buffer, text func() bool, flags, start int,
 	}
 	if !text() {
 		out.Truncate(marker)
+		truncated(options.p, "List")
 		return
 	}
 	switch {
@@ -625,9 +733,23 @@ func (options *html) Paragraph(out *bytes.Buffer, text func() bool, flags int) {
 	marker := out.Len()
 	doubleSpace(out)
 
-	out.WriteString("<p>")
+	// Paragraphs only take the direction and language from their IAL.
+	s := ""
+	if options.ial != nil {
+		for _, k := range []string{"dir", "lang"} {
+			if v := options.ial.Value(k); v != "" {
+				s += " " + k + "=\"" + escapeString(v) + "\""
+			}
+		}
+	}
+	if options.flags&HTML_PARAGRAPH_NUMBERS != 0 && options.p != nil && options.p.nesting == 1 {
+		out.WriteString("<p id=\"" + options.pn.next() + "\"" + s + ">")
+	} else {
+		out.WriteString("<p" + s + ">")
+	}
 	if !text() {
 		out.Truncate(marker)
+		truncated(options.p, "Paragraph")
 		return
 	}
 	out.WriteString("</p>\n")
@@ -659,6 +781,11 @@ func (options *html) AutoLink(out *bytes.Buffer, link []byte, kind int) {
 		return
 	}
 
+	if kind == _LINK_TYPE_EMAIL && options.parameters.EmailObfuscation != "" {
+		options.email(out, link)
+		return
+	}
+
 	out.WriteString("<a href=\"")
 	if kind == _LINK_TYPE_EMAIL {
 		out.WriteString("mailto:")
@@ -693,10 +820,49 @@ func (options *html) AutoLink(out *bytes.Buffer, link []byte, kind int) {
 	out.WriteString("</a>")
 }
 
+// email writes the email address link obfuscated as the EmailObfuscation parameter says.
+func (options *html) email(out *bytes.Buffer, link []byte) {
+	address := bytes.TrimPrefix(bytes.TrimPrefix(link, []byte("mailto:")), []byte("//"))
+	switch options.parameters.EmailObfuscation {
+	case "entities":
+		out.WriteString("<a href=\"")
+		entityEncode(out, append([]byte("mailto:"), address...))
+		out.WriteString("\">")
+		entityEncode(out, address)
+		out.WriteString("</a>")
+	case "munge":
+		munged := strings.NewReplacer("@", " [at] ", ".", " [dot] ").Replace(string(address))
+		attrEscape(out, []byte(munged))
+	default: // text
+		attrEscape(out, address)
+	}
+}
+
+// entityEncode writes every character of text as a numeric character reference.
+func entityEncode(out *bytes.Buffer, text []byte) {
+	for _, r := range string(text) {
+		out.WriteString("&#" + strconv.Itoa(int(r)) + ";")
+	}
+}
+
 func (options *html) CodeSpan(out *bytes.Buffer, text []byte) {
-	out.WriteString("<code>")
+	// The classes are the language, for highlighting, unless it's a role.
+	ial := options.Attr()
+	role := codeRole(ial)
+	for _, c := range ial.SortClasses() {
+		delete(ial.class, c)
+		ial.class["language-"+c] = true
+	}
+	tag := "code"
+	switch role {
+	case roleKbd, roleSamp:
+		tag = role
+	case rolePath:
+		ial.class[rolePath] = true
+	}
+	out.WriteString("<" + tag + options.AttrString(ial) + ">")
 	attrEscape(out, text)
-	out.WriteString("</code>")
+	out.WriteString("</" + tag + ">")
 }
 
 func (options *html) DoubleEmphasis(out *bytes.Buffer, text []byte) {
@@ -738,6 +904,7 @@ func (options *html) maybeWriteAbsolutePrefix(out *bytes.Buffer, link []byte) {
 
 func (options *html) Figure(out *bytes.Buffer, text []byte, caption []byte) {
 	ial := options.Attr()
+	caption = options.numberCaption(ial, "Figure", caption)
 	s := options.AttrString(ial)
 	out.WriteString("<figure role=\"group\"" + s + ">\n")
 	out.WriteString("<figcaption>")
@@ -848,6 +1015,10 @@ func (options *html) RawHtmlTag(out *bytes.Buffer, text []byte) {
 	if options.flags&HTML_SKIP_IMAGES != 0 && isHtmlTag(text, "img") {
 		return
 	}
+	if options.flags&HTML_ESCAPE_HTML != 0 {
+		attrEscape(out, text)
+		return
+	}
 	out.Write(text)
 }
 
@@ -863,6 +1034,46 @@ func (options *html) StrikeThrough(out *bytes.Buffer, text []byte) {
 	out.WriteString("</del>")
 }
 
+// CitationSeparator separates the citations of a combined citation with a comma.
+func (options *html) CitationSeparator() string { return ", " }
+
+func (options *html) Emoji(out *bytes.Buffer, emoji string) { out.WriteString(emoji) }
+
+// RawHTML returns if raw HTML is skipped or escaped.
+func (options *html) RawHTML() (skip, escape bool) {
+	return options.flags&HTML_SKIP_HTML != 0, options.flags&HTML_ESCAPE_HTML != 0
+}
+
+// Capabilities returns what HTML can output, everything.
+func (options *html) Capabilities() int { return capabilityAll }
+
+// LinksIssues tells issue references, like #123, are linked to the issue tracker.
+func (options *html) LinksIssues() bool { return true }
+
+func (options *html) Insertion(out *bytes.Buffer, text []byte) {
+	out.WriteString("<ins>")
+	out.Write(text)
+	out.WriteString("</ins>")
+}
+
+func (options *html) Deletion(out *bytes.Buffer, text []byte) {
+	out.WriteString("<del>")
+	out.Write(text)
+	out.WriteString("</del>")
+}
+
+func (options *html) CriticComment(out *bytes.Buffer, text []byte) {
+	out.WriteString("<span class=\"critic comment\">")
+	out.Write(text)
+	out.WriteString("</span>")
+}
+
+func (options *html) Highlight(out *bytes.Buffer, text []byte) {
+	out.WriteString("<mark>")
+	out.Write(text)
+	out.WriteString("</mark>")
+}
+
 func (options *html) FootnoteRef(out *bytes.Buffer, ref []byte, id int) {
 	slug := slugify(ref)
 	out.WriteString(`<sup class="footnote-ref" id="`)
@@ -879,24 +1090,55 @@ func (options *html) FootnoteRef(out *bytes.Buffer, ref []byte, id int) {
 }
 
 func (options *html) Index(out *bytes.Buffer, primary, secondary []byte, prim bool) {
+	options.IndexRange(out, primary, secondary, prim, INDEX_POINT)
+}
+
+// IndexRange renders an index entry that is a point or the start or end of a
+// range, the index shows the range with a dash.
+func (options *html) IndexRange(out *bytes.Buffer, primary, secondary []byte, prim bool, span int) {
 	idx := idx{string(primary), string(secondary)}
-	id := ""
-	if ids, ok := options.index[idx]; ok {
-		// write id out and add it to the list
-		id = fmt.Sprintf("#idxref:%d-%d", options.indexCount, len(ids))
-		options.index[idx] = append(options.index[idx], id)
-	} else {
-		id = fmt.Sprintf("#idxref:%d-0", options.indexCount)
-		options.index[idx] = []string{id}
-	}
+	id := fmt.Sprintf("#idxref:%d-%d", options.indexCount, len(options.index[idx]))
+	options.index[idx] = append(options.index[idx], indexRef{id, prim, span == INDEX_RANGE_END})
 	out.WriteString("<span class=\"index-ref\" id=\"" + id[1:] + "\"></span>")
 
 	options.indexCount++
 }
 
-func (options *html) Entity(out *bytes.Buffer, entity []byte) { out.Write(entity) }
+// indexRefs writes the numbered references to refs, with a dash between the start
+// and end of a range and the primary ones in bold.
+func indexRefs(out *bytes.Buffer, refs []indexRef) {
+	for i, r := range refs {
+		if i > 0 {
+			if r.end {
+				out.WriteString("&ndash;")
+			} else {
+				out.WriteByte(',')
+			}
+		}
+		ref := "<a class=\"index-ref-ref\" href=\"" + r.id + "\">" + strconv.Itoa(i+1) + "</a>"
+		if r.primary {
+			ref = "<strong>" + ref + "</strong>"
+		}
+		out.WriteString(ref)
+	}
+}
+
+func (options *html) Entity(out *bytes.Buffer, entity []byte) {
+	if len(entity) == 0 || entity[0] != '&' { // decoded numeric entity
+		attrEscape(out, entity)
+		return
+	}
+	if htmllib.UnescapeString(string(entity)) == string(entity) {
+		warnf(options.p, "entity not defined: %s", entity)
+	}
+	out.Write(entity)
+}
 
 func (options *html) Citation(out *bytes.Buffer, link, title []byte) {
+	if part, ok := citationSection(title); ok {
+		out.WriteString(part.around("[<a class=\"cite\" href=\"#" + strings.ToLower(string(link)) + "\">" + string(link) + "</a>]"))
+		return
+	}
 	out.WriteString("<a class=\"cite\" href=\"#")
 	out.Write(bytes.ToLower(link))
 	out.WriteString("\">")
@@ -958,7 +1200,7 @@ func (options *html) References(out *bytes.Buffer, citations map[string]*citatio
 		if len(cite.xml) > 0 {
 			var ref refXML
 			if e := xmllib.Unmarshal(cite.xml, &ref); e != nil {
-				printf(nil, "failed to unmarshal reference: `%s': %s", anchor, e)
+				warnf(options.p, "failed to unmarshal reference: `%s': %s", anchor, e)
 				continue
 			}
 			out.WriteString("<li class=\"bibliography\" id=\"" + ref.Anchor + "\">\n")
@@ -1025,6 +1267,9 @@ func (options *html) DocumentFooter(out *bytes.Buffer, first bool) {
 	if !first {
 		return
 	}
+	options.listOf(out, "Figure", options.figures)
+	options.listOf(out, "Table", options.tables)
+
 	idx := make(map[string]*bytes.Buffer)
 	idxSlice := []string{}
 	if len(options.index) > 0 {
@@ -1044,24 +1289,14 @@ func (options *html) DocumentFooter(out *bytes.Buffer, first bool) {
 				// if k.secondary is empty we should write the pointers here, because they are meant for
 				// the primary
 				buf.WriteString("<span class=\"index-ref-space\"> </span>")
-				for i, r := range v {
-					buf.WriteString("<a class=\"index-ref-ref\" href=\"" + r + "\">" + strconv.Itoa(i+1) + "</a>")
-					if i+1 < len(v) {
-						buf.WriteByte(',')
-					}
-				}
+				indexRefs(buf, v)
 				buf.WriteString("\n")
 				continue
 			}
 
 			buf.WriteString("<span class=\"index-ref-secondary\">" + k.secondary + "</span>")
 			buf.WriteString("<span class=\"index-ref-space\"> </span>")
-			for i, r := range v {
-				buf.WriteString("<a class=\"index-ref-ref\" href=\"" + r + "\">" + strconv.Itoa(i+1) + "</a>")
-				if i+1 < len(v) {
-					buf.WriteByte(',')
-				}
-			}
+			indexRefs(buf, v)
 			buf.WriteString("\n")
 		}
 		sort.Strings(idxSlice)
@@ -1084,7 +1319,48 @@ func (options *html) DocumentFooter(out *bytes.Buffer, first bool) {
 	}
 }
 
+// numberCaption records the caption of a figure or table, kind is "Figure" or
+// "Table", and returns it with its number prefixed when HTML_CAPTION_NUMBERS is
+// set. The element gets the id figure-N or table-N when ial has no id.
+func (options *html) numberCaption(ial *inlineAttr, kind string, caption []byte) []byte {
+	if options.flags&(HTML_CAPTION_NUMBERS|HTML_LIST_OF_FIGURES) == 0 {
+		return caption
+	}
+	list := &options.figures
+	if kind == "Table" {
+		list = &options.tables
+	}
+	n := strconv.Itoa(len(*list) + 1)
+	if ial.GetOrDefaultId(strings.ToLower(kind) + "-" + n) {
+		options.p.captionAnchor(ial.id)
+	}
+	*list = append(*list, captioned{id: ial.id, caption: caption})
+	if options.flags&HTML_CAPTION_NUMBERS == 0 {
+		return caption
+	}
+	return append([]byte(kind+" "+n+": "), caption...)
+}
+
+// listOf writes the List of Figures or Tables, with links to them, when
+// HTML_LIST_OF_FIGURES is set.
+func (options *html) listOf(out *bytes.Buffer, kind string, list []captioned) {
+	if options.flags&HTML_LIST_OF_FIGURES == 0 || len(list) == 0 {
+		return
+	}
+	id := "list-of-" + strings.ToLower(kind) + "s"
+	options.ial = &inlineAttr{class: map[string]bool{id: true}}
+	options.Header(out, func() bool { out.WriteString("List of " + kind + "s"); return true }, 1, id)
+	out.WriteString("<ul class=\"" + id + "\">\n")
+	for i, c := range list {
+		out.WriteString("<li><a href=\"#" + c.id + "\">" + kind + " " + strconv.Itoa(i+1) + ": ")
+		out.Write(bytes.TrimSpace(sanitizeXML(append([]byte{}, c.caption...))))
+		out.WriteString("</a></li>\n")
+	}
+	out.WriteString("</ul>\n")
+}
+
 func (options *html) DocumentMatter(out *bytes.Buffer, matter int) {
+	options.pn.matter(matter)
 	if matter == _DOC_BACK_MATTER {
 		options.appendix = true
 	}
@@ -1183,6 +1459,27 @@ func (options *html) AttrString(i *inlineAttr) string {
 	return s
 }
 
+// escapeString returns s escaped for use in an attribute.
+func escapeString(s string) string {
+	buf := &bytes.Buffer{}
+	attrEscape(buf, []byte(s))
+	return buf.String()
+}
+
+// htmlTagName returns the lowercased name of tag and if it is a closing tag.
+func htmlTagName(tag []byte) (name string, closing bool) {
+	i := skipSpace(tag, 1)
+	if i < len(tag) && tag[i] == '/' {
+		closing = true
+		i++
+	}
+	j := i
+	for j < len(tag) && isalnum(tag[j]) {
+		j++
+	}
+	return strings.ToLower(string(tag[i:j])), closing
+}
+
 func isHtmlTag(tag []byte, tagname string) bool {
 	found, _ := findHtmlTagPos(tag, tagname)
 	return found
@@ -91,6 +91,43 @@ func (p *parser) isInlineAttr(data []byte) int {
 	return 0
 }
 
+// Roles of code spans, set with an IAL class: `Ctrl-C`{.kbd}.
+const (
+	roleKbd  = "kbd"  // keyboard input
+	roleSamp = "samp" // UI labels and program output
+	rolePath = "path" // file paths
+)
+
+// codeRole returns the role of a code span with IAL i and removes it from the classes.
+func codeRole(i *inlineAttr) string {
+	for _, r := range []string{roleKbd, roleSamp, rolePath} {
+		if i.class[r] {
+			delete(i.class, r)
+			return r
+		}
+	}
+	return ""
+}
+
+// textDirection moves the dir and lang attributes of i to a new IAL, for blocks
+// that otherwise don't use one, like paragraphs. It returns nil if i has neither.
+func textDirection(i *inlineAttr) *inlineAttr {
+	if i == nil {
+		return nil
+	}
+	var dir *inlineAttr
+	for _, k := range []string{"dir", "lang"} {
+		if v, ok := i.attr[k]; ok {
+			if dir == nil {
+				dir = newInlineAttr()
+			}
+			dir.attr[k] = v
+			delete(i.attr, k)
+		}
+	}
+	return dir
+}
+
 func parseKeyValue(chunk []byte) (string, string) {
 	chunks := bytes.SplitN(chunk, []byte{'='}, 2)
 	if len(chunks) != 2 {
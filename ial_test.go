@@ -1,6 +1,9 @@
 package mmark
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestIALSyntax(t *testing.T) {
 	tests := []string{
@@ -13,3 +16,42 @@ func TestIALSyntax(t *testing.T) {
 
 	doTestsBlock(t, tests, 0)
 }
+
+func TestIALFormat(t *testing.T) {
+	input := "Before\n\n{format=\"html\"}\n```\n<svg>html only</svg>\n```\n\n{format=\"xml, xml2\"}\n<artwork>xml only</artwork>\n\n{format=\"none\"}\nNowhere\n\nAfter\n"
+
+	output, diags := ParseDiagnostics([]byte(input), HtmlRenderer(0, "", ""), EXTENSION_FENCED_CODE)
+	if expected := "<p>Before</p>\n<svg>html only</svg>\n\n<p>After</p>\n"; output.String() != expected || len(diags) != 0 {
+		t.Errorf("expected %q, got %q, %v", expected, output, diags)
+	}
+
+	output = Parse([]byte(input), XmlRenderer(0), EXTENSION_FENCED_CODE)
+	if expected := "<t>\nBefore\n</t>\n<artwork>xml only</artwork>\n<t>\nAfter\n</t>\n"; output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+
+	html := "{format=\"html\"}\n<script>alert(1)</script>\n"
+	if output := Parse([]byte(html), HtmlRenderer(HTML_SKIP_HTML, "", ""), 0).String(); output != "" {
+		t.Errorf("expected the block to be skipped, got %q", output)
+	}
+	if output := Parse([]byte(html), HtmlRenderer(HTML_ESCAPE_HTML, "", ""), 0).String(); output != "&lt;script&gt;alert(1)&lt;/script&gt;\n" {
+		t.Errorf("expected the block to be escaped, got %q", output)
+	}
+	if output := Parse([]byte("{format=\"xml\"}\n<artwork/>\n"), XmlRenderer(XML_SKIP_HTML), 0).String(); output != "" {
+		t.Errorf("expected the block to be skipped, got %q", output)
+	}
+	if output := Parse([]byte(html), SlidesRenderer(SLIDES_SKIP_HTML, ""), 0).String(); strings.Contains(output, "script") {
+		t.Errorf("expected the block to be skipped in slides, got %q", output)
+	}
+	if output := Parse([]byte(html), SlidesRenderer(SLIDES_ESCAPE_HTML, ""), 0).String(); !strings.Contains(output, "&lt;script&gt;alert(1)&lt;/script&gt;\n") {
+		t.Errorf("expected the block to be escaped in slides, got %q", output)
+	}
+	if output := Parse([]byte(html), &review{Renderer: HtmlRenderer(HTML_SKIP_HTML, "", "")}, 0).String(); strings.Contains(output, "script") {
+		t.Errorf("expected the block to be skipped by a wrapped renderer, got %q", output)
+	}
+
+	_, diags = ParseDiagnostics([]byte("{format=\"pdf\"}\nText\n"), HtmlRenderer(0, "", ""), 0)
+	if len(diags) != 1 || diags[0].Message != "unknown format \"pdf\", use html, xml, xml2, slides, reflow or none" {
+		t.Errorf("expected an unknown format warning, got %v", diags)
+	}
+}
@@ -0,0 +1,77 @@
+// IANA registrations in a fenced code block with the language iana.
+
+package mmark
+
+import (
+	"bytes"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ianaRegistrations are the registrations in an iana code block, for instance:
+//
+//	[[registry]]
+//	name = "DNS Resource Record (RR) TYPEs"
+//	[[registry.entry]]
+//	value = "65"
+//	description = "HTTPS"
+//	reference = "[@RFC9460]"
+//
+// Every registry becomes a paragraph asking IANA to register the entries and a
+// table with their value, description and reference. The cells are parsed as
+// inline markdown, so the reference can be a citation.
+type ianaRegistrations struct {
+	Registry []struct {
+		Name  string
+		Entry []struct {
+			Value       string
+			Description string
+			Reference   string
+		}
+	}
+}
+
+var ianaColumns = []string{"Value", "Description", "Reference"}
+
+func (p *parser) iana(out *bytes.Buffer, data []byte) {
+	var regs ianaRegistrations
+	if _, err := toml.Decode(string(data), &regs); err != nil {
+		errorf(p, "error in IANA registrations: %s", err.Error())
+		return
+	}
+
+	for _, reg := range regs.Registry {
+		if reg.Name == "" {
+			warnf(p, "IANA registry without a name")
+		}
+		if len(reg.Entry) == 0 {
+			warnf(p, "IANA registry %q has no entries", reg.Name)
+			continue
+		}
+		p.r.SetAttr(nil)
+		p.r.Paragraph(out, func() bool {
+			p.inline(out, []byte("IANA is requested to register the following entries in the \""+reg.Name+"\" registry:"))
+			return true
+		}, 0)
+
+		var header, body, row bytes.Buffer
+		for _, c := range ianaColumns {
+			p.r.TableHeaderCell(&row, []byte(c), 0, 0)
+		}
+		p.r.TableRow(&header, row.Bytes())
+		for i, e := range reg.Entry {
+			if e.Value == "" || e.Reference == "" {
+				warnf(p, "IANA registry %q: entry %d needs a value and a reference", reg.Name, i+1)
+			}
+			row.Reset()
+			for _, text := range []string{e.Value, e.Description, e.Reference} {
+				var cell bytes.Buffer
+				p.inline(&cell, []byte(text))
+				p.r.TableCell(&row, cell.Bytes(), 0, 0)
+			}
+			p.r.TableRow(&body, row.Bytes())
+		}
+		p.r.SetAttr(nil)
+		p.r.Table(out, header.Bytes(), body.Bytes(), nil, make([]int, len(ianaColumns)), nil)
+	}
+}
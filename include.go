@@ -0,0 +1,126 @@
+// Finding included files.
+
+package mmark
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxIncludeDepth is how deep includes can be nested.
+const maxIncludeDepth = 8
+
+var (
+	// IncludePath lists the directories searched for an included file that is
+	// not found relative to the working directory, or to IncludeRoot.
+	IncludePath []string
+
+	// IncludeRoot, when set, sandboxes the includes: files are looked up relative
+	// to it and must stay below it. Absolute paths and paths escaping it with ..
+	// or a symbolic link are rejected. Use this for input you don't trust.
+	IncludeRoot string
+)
+
+// includeFile returns the file to read for an include of file, the first of
+// file and the directories of IncludePath joined with file that exists. When
+// none exist, file is returned and reading it gives the error.
+func includeFile(file string) (string, error) {
+	if IncludeRoot != "" && filepath.IsAbs(file) {
+		return "", fmt.Errorf("`%s': absolute include paths are not allowed", file)
+	}
+	candidates := []string{file}
+	if !filepath.IsAbs(file) {
+		for _, dir := range IncludePath {
+			candidates = append(candidates, filepath.Join(dir, file))
+		}
+	}
+	for i, c := range candidates {
+		if IncludeRoot != "" {
+			if err := inRoot(c); err != nil {
+				return "", fmt.Errorf("`%s': %s", file, err)
+			}
+			c = filepath.Join(IncludeRoot, c)
+			candidates[i] = c
+		}
+		if _, err := os.Stat(c); err == nil {
+			if IncludeRoot != "" {
+				if err := inRootLinks(c); err != nil {
+					return "", fmt.Errorf("`%s': %s", file, err)
+				}
+			}
+			return c, nil
+		}
+	}
+	return candidates[0], nil
+}
+
+// inRoot checks that the relative path file doesn't leave IncludeRoot.
+func inRoot(file string) error {
+	if filepath.IsAbs(file) {
+		return fmt.Errorf("include path is outside of %s", IncludeRoot)
+	}
+	clean := filepath.Clean(file)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("include path is outside of %s", IncludeRoot)
+	}
+	return nil
+}
+
+// inRootLinks checks that the existing file, with its symbolic links resolved,
+// is below IncludeRoot.
+func inRootLinks(file string) error {
+	root, err := filepath.EvalSymlinks(IncludeRoot)
+	if err != nil {
+		return err
+	}
+	target, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return err
+	}
+	return inRoot(rel)
+}
+
+// includeFrame is a file being included, name as written in the include and the
+// absolute path it was found at.
+type includeFrame struct {
+	name string
+	path string
+}
+
+// pushInclude adds file to the files being included. It reports an error and
+// returns false when file is already being included, or when the includes nest
+// deeper than maxIncludeDepth; the error shows the chain of includes.
+func (p *parser) pushInclude(file string) bool {
+	path, err := includeFile(file)
+	if err == nil {
+		path, err = filepath.Abs(path)
+	}
+	if err != nil {
+		path = file // reported when the file is read
+	}
+	chain := make([]string, 0, len(p.includes)+1)
+	for _, f := range p.includes {
+		chain = append(chain, f.name)
+	}
+	chain = append(chain, file)
+	for _, f := range p.includes {
+		if f.path == path {
+			errorf(p, "include cycle: %s", strings.Join(chain, " -> "))
+			return false
+		}
+	}
+	if len(p.includes) >= maxIncludeDepth {
+		errorf(p, "includes nested deeper than %d: %s", maxIncludeDepth, strings.Join(chain, " -> "))
+		return false
+	}
+	p.includes = append(p.includes, includeFrame{name: file, path: path})
+	return true
+}
+
+func (p *parser) popInclude() { p.includes = p.includes[:len(p.includes)-1] }
@@ -0,0 +1,70 @@
+package mmark
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncludeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "root"), 0755)
+	os.Mkdir(filepath.Join(dir, "root", "inc"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "root", "inc", "a.md"), []byte("Included.\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "secret.md"), []byte("Secret.\n"), 0644)
+	os.Symlink(filepath.Join(dir, "secret.md"), filepath.Join(dir, "root", "link.md"))
+
+	defer func() { IncludePath, IncludeRoot = nil, "" }()
+	IncludePath = []string{"inc"}
+	IncludeRoot = filepath.Join(dir, "root")
+
+	output, diags := ParseDiagnostics([]byte("{{a.md}}\n"), HtmlRenderer(0, "", ""), EXTENSION_INCLUDE)
+	if expected := "<p>Included.</p>"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+	if len(diags) != 0 {
+		t.Errorf("expected no diagnostics, got %v", diags)
+	}
+
+	for _, file := range []string{"../secret.md", filepath.Join(dir, "secret.md"), "link.md"} {
+		output, diags := ParseDiagnostics([]byte("{{"+file+"}}\n"), HtmlRenderer(0, "", ""), EXTENSION_INCLUDE)
+		if strings.Contains(output.String(), "Secret.") {
+			t.Errorf("expected %s not to be included, got %q", file, output)
+		}
+		if len(diags) != 1 || diags[0].Severity != SeverityError {
+			t.Errorf("expected an error for %s, got %v", file, diags)
+		}
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "a.md"), []byte("A.\n\n{{b.md}}\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.md"), []byte("B.\n\n{{a.md}}\n"), 0644)
+	for i := 0; i < 10; i++ {
+		ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.md", i)), []byte(fmt.Sprintf("{{%d.md}}\n", i+1)), 0644)
+	}
+
+	defer func() { IncludePath = nil }()
+	IncludePath = []string{dir}
+
+	_, diags := ParseDiagnostics([]byte("{{a.md}}\n"), HtmlRenderer(0, "", ""), EXTENSION_INCLUDE)
+	if len(diags) != 1 || diags[0].Message != "include cycle: a.md -> b.md -> a.md" {
+		t.Errorf("expected an include cycle, got %v", diags)
+	}
+	_, diags = ParseDiagnostics([]byte("{{0.md}}\n"), HtmlRenderer(0, "", ""), EXTENSION_INCLUDE)
+	if len(diags) != 1 || diags[0].Message != "includes nested deeper than 8: 0.md -> 1.md -> 2.md -> 3.md -> 4.md -> 5.md -> 6.md -> 7.md -> 8.md" {
+		t.Errorf("expected the include depth to be exceeded, got %v", diags)
+	}
+}
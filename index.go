@@ -0,0 +1,105 @@
+// Index entries: (((item, subitem))), primary ones and ranges.
+
+package mmark
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Index entries mark a single place or the start or end of a range of text:
+// (((item, subitem|start))) ... (((item, subitem|end))).
+const (
+	INDEX_POINT       = iota // a single place
+	INDEX_RANGE_START        // starts a range
+	INDEX_RANGE_END          // ends the range started by the same item
+)
+
+// indexRange is the item of a range in the index, for reporting.
+func indexRange(item, subitem []byte) string {
+	if len(subitem) == 0 {
+		return string(item)
+	}
+	return string(item) + ", " + string(subitem)
+}
+
+// indexEntry renders the index entry text, the part between ((( and ))). It starts
+// with ! when the entry is the primary place of the item and ends in |start or
+// |end when it starts or ends a range.
+func (p *parser) indexEntry(out *bytes.Buffer, text []byte) {
+	span := INDEX_POINT
+	if i := bytes.LastIndexByte(text, '|'); i >= 0 {
+		switch string(bytes.TrimSpace(text[i+1:])) {
+		case "start":
+			span = INDEX_RANGE_START
+			text = text[:i]
+		case "end":
+			span = INDEX_RANGE_END
+			text = text[:i]
+		}
+	}
+	prim := false
+	if len(text) > 0 && text[0] == '!' {
+		prim = true
+		text = text[1:]
+	}
+	item, subitem := text, []byte(nil)
+	if i := bytes.IndexByte(text, ','); i >= 0 {
+		item, subitem = text[:i], bytes.TrimSpace(text[i+1:])
+	}
+	item = bytes.TrimSpace(item)
+
+	if span == INDEX_POINT {
+		p.r.Index(out, item, subitem, prim)
+		return
+	}
+	p.indexRange(indexRange(item, subitem), span)
+	for r := p.r; r != nil; r = wrapped(r) {
+		if i, ok := r.(indexRanger); ok {
+			i.IndexRange(out, item, subitem, prim, span)
+			return
+		}
+	}
+	p.r.Index(out, item, subitem, prim)
+}
+
+// indexRanger is a renderer that marks where an index range starts and ends, the
+// others get a plain index entry for both.
+type indexRanger interface {
+	IndexRange(out *bytes.Buffer, primary, secondary []byte, prim bool, span int)
+}
+
+// indexRange records the start or end of the range of item, a range is ended
+// by the item it was started with.
+func (p *parser) indexRange(item string, span int) {
+	if p.indexRanges == nil {
+		p.indexRanges = map[string]int{}
+	}
+	_, open := p.indexRanges[item]
+	switch {
+	case span == INDEX_RANGE_START && open:
+		warnf(p, "index range of `%s' is started again before it ended", item)
+	case span == INDEX_RANGE_START:
+		p.indexRanges[item] = p.line
+	case !open:
+		warnf(p, "index range of `%s' ends, but was not started", item)
+	default:
+		delete(p.indexRanges, item)
+	}
+}
+
+// openIndexRanges reports the index ranges that are started, but never ended.
+func (p *parser) openIndexRanges() {
+	defer p.phaseEnd("validation", p.phaseStart())
+	line := p.line
+	defer func() { p.line = line }()
+	items := make([]string, 0, len(p.indexRanges))
+	for item := range p.indexRanges {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	for _, item := range items {
+		p.line = p.indexRanges[item]
+		warnf(p, "index range of `%s' is not ended, add (((%s|end)))", item, item)
+	}
+}
@@ -0,0 +1,58 @@
+package mmark
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIndexEntry(t *testing.T) {
+	input := "A (((Tiger))) b (((!Tiger , Cats ))) c (((Cats|start))).\n\nMore (((Cats|end))).\n"
+	output := Parse([]byte(input), Xml2Renderer(0), 0).String()
+	for _, expected := range []string{
+		"<iref item=\"Tiger\" subitem=\"\"/>",
+		"<iref item=\"Tiger\" primary=\"true\" subitem=\"Cats\"/>",
+		"c <iref item=\"Cats\" subitem=\"\"/>.",
+		"More <iref item=\"Cats\" subitem=\"\"/>.",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+
+	output = Parse([]byte(input), HtmlRenderer(0, "", ""), 0).String()
+	for _, expected := range []string{
+		"<a class=\"index-ref-ref\" href=\"#idxref:2-0\">1</a>&ndash;<a class=\"index-ref-ref\" href=\"#idxref:3-1\">2</a>\n",
+		"<span class=\"index-ref-secondary\">Cats</span><span class=\"index-ref-space\"> </span><strong><a class=\"index-ref-ref\" href=\"#idxref:1-0\">1</a></strong>\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+
+	// through a renderer that wraps the Html renderer
+	out, _ := ParseReview([]byte(input), HtmlRenderer(0, "", ""), 0)
+	if expected := "&ndash;"; !strings.Contains(out.String(), expected) {
+		t.Errorf("expected %q in %q", expected, out)
+	}
+}
+
+func TestIndexRanges(t *testing.T) {
+	input := "A (((Dog|end))) and (((Cat, Tabby|start))).\n\nB (((Cat, Tabby|start))).\n"
+	_, diags := ParseDiagnostics([]byte(input), Xml2Renderer(0), 0)
+	expected := []string{
+		"index range of `Dog' ends, but was not started",
+		"index range of `Cat, Tabby' is started again before it ended",
+		"index range of `Cat, Tabby' is not ended, add (((Cat, Tabby|end)))",
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("expected %d diagnostics, got %v", len(expected), diags)
+	}
+	for i := range expected {
+		if diags[i].Message != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], diags[i].Message)
+		}
+	}
+	if diags[2].Line != 1 {
+		t.Errorf("expected the open range on line 1, got %d", diags[2].Line)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"bytes"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -23,9 +25,18 @@ var (
 func (p *parser) inline(out *bytes.Buffer, data []byte) {
 	// this is called recursively: enforce a maximum depth
 	if p.nesting >= p.maxNesting {
+		p.nestingTooDeep()
+		p.r.NormalText(out, data)
 		return
 	}
 	p.nesting++
+	if p.phases != nil && !p.insideInline {
+		p.insideInline = true
+		defer func(start time.Time) {
+			p.insideInline = false
+			p.phaseEnd("inline", start)
+		}(time.Now())
+	}
 
 	i, end := 0, 0
 	for i < len(data) {
@@ -156,9 +167,23 @@ func codeSpan(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 		fEnd--
 	}
 
+	// an IAL directly after the span gives it a role, i.e. `SOMAXCONN`{.c}
+	var ial *inlineAttr
+	if end < len(data) && data[end] == '{' {
+		saved := p.ial
+		p.ial = nil
+		if j := p.isInlineAttr(data[end:]); j > 0 {
+			ial = p.ial
+			end += j
+		}
+		p.ial = saved
+	}
+
 	// render the code span
 	if fBegin != fEnd {
+		p.r.SetAttr(ial)
 		p.r.CodeSpan(out, data[fBegin:fEnd])
+		p.r.SetAttr(nil)
 	}
 
 	return end
@@ -328,6 +353,20 @@ func link(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 	// [@[!|?]draft#1 text]
 	// [-@RFC] : suppress output, but add to the citation list
 	if (t == linkCitation || data[1] == '@' || data[1] == '-') && p.flags&EXTENSION_CITATION != 0 {
+		if parts := combinedCitation(data[1:txtE]); parts != nil {
+			sep := citationSeparator(p)
+			n := out.Len()
+			for _, part := range parts {
+				var cite bytes.Buffer
+				p.inlineCallback['['](p, &cite, append(append([]byte{'['}, part...), ']'), 0)
+				if cite.Len() > 0 && out.Len() > n {
+					out.WriteString(sep)
+				}
+				out.Write(cite.Bytes())
+			}
+			return txtE + 1
+		}
+
 		var (
 			spaceB   int
 			id       []byte
@@ -348,6 +387,9 @@ func link(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 		} else if data[k] == '?' {
 			typ = 'i'
 			k++
+		} else if k+1 < txtE && data[k+1] == ':' && p.groups[string(data[k])] != "" {
+			typ = data[k] // [@u:anchor], cited in reference group u
+			k += 2
 		}
 
 		for j := k; j < txtE; j++ {
@@ -366,6 +408,7 @@ func link(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 		if id == nil {
 			id = data[k:txtE]
 		}
+		id = bytes.TrimSuffix(id, []byte(",")) // [@RFC7230, Section 3.2]
 		for j := 0; j < len(id); j++ {
 			if id[j] == '#' {
 				chunk := id[j:]
@@ -380,10 +423,44 @@ func link(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 			}
 
 		}
+		if j := bytes.IndexByte(id, '#'); j >= 0 {
+			// [@RFC7950#section-7.19], a part of the cited document
+			frag := id[j+1:]
+			id = id[:j]
+			part, ok := citationFragment(frag)
+			switch t := string(bytes.TrimSpace(title)); {
+			case !ok:
+				warnf(p, "can not cite `#%s' of %s, use #section-N or #appendix-N", frag, id)
+			case t == "":
+				title = part
+			case t == "of": // [@RFC7950#section-7.19 of]
+				title = []byte("of " + string(part))
+			case t == "()":
+				title = []byte("(" + string(part) + ")")
+			default:
+				warnf(p, "citation of `#%s' of %s also has a title, using the title", frag, id)
+			}
+		}
+		if seq == -1 {
+			id, seq = draftVersion(id)
+		}
+		id = p.canonicalAnchor(id)
 
-		if c, ok := p.citations[string(id)]; !ok {
-			p.citations[string(id)] = &citation{link: id, title: title, typ: typ, seq: seq}
+		if DebugLogger != nil {
+			kind := "informative"
+			if typ == 'n' {
+				kind = "normative"
+			}
+			trace(p, "citation", "anchor", string(id), "type", kind, "suppress", suppress, "seq", seq)
+		}
+		if a, ok := p.internal[strings.ToLower(string(id))]; ok {
+			id = []byte(a) // cited, but not a reference
+		} else if c, ok := p.citations[string(id)]; !ok {
+			p.citations[string(id)] = &citation{link: id, title: title, typ: typ, seq: seq, line: p.line}
 		} else {
+			if c.seq == -1 {
+				c.seq = seq
+			}
 			switch c.typ {
 			case 0:
 				c.typ = typ
@@ -677,6 +754,9 @@ func link(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 	// call the relevant rendering function
 	switch t {
 	case linkNormal:
+		if uLink[0] == '#' {
+			p.anchorReference(string(uLink[1:]))
+		}
 		p.r.Link(out, uLink, title, content.Bytes())
 
 	case linkImg:
@@ -699,10 +779,15 @@ func link(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 		if outSize > 0 && outBytes[outSize-1] == '^' {
 			out.Truncate(outSize - 1)
 		}
-		p.r.FootnoteRef(out, link, noteId)
+		if Capabilities(p.r)&CAPABILITY_FOOTNOTES == 0 {
+			p.notes = p.notes[:len(p.notes)-1]
+			p.inlineFootnote(out, title)
+			break
+		}
+		p.r.FootnoteRef(out, p.noteName(link), noteId)
 
 	case linkDeferredFootnote:
-		p.r.FootnoteRef(out, link, noteId)
+		p.r.FootnoteRef(out, p.noteName(link), noteId)
 
 	default:
 		return 0
@@ -711,6 +796,26 @@ func link(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 	return i
 }
 
+// FootnoteCref makes inline footnotes a cref in XML2RFC output, instead of text
+// between parentheses.
+var FootnoteCref = false
+
+// inlineFootnote renders the inline footnote text for a renderer without footnotes.
+func (p *parser) inlineFootnote(out *bytes.Buffer, text []byte) {
+	var work bytes.Buffer
+	p.inline(&work, text)
+	if r := p.criticRenderer(); FootnoteCref && r != nil {
+		r.CriticComment(out, work.Bytes())
+		return
+	}
+	if out.Len() > 0 && !isspace(out.Bytes()[out.Len()-1]) {
+		p.r.NormalText(out, []byte(" "))
+	}
+	p.r.NormalText(out, []byte("("))
+	out.Write(work.Bytes())
+	p.r.NormalText(out, []byte(")"))
+}
+
 func (p *parser) inlineHTMLComment(out *bytes.Buffer, data []byte) int {
 	if len(data) < 5 {
 		return 0
@@ -877,6 +982,9 @@ func leftBrace(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 	if j := p.isInlineAttr(data); j > 0 {
 		return j
 	}
+	if p.flags&(EXTENSION_CRITIC|EXTENSION_CRITIC_ACCEPT|EXTENSION_CRITIC_REJECT) != 0 {
+		return critic(p, out, data)
+	}
 	return 0
 }
 
@@ -887,6 +995,10 @@ func escape(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 	data = data[offset:]
 
 	if len(data) > 1 {
+		if data[1] == ' ' && len(data) > 2 && !isspace(data[2]) { // non-breaking space
+			p.r.Entity(out, []byte("&nbsp;"))
+			return 2
+		}
 		if bytes.IndexByte(escapeChars, data[1]) < 0 {
 			return 0
 		}
@@ -975,6 +1087,69 @@ func linkEndsWithEntity(data []byte, linkEnd int) bool {
 	return false
 }
 
+// IssueTracker and IssueRepo set where issue references link to: #123 links to
+// IssueTracker+IssueRepo+"/issues/123" and org/repo#45 to IssueTracker+"org/repo/issues/45".
+// Without IssueRepo only the second form is recognized.
+var (
+	IssueTracker = "https://github.com/"
+	IssueRepo    string
+)
+
+// issueLinker is a renderer that can link issue references, in the others they
+// stay text.
+type issueLinker interface {
+	LinksIssues() bool
+}
+
+// linksIssues returns true if the renderer, or the one it wraps, links issue references.
+func (p *parser) linksIssues() bool {
+	for r := p.r; r != nil; r = wrapped(r) {
+		if l, ok := r.(issueLinker); ok {
+			return l.LinksIssues()
+		}
+	}
+	return false
+}
+
+// '#' for issue references, only linked when the renderer does, i.e. in HTML output.
+func issueLink(p *parser, out *bytes.Buffer, data []byte, offset int) int {
+	if p.insideLink || !p.linksIssues() {
+		return 0
+	}
+	end := offset + 1
+	for end < len(data) && isnum(data[end]) {
+		end++
+	}
+	if end == offset+1 || (end < len(data) && isalnum(data[end])) {
+		return 0
+	}
+
+	// scan backward for org/repo
+	rewind := 0
+	for offset-rewind > 0 {
+		c := data[offset-rewind-1]
+		if !isalnum(c) && c != '/' && c != '-' && c != '_' && c != '.' {
+			break
+		}
+		rewind++
+	}
+	repo := string(data[offset-rewind : offset])
+	switch parts := strings.Split(repo, "/"); {
+	case repo == "" && IssueRepo != "":
+		repo = IssueRepo
+	case len(parts) != 2 || parts[0] == "" || parts[1] == "":
+		return 0
+	}
+	if rewind > 0 && !bytes.HasSuffix(out.Bytes(), data[offset-rewind:offset]) {
+		return 0
+	}
+
+	out.Truncate(out.Len() - rewind)
+	link := IssueTracker + repo + "/issues/" + string(data[offset+1:end])
+	p.r.Link(out, []byte(link), nil, data[offset-rewind:end])
+	return end - offset
+}
+
 func autoLink(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 	// quick check to rule out most false hits on ':'
 	if p.insideLink || len(data) < offset+3 || data[offset+1] != '/' || data[offset+2] != '/' {
@@ -1277,40 +1452,7 @@ func index(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 		return 0
 	}
 	ret = end
-	if comma == 0 {
-		comma = end
-	}
-
-	// may be surrounded by whitespace, strip it
-	primary := comma - 1
-	for i := comma - 1; i >= 0; i-- {
-		if !isspace(data[i]) {
-			break
-		}
-		primary = i
-	}
-
-	secondary := comma + 1
-	for i := comma + 1; i < end; i++ {
-		if !isspace(data[i]) {
-			secondary = i
-			break
-		}
-	}
-
-	i = 3
-	prim := false
-	if data[i] == '!' {
-		// mark is primary
-		prim = true
-		i++
-	}
-
-	if secondary > end-3 {
-		p.r.Index(out, data[i:primary-2], nil, prim)
-		return ret
-	}
-	p.r.Index(out, data[i:primary+1], data[secondary:end-3], prim)
+	p.indexEntry(out, data[3:end-3])
 	return ret
 }
 
@@ -1601,6 +1743,7 @@ func crossReference(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 		}
 		return 0
 	}
+	p.anchorReference(string(data[2:i]))
 	p.r.Link(out, data[1:i], nil, nil)
 	return i + 1
 }
@@ -1620,17 +1763,79 @@ func citationReference(p *parser, out *bytes.Buffer, data []byte, offset int) in
 		}
 		return 0
 	}
-	if c, ok := p.citations[string(data[1:i])]; ok {
-		p.r.Citation(out, data[1:i], c.title)
+	id := p.canonicalAnchor(data[1:i])
+	if c, ok := p.citations[string(id)]; ok {
+		p.r.Citation(out, id, c.title)
 		return i
 	}
 	// If we just see a @ it will always be normal text.
 	if len(data[:i]) > 1 {
-		printf(nil, "handling `%s' as normal text", string(data[:i]))
+		printf(p, "handling `%s' as normal text", string(data[:i]))
 	}
 	return 0
 }
 
+// rfcMention cites the RFC of a mention in the text, "RFC 2119" or "RFC2119", as if
+// [@RFC2119] follows it. A mention that is already followed by a citation is left
+// alone and "RFC\ 2119" is not a mention.
+func rfcMention(p *parser, out *bytes.Buffer, data []byte, offset int) int {
+	if p.insideLink || offset > 0 && isalnum(data[offset-1]) {
+		return 0
+	}
+	data = data[offset:]
+	if !bytes.HasPrefix(data, []byte("RFC")) {
+		return 0
+	}
+	i := 3
+	if i < len(data) && data[i] == ' ' {
+		i++
+	}
+	j := i
+	for j < len(data) && data[j] >= '0' && data[j] <= '9' {
+		j++
+	}
+	if j == i || j < len(data) && (isalnum(data[j]) || data[j] == '_') {
+		return 0
+	}
+	anchor := append([]byte("RFC"), data[i:j]...)
+	if rest := bytes.TrimLeft(data[j:], " "); bytes.HasPrefix(rest, []byte("[@")) || bytes.HasPrefix(rest, []byte("[-@")) {
+		return 0
+	}
+
+	p.r.NormalText(out, data[:j])
+	p.r.NormalText(out, []byte(" "))
+	p.inlineCallback['['](p, out, append(append([]byte("[@"), anchor...), ']'), 0)
+	return j
+}
+
+// combinedCitation splits a citation of several anchors, @RFC2119; @!RFC8174, in
+// its parts. It returns nil if this isn't such a citation.
+func combinedCitation(data []byte) [][]byte {
+	if bytes.IndexByte(data, ';') < 0 {
+		return nil
+	}
+	parts := bytes.Split(data, []byte(";"))
+	for i := range parts {
+		parts[i] = bytes.TrimSpace(parts[i])
+		if !bytes.HasPrefix(parts[i], []byte("@")) && !bytes.HasPrefix(parts[i], []byte("-@")) {
+			return nil
+		}
+	}
+	return parts
+}
+
+// citationSeparator returns what is written between the citations of a combined
+// citation: the renderer's CitationSeparator, if it has one, otherwise a space, as
+// in "BCP 14 [RFC2119] [RFC8174]".
+func citationSeparator(p *parser) string {
+	for r := p.r; r != nil; r = wrapped(r) {
+		if s, ok := r.(interface{ CitationSeparator() string }); ok {
+			return s.CitationSeparator()
+		}
+	}
+	return " "
+}
+
 func math(p *parser, out *bytes.Buffer, data []byte, offset int) int {
 	if len(data[offset:]) < 5 {
 		return 0
@@ -4,9 +4,10 @@ package mmark
 
 import (
 	"regexp"
+	"strings"
 	"testing"
 
-	"strings"
+	"github.com/miekg/mmark/mmarktest"
 )
 
 func runMarkdownInline(input string, extensions, htmlFlags int, params HtmlRendererParameters) string {
@@ -44,36 +45,9 @@ func doSafeTestsInline(t *testing.T, tests []string) {
 
 func doTestsInlineParam(t *testing.T, tests []string, extensions, htmlFlags int,
 	params HtmlRendererParameters) {
-	// catch and report panics
-	var candidate string
-	/*
-		defer func() {
-			if err := recover(); err != nil {
-				t.Errorf("\npanic while processing [%#v] (%v)\n", candidate, err)
-			}
-		}()
-	*/
-
-	for i := 0; i+1 < len(tests); i += 2 {
-		input := tests[i]
-		candidate = input
-		expected := tests[i+1]
-		actual := runMarkdownInline(candidate, extensions, htmlFlags, params)
-		if actual != expected {
-			t.Errorf("\nInput   [%#v]\nExpected[%#v]\nActual  [%#v]",
-				candidate, expected, actual)
-		}
-
-		// now test every substring to stress test bounds checking
-		if !testing.Short() {
-			for start := 0; start < len(input); start++ {
-				for end := start + 1; end <= len(input); end++ {
-					candidate = input[start:end]
-					_ = runMarkdownInline(candidate, extensions, htmlFlags, params)
-				}
-			}
-		}
-	}
+	mmarktest.Table(t, tests, func(input []byte) []byte {
+		return []byte(runMarkdownInline(string(input), extensions, htmlFlags, params))
+	})
 }
 
 func transformLinks(tests []string, prefix string) []string {
@@ -307,6 +281,32 @@ func TestStrikeThrough(t *testing.T) {
 	doTestsInline(t, tests)
 }
 
+func TestCriticMarkup(t *testing.T) {
+	input := "a {++*new*++} {--old--} {~~this~>that~~} {==mark==}{>>why <not><<} b\n"
+	var tests = []string{
+		input,
+		"<p>a <ins><em>new</em></ins> <del>old</del> <del>this</del><ins>that</ins> <mark>mark</mark><span class=\"critic comment\">why &lt;not&gt;</span> b</p>\n",
+
+		"{++ unclosed\n",
+		"<p>{++ unclosed</p>\n",
+	}
+	doTestsInlineParam(t, tests, EXTENSION_CRITIC, 0, HtmlRendererParameters{})
+
+	tests = []string{input, "<p>a <em>new</em>  that mark b</p>\n"}
+	doTestsInlineParam(t, tests, EXTENSION_CRITIC_ACCEPT, 0, HtmlRendererParameters{})
+
+	tests = []string{input, "<p>a  old this mark b</p>\n"}
+	doTestsInlineParam(t, tests, EXTENSION_CRITIC_REJECT, 0, HtmlRendererParameters{})
+
+	tests = []string{"a {--old--}{>>why<<}\n", "<t>\na <cref>Delete: old</cref><cref>why</cref>\n</t>\n"}
+	doTestsInlineParamXML(t, tests, EXTENSION_CRITIC, 0)
+
+	output, diags := ParseDiagnostics([]byte("a {++*new*++}\n"), Xml2Renderer(0), EXTENSION_CRITIC)
+	if expected := "<t>a <cref>Insert: new</cref>\n</t>\n"; output.String() != expected || len(diags) != 1 {
+		t.Errorf("expected %q and a warning, got %q, %v", expected, output, diags)
+	}
+}
+
 func TestSubscript(t *testing.T) {
 	var tests = []string{
 		"H~2~O is a liquid. is 1024. but this is ~~strikethrough~~ text\n",
@@ -423,6 +423,18 @@ func TestCodeSpan(t *testing.T) {
 
 		"```multiple ticks `with` ticks inside```\n",
 		"<p><code>multiple ticks `with` ticks inside</code></p>\n",
+
+		"`SOMAXCONN`{.c} and `x`\n",
+		"<p><code class=\"language-c\">SOMAXCONN</code> and <code>x</code></p>\n",
+
+		"`host:port`{.brackets #hp}\n",
+		"<p><code id=\"hp\" class=\"language-brackets\">host:port</code></p>\n",
+
+		"`code`{not an ial\n",
+		"<p><code>code</code>{not an ial</p>\n",
+
+		"Press `Ctrl-C`{.kbd} on `OK`{.samp} in `/etc/hosts`{.path}\n",
+		"<p>Press <kbd>Ctrl-C</kbd> on <samp>OK</samp> in <code class=\"path\">/etc/hosts</code></p>\n",
 	}
 	doTestsInline(t, tests)
 }
@@ -718,6 +730,25 @@ func TestTags(t *testing.T) {
 	doTestsInline(t, tests)
 }
 
+func TestEscapeTags(t *testing.T) {
+	var tests = []string{
+		"a <span>tag</span>\n",
+		"<p>a &lt;span&gt;tag&lt;/span&gt;</p>\n",
+	}
+	doTestsInlineParam(t, tests, 0, HTML_ESCAPE_HTML, HtmlRendererParameters{})
+}
+
+func TestEntity(t *testing.T) {
+	var tests = []string{
+		"a&nbsp;b &#60; &#x41;\n",
+		"<p>a&nbsp;b &lt; A</p>\n",
+
+		"RFC\\ 2119\n",
+		"<p>RFC&nbsp;2119</p>\n",
+	}
+	doTestsInline(t, tests)
+}
+
 func TestAutoLink(t *testing.T) {
 	var tests = []string{
 		"http://foo.com/\n",
@@ -1011,27 +1042,65 @@ func doTestsInlineXML(t *testing.T, tests []string) {
 }
 
 func doTestsInlineParamXML(t *testing.T, tests []string, extensions, xmlFlags int) {
-	var candidate string
-
-	for i := 0; i+1 < len(tests); i += 2 {
-		input := tests[i]
-		candidate = input
-		expected := tests[i+1]
-		actual := runMarkdownInlineXML(candidate, extensions, xmlFlags)
-		if actual != expected {
-			t.Errorf("\nInput   [%#v]\nExpected[%#v]\nActual  [%#v]",
-				candidate, expected, actual)
-		}
+	mmarktest.Table(t, tests, func(input []byte) []byte {
+		return []byte(runMarkdownInlineXML(string(input), extensions, xmlFlags))
+	})
+}
 
-		// now test every substring to stress test bounds checking
-		if !testing.Short() {
-			for start := 0; start < len(input); start++ {
-				for end := start + 1; end <= len(input); end++ {
-					candidate = input[start:end]
-					_ = runMarkdownInlineXML(candidate, extensions, xmlFlags)
-				}
-			}
-		}
+func TestTagsXML(t *testing.T) {
+	var tests = []string{
+		"a<br>b <sup>2</sup> <tt>c</tt> <span>x</span>\n",
+		"<t>\na<vspace/>b <sup>2</sup> <tt>c</tt> x\n</t>\n",
+	}
+	doTestsInlineXML(t, tests)
+
+	tests = []string{
+		"a<br>b <span>x</span>\n",
+		"<t>\nab x\n</t>\n",
+	}
+	doTestsInlineParamXML(t, tests, 0, XML_SKIP_HTML)
+
+	tests = []string{
+		"a<br>b\n",
+		"<t>\na&lt;br&gt;b\n</t>\n",
+	}
+	doTestsInlineParamXML(t, tests, 0, XML_ESCAPE_HTML)
+
+	actual := Parse([]byte("<sup>2</sup> <tt>c</tt>\n"), Xml2Renderer(0), 0).String()
+	if expected := "<t>^2^ <spanx style=\"verb\">c</spanx>\n</t>\n"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestCodeRoleXML(t *testing.T) {
+	var tests = []string{
+		"`Ctrl-C`{.kbd} `OK`{.samp} `/etc/hosts`{.path}\n",
+		"<t>\n<strong><tt>Ctrl-C</tt></strong> <em>OK</em> <tt>/etc/hosts</tt>\n</t>\n",
+	}
+	doTestsInlineXML(t, tests)
+
+	actual := Parse([]byte("`Ctrl-C`{.kbd} `OK`{.samp}\n"), Xml2Renderer(0), 0).String()
+	if expected := "<t><spanx style=\"strong\">Ctrl-C</spanx> <spanx style=\"emph\">OK</spanx>\n</t>\n"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestEntityXML(t *testing.T) {
+	var tests = []string{
+		"a&nbsp;b &amp; &#60; &mdash;\n",
+		"<t>\na\u00a0b &amp; &lt; \u2014\n</t>\n",
+
+		"&bogus;\n",
+		"<t>\n&amp;bogus;\n</t>\n",
+
+		"RFC\\ 2119\n",
+		"<t>\nRFC\u00a02119\n</t>\n",
+	}
+	doTestsInlineXML(t, tests)
+
+	actual := Parse([]byte("a&nbsp;b &amp; &mdash;\n"), Xml2Renderer(0), 0).String()
+	if expected := "<t>a&#160;b &amp; &#8212;\n</t>\n"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
 	}
 }
 
@@ -1145,6 +1214,191 @@ func TestCitationXML(t *testing.T) {
 	doTestsInlineParamXML(t, tests, 0, XML_STANDALONE)
 }
 
+func TestCombinedCitation(t *testing.T) {
+	input := "BCP 14 [@!RFC2119; @RFC8174; -@RFC3024] and [@?RFC8174].\n"
+	actual := Parse([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_CITATION).String()
+	for _, expected := range []string{
+		"BCP 14 <xref target=\"RFC2119\"/> <xref target=\"RFC8174\"/> and <xref target=\"RFC8174\"/>.",
+		"<name>Normative References</name>\n<xi:include href=\"https://xml2rfc.tools.ietf.org/public/rfc/bibxml/reference.RFC.2119.xml\"/>\n</references>",
+		"<name>Informative References</name>\n<xi:include href=\"https://xml2rfc.tools.ietf.org/public/rfc/bibxml/reference.RFC.3024.xml\"/>\n<xi:include href=\"https://xml2rfc.tools.ietf.org/public/rfc/bibxml/reference.RFC.8174.xml\"/>",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected %q in %q", expected, actual)
+		}
+	}
+
+	actual = Parse([]byte(input), HtmlRenderer(0, "", ""), EXTENSION_CITATION).String()
+	if expected := "<a class=\"cite\" href=\"#rfc2119\"></a>, <a class=\"cite\" href=\"#rfc8174\"></a> and"; !strings.Contains(actual, expected) {
+		t.Errorf("expected %q in %q", expected, actual)
+	}
+}
+
+func TestInternalCitation(t *testing.T) {
+	input := "% title = \"Test\"\n% docName = \"draft-gieben-test-02\"\n% internal = [\"I-D.gieben-companion\"]\n\n" +
+		"See [@I-D.gieben-test], [@I-D.gieben-companion] and [@RFC2119].\n"
+	actual := Parse([]byte(input), Xml2Renderer(XML2_STANDALONE), EXTENSION_CITATION|EXTENSION_TITLEBLOCK_TOML).String()
+	if expected := "See <xref target=\"I-D.gieben-test\"/>, <xref target=\"I-D.gieben-companion\"/> and <xref target=\"RFC2119\"/>."; !strings.Contains(actual, expected) {
+		t.Errorf("expected %q in %q", expected, actual)
+	}
+	if strings.Contains(actual, "gieben-test.xml") || strings.Contains(actual, "gieben-companion.xml") {
+		t.Errorf("expected no reference to the document or its companion in %q", actual)
+	}
+	if !strings.Contains(actual, "reference.RFC.2119.xml") {
+		t.Errorf("expected a reference to RFC 2119 in %q", actual)
+	}
+
+	input = strings.Replace(input, "[@I-D.gieben-companion]", "[@I-D.Gieben-Companion]", 1)
+	actual = Parse([]byte(input), Xml2Renderer(XML2_STANDALONE), EXTENSION_CITATION|EXTENSION_TITLEBLOCK_TOML).String()
+	if expected := "<xref target=\"I-D.gieben-companion\"/>"; !strings.Contains(actual, expected) || strings.Contains(actual, "ieben-companion.xml") {
+		t.Errorf("expected %q and no reference to the companion in %q", expected, actual)
+	}
+}
+
+func TestDraftVersion(t *testing.T) {
+	input := "See [@!I-D.ietf-foo-bar-07], [@!I-D.ietf-baz] and [@RFC2119].\n"
+	output, diags := ParseDiagnostics([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_CITATION)
+	for _, expected := range []string{
+		"<xref target=\"I-D.ietf-foo-bar\"/>",
+		"reference.I-D.draft-ietf-foo-bar-07.xml",
+		"reference.I-D.ietf-baz.xml",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+	if len(diags) != 1 || diags[0].Message != "normative reference I-D.ietf-baz has no version, pin it with [@!I-D.ietf-baz-NN]" {
+		t.Errorf("expected a warning for I-D.ietf-baz, got %v", diags)
+	}
+
+	defer func() { ReferenceFile = "" }()
+	ReferenceFile = "refs/{{.Anchor}}{{if .Version}}-{{.Version}}{{end}}.xml"
+	output = Parse([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_CITATION)
+	for _, expected := range []string{"refs/I-D.ietf-foo-bar-07.xml", "refs/I-D.ietf-baz.xml", "refs/RFC2119.xml"} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected %q in %q", expected, output)
+		}
+	}
+
+	// documents are parsed concurrently with the same template
+	done := make(chan string)
+	for i := 0; i < 4; i++ {
+		go func() { done <- Parse([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_CITATION).String() }()
+	}
+	for i := 0; i < 4; i++ {
+		if actual := <-done; actual != output.String() {
+			t.Errorf("expected %q, got %q", output, actual)
+		}
+	}
+
+	for _, tmpl := range []string{"refs/{{.Anchor", "refs/{{.Nope}}.xml"} {
+		ReferenceFile = tmpl
+		output, diags := ParseDiagnostics([]byte("Text.\n\nSee [@RFC2119].\n"), XmlRenderer(XML_STANDALONE), EXTENSION_CITATION)
+		if expected := "reference.RFC.2119.xml"; !strings.Contains(output.String(), expected) {
+			t.Errorf("%s: expected %q in %q", tmpl, expected, output)
+		}
+		if len(diags) != 1 || diags[0].Line != 3 || !strings.HasPrefix(diags[0].Message, "error in reference file template for `RFC2119'") {
+			t.Errorf("%s: expected a warning on line 3, got %v", tmpl, diags)
+		}
+	}
+}
+
+func TestReferenceGroups(t *testing.T) {
+	input := "% title = \"Test\"\n% [references]\n% informative = \"Further Reading\"\n% [references.groups]\n% u = \"URIs\"\n\n" +
+		"See [@!RFC2119], [@RFC8174] and [@u:W3C.REC-xml].\n"
+	actual := Parse([]byte(input), XmlRenderer(XML_STANDALONE), EXTENSION_CITATION|EXTENSION_TITLEBLOCK_TOML).String()
+	for _, expected := range []string{
+		"<xref target=\"W3C.REC-xml\"/>",
+		"<references>\n<name>Normative References</name>\n",
+		"<references>\n<name>Further Reading</name>\n<xi:include href=\"https://xml2rfc.tools.ietf.org/public/rfc/bibxml/reference.RFC.8174.xml\"/>\n</references>\n",
+		"<references>\n<name>URIs</name>\n<xi:include href=\"https://xml2rfc.tools.ietf.org/public/rfc/bibxml4/reference.W3C.REC-xml.xml\"/>\n</references>\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected %q in %q", expected, actual)
+		}
+	}
+
+	actual = Parse([]byte(input), Xml2Renderer(XML2_STANDALONE), EXTENSION_CITATION|EXTENSION_TITLEBLOCK_TOML).String()
+	if expected := "<references title=\"URIs\">\n"; !strings.Contains(actual, expected) {
+		t.Errorf("expected %q in %q", expected, actual)
+	}
+}
+
+func TestCitationSection(t *testing.T) {
+	input := "See [@RFC7230, Section 3.2], [@RFC7230 Appendix A #appendix-a] and [@RFC7230 p. 23].\n"
+	for _, r := range []struct {
+		renderer Renderer
+		expected string
+	}{
+		{XmlRenderer(0), "See <xref target=\"RFC7230\" section=\"3.2\" sectionFormat=\"comma\"/>, " +
+			"<xref target=\"RFC7230\" section=\"A\" sectionFormat=\"comma\" relative=\"#appendix-a\"/> and <xref target=\"RFC7230\" section=\"p. 23\"/>."},
+		{Xml2Renderer(0), "See <xref target=\"RFC7230\"/>, Section 3.2, <xref target=\"RFC7230\"/>, Appendix A and <xref target=\"RFC7230\"/>."},
+		{HtmlRenderer(0, "", ""), "See [<a class=\"cite\" href=\"#rfc7230\">RFC7230</a>], Section 3.2, " +
+			"[<a class=\"cite\" href=\"#rfc7230\">RFC7230</a>], Appendix A and <a class=\"cite\" href=\"#rfc7230\">p. 23</a>."},
+	} {
+		if actual := Parse([]byte(input), r.renderer, EXTENSION_CITATION).String(); !strings.Contains(actual, r.expected) {
+			t.Errorf("expected %q in %q", r.expected, actual)
+		}
+	}
+}
+
+func TestCitationSectionFormat(t *testing.T) {
+	input := "See [@RFC7230 of Section 3.2] and [@RFC7230 (Section 4)].\n"
+	for _, r := range []struct {
+		renderer Renderer
+		expected string
+	}{
+		{XmlRenderer(0), "See <xref target=\"RFC7230\" section=\"3.2\" sectionFormat=\"of\"/> and <xref target=\"RFC7230\" section=\"4\" sectionFormat=\"parens\"/>."},
+		{Xml2Renderer(0), "See Section 3.2 of <xref target=\"RFC7230\"/> and <xref target=\"RFC7230\"/> (Section 4)."},
+	} {
+		if actual := Parse([]byte(input), r.renderer, EXTENSION_CITATION).String(); !strings.Contains(actual, r.expected) {
+			t.Errorf("expected %q in %q", r.expected, actual)
+		}
+	}
+}
+
+func TestCitationFragment(t *testing.T) {
+	input := "See [@RFC7950#section-7.19], [@RFC7950#appendix-a of] and [@RFC7950#figure-1].\n"
+	for _, r := range []struct {
+		renderer Renderer
+		expected string
+	}{
+		{XmlRenderer(0), "See <xref target=\"RFC7950\" section=\"7.19\" sectionFormat=\"comma\" relative=\"#section-7.19\"/>, " +
+			"<xref target=\"RFC7950\" section=\"A\" sectionFormat=\"of\" relative=\"#appendix-a\"/> and <xref target=\"RFC7950\"/>."},
+		{Xml2Renderer(0), "See <xref target=\"RFC7950\"/>, Section 7.19, Appendix A of <xref target=\"RFC7950\"/> and <xref target=\"RFC7950\"/>."},
+		{HtmlRenderer(0, "", ""), "See [<a class=\"cite\" href=\"#rfc7950\">RFC7950</a>], Section 7.19, "},
+	} {
+		output, diags := ParseDiagnostics([]byte(input), r.renderer, EXTENSION_CITATION)
+		if !strings.Contains(output.String(), r.expected) {
+			t.Errorf("expected %q in %q", r.expected, output)
+		}
+		if len(diags) != 1 || diags[0].Message != "can not cite `#figure-1' of RFC7950, use #section-N or #appendix-N" {
+			t.Errorf("expected a warning for #figure-1, got %v", diags)
+		}
+	}
+}
+
+func TestCanonicalAnchor(t *testing.T) {
+	input := "% title = \"Test\"\n% [aliases]\n% HTTP2 = \"RFC9113\"\n\n" +
+		"See [@http2], [@rfc2119], [@Foo], [@foo] and [@i-d.ietf-bar].\n"
+	output, diags := ParseDiagnostics([]byte(input), XmlRenderer(0), EXTENSION_CITATION|EXTENSION_TITLEBLOCK_TOML)
+	expected := "See <xref target=\"RFC9113\"/>, <xref target=\"RFC2119\"/>, <xref target=\"Foo\"/>, <xref target=\"Foo\"/> and <xref target=\"I-D.ietf-bar\"/>."
+	if !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+	if len(diags) != 1 || diags[0].Message != "citing `http2' as `RFC9113'" {
+		t.Errorf("expected the alias to be reported, got %v", diags)
+	}
+
+	diags = []Diagnostic{}
+	p := &parser{citations: map[string]*citation{"Foo": {}, "FOO": {}}, diagnostics: &diags}
+	if id := p.canonicalAnchor([]byte("foo")); string(id) != "foo" {
+		t.Errorf("expected foo, got %s", id)
+	}
+	if len(diags) != 1 || diags[0].Message != "citation `foo' matches FOO, Foo, which differ only in case" {
+		t.Errorf("expected an ambiguity warning, got %v", diags)
+	}
+}
+
 func TestRFC2119XML(t *testing.T) {
 	var tests = []string{
 		"MUST",
@@ -1246,3 +1500,134 @@ func TestDisableSmartDashes(t *testing.T) {
 		HTML_USE_SMARTYPANTS|HTML_SMARTYPANTS_LATEX_DASHES,
 		HtmlRendererParameters{})
 }
+
+func TestIssueLink(t *testing.T) {
+	defer func(repo string) { IssueRepo = repo }(IssueRepo)
+	IssueRepo = ""
+	var tests = []string{
+		"See miekg/mmark#45.\n",
+		"<p>See <a href=\"https://github.com/miekg/mmark/issues/45\">miekg/mmark#45</a>.</p>\n",
+
+		"See #12 and a#1 and #x.\n",
+		"<p>See #12 and a#1 and #x.</p>\n",
+	}
+	doTestsInlineParam(t, tests, EXTENSION_ISSUE_LINKS, 0, HtmlRendererParameters{})
+
+	IssueRepo = "miekg/mmark"
+	tests = []string{
+		"See #12 (#13) and a#1.\n",
+		"<p>See <a href=\"https://github.com/miekg/mmark/issues/12\">#12</a> (<a href=\"https://github.com/miekg/mmark/issues/13\">#13</a>) and a#1.</p>\n",
+	}
+	doTestsInlineParam(t, tests, EXTENSION_ISSUE_LINKS, 0, HtmlRendererParameters{})
+
+	actual := Parse([]byte("See #12.\n"), XmlRenderer(0), EXTENSION_ISSUE_LINKS).String()
+	if expected := "<t>\nSee #12.\n</t>\n"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	actual = Parse([]byte("See #12.\n"), SlidesRenderer(0, ""), EXTENSION_ISSUE_LINKS).String()
+	if expected := "<a href=\"https://github.com/miekg/mmark/issues/12\">#12</a>"; !strings.Contains(actual, expected) {
+		t.Errorf("expected %q in %q", expected, actual)
+	}
+}
+
+func TestEmoji(t *testing.T) {
+	var tests = []string{
+		"Careful :warning: and :+1:.\n",
+		"<p>Careful ⚠️ and \U0001F44D.</p>\n",
+
+		"At 10:30:00 a:smile: and :nosuchemoji: stay.\n",
+		"<p>At 10:30:00 a:smile: and :nosuchemoji: stay.</p>\n",
+	}
+	doTestsInlineParam(t, tests, EXTENSION_EMOJI, 0, HtmlRendererParameters{})
+
+	tests = []string{
+		"Careful :warning: at http://example.com.\n",
+		"<p>Careful ⚠️ at <a href=\"http://example.com\">http://example.com</a>.</p>\n",
+	}
+	doTestsInlineParam(t, tests, EXTENSION_EMOJI|EXTENSION_AUTOLINK, 0, HtmlRendererParameters{})
+
+	actual := Parse([]byte("Careful :no_entry:.\n"), XmlRenderer(0), EXTENSION_EMOJI).String()
+	if expected := "<t>\nCareful no entry.\n</t>\n"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestInlineFootnoteXML(t *testing.T) {
+	input := "Text^[a *short* note] and more.\n"
+	output, diags := ParseDiagnostics([]byte(input), XmlRenderer(0), EXTENSION_FOOTNOTES)
+	if expected := "<t>\nText (a <em>short</em> note) and more.\n</t>\n"; output.String() != expected || len(diags) != 0 {
+		t.Errorf("expected %q, got %q, %v", expected, output, diags)
+	}
+
+	defer func() { FootnoteCref = false }()
+	FootnoteCref = true
+	output, diags = ParseDiagnostics([]byte(input), Xml2Renderer(0), EXTENSION_FOOTNOTES)
+	if expected := "<t>Text<cref>a short note</cref> and more.\n</t>\n"; output.String() != expected || len(diags) != 1 {
+		t.Errorf("expected %q and a warning, got %q, %v", expected, output, diags)
+	}
+
+	output = Parse([]byte(input), HtmlRenderer(0, "", ""), EXTENSION_FOOTNOTES)
+	if expected := "<sup class=\"footnote-ref\""; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+}
+
+func TestFootnotesPerSection(t *testing.T) {
+	input := "# One\n\nText[^a].\n\n# Two\n\nMore^[inline].\n\n[^a]: First note.\n"
+	defer func() { FootnotesPerSection = false }()
+	FootnotesPerSection = true
+	output := Parse([]byte(input), HtmlRenderer(0, "", ""), EXTENSION_FOOTNOTES)
+
+	one := strings.Index(output.String(), "<li id=\"fn:1-a\">First note.\n</li>")
+	two := strings.Index(output.String(), "<h1>Two</h1>")
+	inline := strings.Index(output.String(), "<li id=\"fn:2-inline\">inline</li>")
+	if one < 0 || two < 0 || inline < 0 || one > two || inline < two {
+		t.Errorf("expected the footnotes at the end of their sections, got %q", output)
+	}
+	if strings.Count(output.String(), ">1</a></sup>") != 2 {
+		t.Errorf("expected the footnotes to be numbered per section, got %q", output)
+	}
+
+	input = "# One\n\nText[^a].\n\n# Two\n\nAgain[^a].\n\n[^a]: First note.\n"
+	output = Parse([]byte(input), HtmlRenderer(HTML_FOOTNOTE_RETURN_LINKS, "", ""), EXTENSION_FOOTNOTES)
+	for _, expected := range []string{
+		"<sup class=\"footnote-ref\" id=\"fnref:1-a\"><a class=\"footnote\" href=\"#fn:1-a\">1</a></sup>",
+		"<sup class=\"footnote-ref\" id=\"fnref:2-a\"><a class=\"footnote\" href=\"#fn:2-a\">1</a></sup>",
+		"<li id=\"fn:1-a\">First note.\n <a class=\"footnote-return\" href=\"#fnref:1-a\">",
+		"<li id=\"fn:2-a\">First note.\n <a class=\"footnote-return\" href=\"#fnref:2-a\">",
+	} {
+		if strings.Count(output.String(), expected) != 1 {
+			t.Errorf("expected %q once in %q", expected, output)
+		}
+	}
+}
+
+func TestRFCMention(t *testing.T) {
+	input := "See RFC 2119 and RFC8174 [@RFC8174], not XRFC 1 or RFC\\ 793, RFC 20a or [RFC 1](http://example.org).\n"
+	extensions := EXTENSION_CITATION | EXTENSION_RFC_MENTIONS
+	output := Parse([]byte(input), XmlRenderer(0), extensions)
+	expected := "<t>\nSee RFC 2119 <xref target=\"RFC2119\"/> and RFC8174 <xref target=\"RFC8174\"/>, not XRFC 1 or RFC\u00a0793, " +
+		"RFC 20a or <eref target=\"http://example.org\">RFC 1</eref>.\n</t>\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestEmailObfuscation(t *testing.T) {
+	input := "Mail <alice@example.org>.\n"
+	for obfuscation, expected := range map[string]string{
+		"":         "<p>Mail <a href=\"mailto:alice@example.org\">alice@example.org</a>.</p>\n",
+		"entities": "<p>Mail <a href=\"&#109;&#97;&#105;&#108;&#116;&#111;&#58;&#97;&#108;&#105;&#99;&#101;&#64;&#101;&#120;&#46;&#111;&#114;&#103;\">&#97;&#108;&#105;&#99;&#101;&#64;&#101;&#120;&#46;&#111;&#114;&#103;</a>.</p>\n",
+		"munge":    "<p>Mail alice [at] example [dot] org.</p>\n",
+		"text":     "<p>Mail alice@example.org.</p>\n",
+	} {
+		in := input
+		if obfuscation == "entities" {
+			in = "Mail <alice@ex.org>.\n"
+		}
+		r := HtmlRendererWithParameters(0, "", "", HtmlRendererParameters{EmailObfuscation: obfuscation})
+		if output := Parse([]byte(in), r, EXTENSION_AUTOLINK); output.String() != expected {
+			t.Errorf("%s: expected %q, got %q", obfuscation, expected, output)
+		}
+	}
+}
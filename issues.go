@@ -0,0 +1,102 @@
+// Open issues: TODO and ISSUE markers in HTML comments.
+
+package mmark
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Issue is a marker in an HTML comment, either <!-- TODO: text --> or
+// <!-- ISSUE(#123): text -->.
+type Issue struct {
+	Kind string `json:"kind"`         // TODO or ISSUE
+	ID   string `json:"id,omitempty"` // between the parentheses, e.g. #123
+	Text string `json:"text"`
+	Line int    `json:"line"`
+}
+
+var issueMarker = regexp.MustCompile(`(?s)^<!--\s*(TODO|ISSUE)(?:\(([^)]*)\))?:\s*(.*?)\s*-->`)
+
+// ParseIssues is like Parse, but also returns the issues in the comments of
+// input. When appendix is true the document ends with an Open Issues section
+// that lists them, so drafts can show them and publication builds leave them out.
+func ParseIssues(input []byte, renderer Renderer, extensions int, appendix bool) (*bytes.Buffer, []Issue) {
+	out, res, _ := ParseWith(input, renderer, extensions, ParseOptions{Issues: true, OpenIssues: appendix})
+	return out, res.Issues
+}
+
+// issues collects the issues from the comments the embedded renderer renders.
+type issues struct {
+	Renderer
+	appendix bool
+	issues   []Issue
+
+	p *parser
+}
+
+func (i *issues) setParser(p *parser) {
+	i.p = p
+	if s, ok := i.Renderer.(parserSetter); ok {
+		s.setParser(p)
+	}
+}
+
+func (i *issues) add(comment []byte) {
+	m := issueMarker.FindSubmatch(comment)
+	if m == nil {
+		return
+	}
+	issue := Issue{Kind: string(m[1]), ID: string(m[2]), Text: string(m[3])}
+	if i.p != nil {
+		issue.Line = i.p.line
+	}
+	i.issues = append(i.issues, issue)
+}
+
+func (i *issues) CommentHtml(out *bytes.Buffer, text []byte) {
+	i.add(text)
+	i.Renderer.CommentHtml(out, text)
+}
+
+func (i *issues) RawHtmlTag(out *bytes.Buffer, text []byte) {
+	i.add(text)
+	i.Renderer.RawHtmlTag(out, text)
+}
+
+func (i *issues) DocumentFooter(out *bytes.Buffer, first bool) {
+	if first && i.appendix && len(i.issues) > 0 {
+		i.SetAttr(nil)
+		i.Header(out, func() bool { i.NormalText(out, []byte("Open Issues")); return true }, 1, "open-issues")
+		i.SetAttr(nil)
+		i.List(out, func() bool {
+			flags := _LIST_ITEM_BEGINNING_OF_LIST
+			for j, issue := range i.issues {
+				if j == len(i.issues)-1 {
+					flags |= _LIST_ITEM_END_OF_LIST
+				}
+				var item bytes.Buffer
+				i.NormalText(&item, []byte(issue.String()))
+				i.ListItem(out, item.Bytes(), flags)
+				flags &^= _LIST_ITEM_BEGINNING_OF_LIST
+			}
+			return true
+		}, 0, 0, nil)
+	}
+	i.Renderer.DocumentFooter(out, first)
+}
+
+// String returns the issue as, for instance, "ISSUE #123: text (line 12)".
+func (i Issue) String() string {
+	s := i.Kind
+	if i.ID != "" {
+		s += " " + i.ID
+	}
+	s += ": " + strings.Join(strings.Fields(i.Text), " ")
+	if i.Line > 0 {
+		s += " (line " + strconv.Itoa(i.Line) + ")"
+	}
+	return s
+}
@@ -0,0 +1,27 @@
+package mmark
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIssues(t *testing.T) {
+	input := "# Intro\n\n<!-- TODO: write the intro -->\n\nSome text <!-- ISSUE(#12): is this\nright? --> here.\n\n<!-- just a comment -->\n"
+	output, issues := ParseIssues([]byte(input), Xml2Renderer(0), 0, true)
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %v", issues)
+	}
+	if i := issues[1]; i.Kind != "ISSUE" || i.ID != "#12" || i.Text != "is this\nright?" || i.Line != 5 {
+		t.Errorf("unexpected issue: %#v", i)
+	}
+	expected := "<section anchor=\"open-issues\" title=\"Open Issues\">\n<t>\n<list style=\"symbols\">\n" +
+		"<t>TODO: write the intro (line 3)</t>\n<t>ISSUE #12: is this right? (line 5)</t>\n</list>\n</t>\n"
+	if !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+
+	output, _ = ParseIssues([]byte(input), Xml2Renderer(0), 0, false)
+	if strings.Contains(output.String(), "Open Issues") {
+		t.Errorf("expected no Open Issues section, got %q", output)
+	}
+}
@@ -0,0 +1,39 @@
+// Command libmmark builds mmark as a C shared library:
+//
+//	go build -buildmode=c-shared -o libmmark.so
+//
+// which also writes libmmark.h. It exports
+//
+//	char *mmark_convert(char *input, int len, char *target, int flags);
+//	void mmark_free(char *output);
+//
+// mmark_convert renders input (of len bytes) for target, which is html, xml,
+// xml2 or slides, flags are the renderer flags, i.e. 1 is a standalone document
+// for the XML targets. It returns NULL for an unknown target. The returned
+// string must be released with mmark_free.
+package main
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/miekg/mmark"
+)
+
+//export mmark_convert
+func mmark_convert(input *C.char, length C.int, target *C.char, flags C.int) *C.char {
+	out, err := mmark.Convert(C.GoBytes(unsafe.Pointer(input), length), C.GoString(target), int(flags))
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(out))
+}
+
+//export mmark_free
+func mmark_free(output *C.char) {
+	C.free(unsafe.Pointer(output))
+}
+
+func main() {}
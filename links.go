@@ -0,0 +1,87 @@
+// Links: the targets of links, autolinks, images and link reference definitions.
+
+package mmark
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Link is a link target in a document.
+type Link struct {
+	Kind   string `json:"kind"` // link, autolink, image or reference (an unused link reference definition)
+	Target string `json:"target"`
+	Line   int    `json:"line"` // 0 for references
+}
+
+// ParseLinks is like Parse, but also returns the link targets in input, in
+// document order, followed by the link reference definitions that are not used.
+func ParseLinks(input []byte, renderer Renderer, extensions int) (*bytes.Buffer, []Link) {
+	out, res, _ := ParseWith(input, renderer, extensions, ParseOptions{Links: true})
+	return out, res.Links
+}
+
+// links collects the link targets the embedded renderer renders.
+type links struct {
+	Renderer
+	links []Link
+
+	p *parser
+}
+
+func (l *links) setParser(p *parser) {
+	l.p = p
+	if s, ok := l.Renderer.(parserSetter); ok {
+		s.setParser(p)
+	}
+}
+
+func (l *links) add(kind string, target []byte) {
+	link := Link{Kind: kind, Target: string(target)}
+	if l.p != nil {
+		link.Line = l.p.line
+	}
+	l.links = append(l.links, link)
+}
+
+// unused returns the link reference definitions none of the links use.
+func (l *links) unused() []Link {
+	if l.p == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, link := range l.links {
+		seen[link.Target] = true
+	}
+	unused := []Link{}
+	for _, ref := range l.p.refs {
+		if ref.noteId != 0 || len(ref.link) == 0 || seen[string(ref.link)] {
+			continue
+		}
+		seen[string(ref.link)] = true
+		unused = append(unused, Link{Kind: "reference", Target: string(ref.link)})
+	}
+	sort.Sort(linksByTarget(unused))
+	return unused
+}
+
+type linksByTarget []Link
+
+func (l linksByTarget) Len() int           { return len(l) }
+func (l linksByTarget) Less(i, j int) bool { return l[i].Target < l[j].Target }
+func (l linksByTarget) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+func (l *links) AutoLink(out *bytes.Buffer, link []byte, kind int) {
+	l.add("autolink", link)
+	l.Renderer.AutoLink(out, link, kind)
+}
+
+func (l *links) Image(out *bytes.Buffer, link []byte, title []byte, alt []byte, subfigure bool) {
+	l.add("image", link)
+	l.Renderer.Image(out, link, title, alt, subfigure)
+}
+
+func (l *links) Link(out *bytes.Buffer, link []byte, title []byte, content []byte) {
+	l.add("link", link)
+	l.Renderer.Link(out, link, title, content)
+}
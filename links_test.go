@@ -0,0 +1,22 @@
+package mmark
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	input := "A [link](http://example.org/a) and <http://example.org/b>.\n\n![logo](logo.png)\n\nSee [the spec][spec].\n\n" +
+		"[spec]: http://example.org/spec\n[unused]: http://example.org/unused\n"
+	_, links := ParseLinks([]byte(input), HtmlRenderer(0, "", ""), EXTENSION_AUTOLINK)
+	expected := []Link{
+		{"link", "http://example.org/a", 1},
+		{"autolink", "http://example.org/b", 1},
+		{"image", "logo.png", 3},
+		{"link", "http://example.org/spec", 5},
+		{"reference", "http://example.org/unused", 0},
+	}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("expected %v, got %v", expected, links)
+	}
+}
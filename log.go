@@ -1,14 +1,112 @@
 package mmark
 
-import "log"
+import (
+	"fmt"
+	"log"
+)
 
-func printf(p *parser, format string, v ...interface{}) {
-	if test {
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "info"
+}
+
+// Diagnostic is a message about the input seen during parsing or rendering.
+type Diagnostic struct {
+	Severity  Severity
+	Line      int // line in the input, 0 if not known
+	Message   string
+	Construct string // the construct the renderer could not output, if that is the problem
+}
+
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return d.Severity.String() + ": " + d.Message
+	}
+	return fmt.Sprintf("%d: %s: %s", d.Line, d.Severity, d.Message)
+}
+
+// Logger receives the debug traces of the parser and renderers: the blocks
+// entered, the includes resolved and how citations are classified. The Debug
+// method matches the one of log/slog's Logger, so a *slog.Logger can be used.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+}
+
+// DebugLogger, when not nil, gets the debug traces.
+var DebugLogger Logger
+
+// trace sends a debug trace to DebugLogger, args are key value pairs. The input
+// line is added when known.
+func trace(p *parser, msg string, args ...interface{}) {
+	if DebugLogger == nil {
 		return
 	}
+	if p != nil && p.line > 0 {
+		args = append(args, "line", p.line)
+	}
+	DebugLogger.Debug(msg, args...)
+}
+
+func printf(p *parser, format string, v ...interface{}) { logf(p, SeverityInfo, format, v...) }
+func warnf(p *parser, format string, v ...interface{})  { logf(p, SeverityWarning, format, v...) }
+func errorf(p *parser, format string, v ...interface{}) { logf(p, SeverityError, format, v...) }
+
+func logf(p *parser, s Severity, format string, v ...interface{}) {
+	report(p, Diagnostic{Severity: s, Message: fmt.Sprintf(format, v...)})
+}
+
+// unsupported reports that the renderer can not output construct and (partly)
+// drops it. With EXTENSION_STRICT this is an error, otherwise a warning.
+func unsupported(p *parser, construct, detail string) {
+	message := "syntax not supported: " + construct
+	if detail != "" {
+		message += ": " + detail
+	}
+	dropped(p, construct, message)
+}
+
+// truncated reports that rendering the content of construct failed, i.e. its text
+// function returned false, and that construct is dropped. With EXTENSION_STRICT
+// this is an error, otherwise a warning.
+func truncated(p *parser, construct string) {
+	dropped(p, construct, "failed to render "+construct+", its content is dropped")
+}
+
+func dropped(p *parser, construct, message string) {
+	d := Diagnostic{Severity: SeverityWarning, Message: message, Construct: construct}
+	if p != nil && p.flags&EXTENSION_STRICT != 0 {
+		d.Severity = SeverityError
+	}
+	report(p, d)
+}
+
+func report(p *parser, d Diagnostic) {
+	if MetricsHook != nil && p != nil {
+		MetricsHook.Diagnostic(backendName(p.r), d.Severity)
+	}
 	if p != nil {
-		log.Printf("mmark: "+format, v...)
+		d.Line = p.line
+		if p.diagnostics != nil {
+			*p.diagnostics = append(*p.diagnostics, d)
+			return
+		}
+	}
+	if test {
 		return
 	}
-	log.Printf("mmark: "+format, v...)
+	log.Print("mmark: " + d.Message)
 }
@@ -5,6 +5,8 @@ package mmark
 import (
 	"bytes"
 	"path"
+	"strconv"
+	"time"
 	"unicode/utf8"
 )
 
@@ -41,6 +43,15 @@ const (
 	EXTENSION_BACKSLASH_LINE_BREAK       // Translate trailing backslashes into line breaks
 	EXTENSION_RFC7328                    // Parse RFC 7328 markdown. Depends on FOOTNOTES extension.
 	EXTENSION_DEFINITION_LISTS           // render definition lists
+	EXTENSION_CRITIC                     // Render CriticMarkup changes and comments
+	EXTENSION_CRITIC_ACCEPT              // Accept all CriticMarkup changes and drop the comments
+	EXTENSION_CRITIC_REJECT              // Reject all CriticMarkup changes and drop the comments
+	EXTENSION_STRICT                     // Constructs the renderer can't output are errors instead of warnings
+	EXTENSION_CODE_COMPONENTS            // Move code blocks with {component="true"} to a Code Components appendix
+	EXTENSION_IANA                       // Render ```iana code blocks with TOML registrations as tables
+	EXTENSION_ISSUE_LINKS                // Link #123 and org/repo#45 to the issue tracker in HTML
+	EXTENSION_EMOJI                      // Turn :warning: and other shortcodes into emoji in HTML
+	EXTENSION_RFC_MENTIONS               // Cite the RFC of a mention like RFC 2119 in the text, needs EXTENSION_CITATION
 
 	commonHtmlFlags = 0 |
 		HTML_USE_SMARTYPANTS |
@@ -177,7 +188,7 @@ var blockTags = map[string]struct{}{
 // Currently Html, XML2RFC v3 and XML2RFC v2 implementations are provided.
 type Renderer interface {
 	// block-level callbacks
-	BlockCode(out *bytes.Buffer, text []byte, lang string, caption []byte, subfigure bool, callouts bool)
+	BlockCode(out *bytes.Buffer, text []byte, info CodeInfo, caption []byte, subfigure bool, callouts bool)
 	BlockQuote(out *bytes.Buffer, text []byte, attribution []byte)
 	BlockHtml(out *bytes.Buffer, text []byte)
 	CommentHtml(out *bytes.Buffer, text []byte)
@@ -199,7 +210,7 @@ type Renderer interface {
 
 	Footnotes(out *bytes.Buffer, text func() bool)
 	FootnoteItem(out *bytes.Buffer, name, text []byte, flags int)
-	TitleBlockTOML(out *bytes.Buffer, data *title)
+	TitleBlockTOML(out *bytes.Buffer, data *TitleBlock)
 	Aside(out *bytes.Buffer, text []byte)
 	Figure(out *bytes.Buffer, text []byte, caption []byte)
 
@@ -223,6 +234,8 @@ type Renderer interface {
 	TripleEmphasis(out *bytes.Buffer, text []byte)
 	StrikeThrough(out *bytes.Buffer, text []byte)
 	FootnoteRef(out *bytes.Buffer, ref []byte, id int)
+	// Index renders an index entry, a renderer that marks the start and end of
+	// ranges also implements IndexRange(out, primary, secondary, prim, span).
 	Index(out *bytes.Buffer, primary, secondary []byte, prim bool)
 	Citation(out *bytes.Buffer, link, title []byte)
 	Abbreviation(out *bytes.Buffer, abbr, title []byte)
@@ -262,15 +275,33 @@ type parser struct {
 	r                    Renderer
 	refs                 map[string]*reference
 	citations            map[string]*citation
+	internal             map[string]string // anchors cited without a reference, see internalAnchors
+	groups               map[string]string // extra reference sections, see referenceTitles
+	aliases              map[string]string // cited anchor to the real anchor, see canonicalAnchor
 	abbreviations        map[string]*abbreviation
 	examples             map[string]int
 	callouts             map[string][]string
-	codeBlock            int // count codeblock for callout ID generation
+	codeBlock            int                      // count codeblock for callout ID generation
+	components           []component              // code blocks for the Code Components appendix
+	contributors         []author                 // title block contributors for the Contributors section
+	anchorAliases        map[string]string        // former header IDs, see headerAliases
+	anchorRefs           []anchorRef              // cross references, see renamedAnchors
+	elementAnchors       map[string]int           // anchors of sections and figures to their line, see anchorConflicts
+	captionAnchors       map[string]int           // generated figure and table anchors to their line, see captionAnchor
+	indexRanges          map[string]int           // started index ranges to their line, see indexRange
+	acknowledgements     string                   // title block text for the Acknowledgements section
+	includes             []includeFrame           // the files being included, see pushInclude
+	bibliography         bibliography             // title block sources of the references, see referenceSources
+	section              *section                 // the section ParseSection renders
+	translit             translitState            // see transliterateBlock
+	phases               map[string]time.Duration // time per phase, nil if not timed, see reportPhases
 	inlineCallback       [256]inlineParser
 	flags                int
 	nesting              int
 	maxNesting           int
+	tooDeep              bool // warned about content nested deeper than maxNesting
 	insideLink           bool
+	insideInline         bool // timing the inline phase, see reportPhases
 	insideDefinitionList bool // when in def. list ... TODO(miek):doc
 	insideList           int  // list in list counter
 	insideFigure         bool // when inside a F> paragraph
@@ -279,7 +310,8 @@ type parser struct {
 	// Footnotes need to be ordered as well as available to quickly check for
 	// presence. If a ref is also a footnote, it's stored both in refs and here
 	// in notes. Slice is nil if footnotes not enabled.
-	notes []*reference
+	notes       []*reference
+	noteSection int // top level sections seen, for FootnotesPerSection
 
 	appendix   bool // have we seen a {backmatter}?
 	titleblock bool // have we seen a titleblock
@@ -294,6 +326,18 @@ type parser struct {
 	// Prevent identical header anchors by appending -<sequence_number> starting
 	// with -1, this is the same thing that pandoc does.
 	anchors map[string]int
+
+	// Source line tracking: lines holds the input line of every line the first pass
+	// outputs, line is the input line of the top level block being parsed.
+	lines        []int
+	line         int
+	input        []byte // top level input of the second pass
+	lineOffset   int    // how far we have counted newlines in input
+	lineCount    int
+	paragraphSrc []byte // source of the top level paragraph being rendered
+
+	// When not nil diagnostics are collected here instead of being logged.
+	diagnostics *[]Diagnostic
 }
 
 // Markdown is an io.Writer. Writing a buffer with markdown text will be converted to
@@ -336,9 +380,54 @@ func (m *Markdown) render() {
 // The supplied Renderer is used to format the output, and extensions dictates
 // which non-standard extensions are enabled.
 //
+// Input is never modified and no references to it are kept after Parse returns,
+// so it can be a read-only memory mapping of a file that is unmapped afterwards.
+// The first pass copies input once, expanding tabs and resolving includes; input
+// with CR newlines is copied once more to normalize them.
+//
 // To use the supplied Html or XML renderers, see HtmlRenderer, XmlRenderer and
 // Xml2Renderer, respectively.
 func Parse(input []byte, renderer Renderer, extensions int) *bytes.Buffer {
+	return parse(input, renderer, extensions, nil)
+}
+
+// ParseDiagnostics is like Parse, but instead of logging them, it returns the
+// diagnostics seen while parsing and rendering.
+func ParseDiagnostics(input []byte, renderer Renderer, extensions int) (*bytes.Buffer, []Diagnostic) {
+	diagnostics := []Diagnostic{}
+	out := parse(input, renderer, extensions, &diagnostics)
+	return out, diagnostics
+}
+
+// Renderers in this package report their diagnostics through the parser.
+type parserSetter interface {
+	setParser(p *parser)
+}
+
+// wrapped returns the renderer r embeds when it adds to another renderer, or nil.
+// Methods outside the Renderer interface are found on the renderer it wraps.
+func wrapped(r Renderer) Renderer {
+	switch r := r.(type) {
+	case *symbols:
+		return r.Renderer
+	case *review:
+		return r.Renderer
+	case *issues:
+		return r.Renderer
+	case *links:
+		return r.Renderer
+	case *section:
+		return r.Renderer
+	case *slides:
+		return r.Renderer
+	case *reflow:
+		return r.Renderer
+	}
+	return nil
+}
+
+// parse parses and renders input.
+func parse(input []byte, renderer Renderer, extensions int, diagnostics *[]Diagnostic) *bytes.Buffer {
 	// no point in parsing if we can't render
 	if renderer == nil {
 		return nil
@@ -347,13 +436,17 @@ func Parse(input []byte, renderer Renderer, extensions int) *bytes.Buffer {
 	// fill in the render structure
 	p := new(parser)
 	p.r = renderer
+	p.diagnostics = diagnostics
+	if r, ok := renderer.(parserSetter); ok {
+		r.setParser(p)
+	}
 	p.flags = extensions
 	p.refs = make(map[string]*reference)
 	p.abbreviations = make(map[string]*abbreviation)
 	p.anchors = make(map[string]int)
 	p.examples = make(map[string]int)
 	// newly created in 'callouts'
-	p.maxNesting = 16
+	p.maxNesting = maxNesting(p)
 	p.insideLink = false
 
 	// register inline parsers
@@ -375,6 +468,14 @@ func Parse(input []byte, renderer Renderer, extensions int) *bytes.Buffer {
 		p.inlineCallback[':'] = autoLink
 	}
 
+	if extensions&EXTENSION_ISSUE_LINKS != 0 {
+		p.inlineCallback['#'] = issueLink
+	}
+
+	if extensions&EXTENSION_EMOJI != 0 {
+		p.inlineCallback[':'] = emojiShortcode // also calls autoLink
+	}
+
 	if extensions&EXTENSION_FOOTNOTES != 0 {
 		p.notes = make([]*reference, 0)
 	}
@@ -382,10 +483,29 @@ func Parse(input []byte, renderer Renderer, extensions int) *bytes.Buffer {
 	if extensions&EXTENSION_CITATION != 0 {
 		p.inlineCallback['@'] = citationReference // @ref, short form of citations
 		p.citations = make(map[string]*citation)
+		if extensions&EXTENSION_RFC_MENTIONS != 0 {
+			p.inlineCallback['R'] = rfcMention
+		}
+	}
+
+	input = normalizeInput(input)
+	if _, ok := MetricsHook.(PhaseMetrics); ok || VerboseTiming {
+		p.phases = make(map[string]time.Duration)
+	}
+	if MetricsHook == nil && p.phases == nil {
+		first := firstPass(p, input, 0)
+		return secondPass(p, first.Bytes(), 0)
 	}
 
+	start := time.Now()
 	first := firstPass(p, input, 0)
+	parsed := time.Now()
 	second := secondPass(p, first.Bytes(), 0)
+	rendered := time.Since(parsed)
+	if MetricsHook != nil {
+		MetricsHook.Document(backendName(renderer), parsed.Sub(start), rendered)
+	}
+	p.reportPhases(parsed.Sub(start), rendered)
 	return second
 }
 
@@ -398,22 +518,31 @@ func Parse(input []byte, renderer Renderer, extensions int) *bytes.Buffer {
 // - include includes
 func firstPass(p *parser, input []byte, depth int) *bytes.Buffer {
 	var out bytes.Buffer
-	if depth > 8 {
-		printf(p, "nested includes depth > 8")
-		out.WriteByte('\n')
-		return &out
+
+	// fencedCode needs a newline at the end, the slice expression makes append copy
+	// input instead of writing after its end
+	fenced := input
+	if len(input) > 0 && input[len(input)-1] != '\n' {
+		fenced = append(input[:len(input):len(input)], '\n')
 	}
 
 	tabSize := _TAB_SIZE_DEFAULT
 	beg, end := 0, 0
 	lastFencedCodeBlockEnd := 0
+	line, counted := 1, 0
 	for beg < len(input) { // iterate over lines
+		if depth == 0 {
+			line += bytes.Count(input[counted:beg], []byte("\n"))
+			counted = beg
+			p.line = line
+		}
 		if beg >= lastFencedCodeBlockEnd { // don't parse inside fenced code blocks
 			if end = isReference(p, input[beg:], tabSize); end > 0 {
 				beg += end
 				continue
 			}
 		}
+		outLen := out.Len()
 		// skip to the next line
 		end = beg
 		for end < len(input) && input[end] != '\n' && input[end] != '\r' {
@@ -424,7 +553,7 @@ func firstPass(p *parser, input []byte, depth int) *bytes.Buffer {
 			// track fenced code block boundaries to suppress tab expansion
 			// inside them:
 			if beg >= lastFencedCodeBlockEnd {
-				if i := p.fencedCode(&out, append(input[beg:], '\n'), false); i > 0 {
+				if i := p.fencedCode(&out, fenced[beg:], false); i > 0 {
 					lastFencedCodeBlockEnd = beg + i
 				}
 			}
@@ -447,6 +576,12 @@ func firstPass(p *parser, input []byte, depth int) *bytes.Buffer {
 		}
 		out.WriteByte('\n')
 
+		if depth == 0 {
+			for n := bytes.Count(out.Bytes()[outLen:], []byte("\n")); n > 0; n-- {
+				p.lines = append(p.lines, line)
+			}
+		}
+
 		if end < len(input) && input[end] == '\r' {
 			end++
 		}
@@ -464,42 +599,140 @@ func firstPass(p *parser, input []byte, depth int) *bytes.Buffer {
 	return &out
 }
 
+// trackLine sets p.line to the input line of data, which must be a suffix of the
+// top level input of the second pass.
+func (p *parser) trackLine(data []byte) {
+	if p.input == nil || p.nesting != 1 {
+		return
+	}
+	offset := len(p.input) - len(data)
+	p.lineCount += bytes.Count(p.input[p.lineOffset:offset], []byte("\n"))
+	p.lineOffset = offset
+	if p.lineCount < len(p.lines) {
+		p.line = p.lines[p.lineCount]
+	}
+}
+
+// lineAt returns the input line that is n lines into the top level block being
+// parsed, or p.line when that is not known.
+func (p *parser) lineAt(n int) int {
+	if p.input == nil || p.nesting != 1 || p.lineCount+n >= len(p.lines) {
+		return p.line
+	}
+	return p.lines[p.lineCount+n]
+}
+
+// paragraphLines returns the input lines of the top level paragraph being
+// rendered, or nil when they are not known.
+func (p *parser) paragraphLines() []int {
+	if p.input == nil || p.paragraphSrc == nil {
+		return nil
+	}
+	n := bytes.Count(p.paragraphSrc, []byte("\n"))
+	if p.lineCount+n > len(p.lines) {
+		return nil
+	}
+	return p.lines[p.lineCount : p.lineCount+n]
+}
+
+// FootnotesPerSection places the footnotes at the end of each top level section,
+// instead of at the end of the document, and numbers them per section.
+var FootnotesPerSection = false
+
+// footnotes renders the footnotes seen so far.
+func (p *parser) footnotes(out *bytes.Buffer) {
+	if p.flags&EXTENSION_FOOTNOTES == 0 || len(p.notes) == 0 {
+		return
+	}
+	p.r.Footnotes(out, func() bool {
+		flags := _LIST_ITEM_BEGINNING_OF_LIST
+		for i := 0; i < len(p.notes); i += 1 {
+			var buf bytes.Buffer
+			ref := p.notes[i]
+			if ref.hasBlock {
+				flags |= _LIST_ITEM_CONTAINS_BLOCK
+				p.block(&buf, ref.title)
+			} else {
+				p.inline(&buf, ref.title)
+			}
+			p.r.FootnoteItem(out, p.noteName(ref.link), buf.Bytes(), flags)
+			flags &^= _LIST_ITEM_BEGINNING_OF_LIST | _LIST_ITEM_CONTAINS_BLOCK
+		}
+
+		return true
+	})
+	p.notes = p.notes[:0]
+}
+
+// sectionFootnotes renders the footnotes of the previous section when a top level
+// section starts and FootnotesPerSection is set.
+func (p *parser) sectionFootnotes(out *bytes.Buffer, level int) {
+	if FootnotesPerSection && level == 1 && p.nesting == 1 {
+		p.footnotes(out)
+		p.noteSection++
+	}
+}
+
+// noteName returns the name of footnote link. With FootnotesPerSection a footnote
+// can be in more than one section, the name is prefixed with the section number
+// to keep the ids in the output unique.
+func (p *parser) noteName(link []byte) []byte {
+	if !FootnotesPerSection {
+		return link
+	}
+	return append([]byte(strconv.Itoa(p.noteSection)+"-"), link...)
+}
+
+// references renders the references section(s) of the citations.
+func (p *parser) references(out *bytes.Buffer) {
+	defer p.phaseEnd("references", p.phaseStart())
+	p.referenceSources()
+	p.unversionedDrafts()
+	p.r.References(out, p.citations)
+}
+
 // second pass: actual rendering
 func secondPass(p *parser, input []byte, depth int) *bytes.Buffer {
 	var output bytes.Buffer
 
+	if depth == 0 && CheckCapabilities {
+		p.checkCapabilities(input)
+	}
 	p.r.DocumentHeader(&output, depth == 0)
 	p.headerLen = output.Len()
+	if depth == 0 {
+		p.input = input
+	}
 	p.block(&output, input)
+	p.input = nil
+	p.line = 0
 
-	if p.flags&EXTENSION_FOOTNOTES != 0 && len(p.notes) > 0 {
-		p.r.Footnotes(&output, func() bool {
-			flags := _LIST_ITEM_BEGINNING_OF_LIST
-			for i := 0; i < len(p.notes); i += 1 {
-				var buf bytes.Buffer
-				ref := p.notes[i]
-				if ref.hasBlock {
-					flags |= _LIST_ITEM_CONTAINS_BLOCK
-					p.block(&buf, ref.title)
-				} else {
-					p.inline(&buf, ref.title)
-				}
-				p.r.FootnoteItem(&output, ref.link, buf.Bytes(), flags)
-				flags &^= _LIST_ITEM_BEGINNING_OF_LIST | _LIST_ITEM_CONTAINS_BLOCK
-			}
-
-			return true
-		})
-	}
+	p.footnotes(&output)
 	if !p.appendix {
-		if len(p.citations) > 0 {
+		if len(p.citations) > 0 || len(p.components) > 0 || len(p.contributors) > 0 || p.acknowledgements != "" {
 			// appendix not started in doc, start it now and output references
 			p.r.DocumentMatter(&output, _DOC_BACK_MATTER)
-			p.r.References(&output, p.citations)
+			if len(p.citations) > 0 {
+				p.references(&output)
+			}
 		}
 		p.appendix = true
 	}
+	if depth == 0 {
+		p.renamedAnchors()
+		p.anchorConflicts()
+		p.openIndexRanges()
+		p.codeComponents(&output)
+		p.acknowledgementsSection(&output)
+		p.contributorsSection(&output)
+	}
 	p.r.DocumentFooter(&output, depth == 0)
+	if depth == 0 {
+		p.transliterateRest(&output)
+	}
+	if depth == 0 && Colophon {
+		p.colophon(&output)
+	}
 
 	if p.nesting != 0 {
 		panic("Nesting level did not end at zero")
@@ -557,6 +790,8 @@ type citation struct {
 	xml   []byte // raw include of reference XML
 	typ   byte   // 'i' for informal, 'n' normative (default = 'i')
 	seq   int    // sequence number for I-Ds
+	file  string // reference file from the title block, see referenceSources
+	line  int    // of the first citation
 }
 
 // Check whether or not data starts with a reference link.
@@ -932,7 +1167,12 @@ func (p *parser) include(out *bytes.Buffer, data []byte, depth int) int {
 		}
 	}
 
-	input := parseAddress(address, filename)
+	trace(p, "include", "file", string(filename), "address", string(address), "depth", depth+1)
+	if !p.pushInclude(string(filename)) {
+		return end
+	}
+	defer p.popInclude()
+	input := parseAddress(p, address, filename)
 	if input == nil {
 		return end
 	}
@@ -979,8 +1219,8 @@ func (p *parser) codeInclude(out *bytes.Buffer, data []byte) int {
 	// language we use it as the lang (and we will emit <sourcecode>)
 	if x := path.Ext(string(filename)); x != "" {
 		// x includes the dot
-		if _, ok := SourceCodeTypes[x[1:]]; ok {
-			lang = x[1:]
+		if l := codeLanguage(x[1:]); SourceCodeTypes[x[1:]] || l != x[1:] {
+			lang = l
 		}
 	}
 
@@ -1001,7 +1241,8 @@ func (p *parser) codeInclude(out *bytes.Buffer, data []byte) int {
 		}
 	}
 
-	code := parseAddress(address, filename)
+	trace(p, "code include", "file", string(filename), "address", string(address), "lang", lang)
+	code := parseAddress(p, address, filename)
 
 	if len(code) == 0 {
 		code = []byte{'\n'}
@@ -1042,10 +1283,10 @@ func (p *parser) codeInclude(out *bytes.Buffer, data []byte) int {
 	if co != "" {
 		var callout bytes.Buffer
 		callouts(p, &callout, code, 0, co)
-		p.r.BlockCode(out, callout.Bytes(), lang, caption.Bytes(), p.insideFigure, true)
+		p.r.BlockCode(out, callout.Bytes(), CodeInfo{Lang: lang}, caption.Bytes(), p.insideFigure, true)
 	} else {
 		p.callouts = nil
-		p.r.BlockCode(out, code, lang, caption.Bytes(), p.insideFigure, false)
+		p.r.BlockCode(out, code, CodeInfo{Lang: lang}, caption.Bytes(), p.insideFigure, false)
 	}
 	p.r.SetAttr(nil) // reset it again. TODO(miek): double check
 
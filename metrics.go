@@ -0,0 +1,53 @@
+// Hooks to export metrics about conversions, e.g. to Prometheus.
+
+package mmark
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metrics receives measurements of every document that is parsed. Set
+// MetricsHook to an implementation to collect them; mmark itself doesn't depend
+// on any metrics library.
+type Metrics interface {
+	// Document is called when a document is done, with the backend that rendered
+	// it (html, xml, xml2, slides or symbols when only symbols were extracted) and
+	// the time spent in the parse (first) pass and the render (second) pass.
+	Document(backend string, parse, render time.Duration)
+	// Diagnostic is called for every diagnostic reported.
+	Diagnostic(backend string, severity Severity)
+}
+
+// MetricsHook, when not nil, receives the metrics of all documents parsed.
+var MetricsHook Metrics
+
+// backendName returns the name used in Metrics for renderer r.
+func backendName(r Renderer) string {
+	switch r := r.(type) {
+	case *html:
+		return "html"
+	case *xml:
+		return "xml"
+	case *xml2:
+		return "xml2"
+	case *slides:
+		return "slides"
+	case *symbols:
+		if r.render {
+			return backendName(r.Renderer)
+		}
+		return "symbols"
+	case *review:
+		return backendName(r.Renderer)
+	case *issues:
+		return backendName(r.Renderer)
+	case *links:
+		return backendName(r.Renderer)
+	case *section:
+		return backendName(r.Renderer)
+	case *reflow:
+		return "reflow"
+	}
+	return fmt.Sprintf("%T", r)
+}
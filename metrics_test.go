@@ -0,0 +1,66 @@
+package mmark
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	documents   map[string]int
+	diagnostics map[Severity]int
+}
+
+func (m *testMetrics) Document(backend string, parse, render time.Duration) { m.documents[backend]++ }
+func (m *testMetrics) Diagnostic(backend string, s Severity)                { m.diagnostics[s]++ }
+
+func TestMetricsHook(t *testing.T) {
+	m := &testMetrics{map[string]int{}, map[Severity]int{}}
+	MetricsHook = m
+	defer func() { MetricsHook = nil }()
+
+	Parse([]byte("# One\n\n~~gone~~\n"), Xml2Renderer(0), 0)
+	Symbols([]byte("# One\n"), 0)
+	if m.documents["xml2"] != 1 || m.documents["symbols"] != 1 {
+		t.Errorf("unexpected documents: %v", m.documents)
+	}
+	if m.diagnostics[SeverityWarning] != 1 {
+		t.Errorf("unexpected diagnostics: %v", m.diagnostics)
+	}
+}
+
+type testPhaseMetrics struct {
+	testMetrics
+	phases []Phase
+}
+
+func (m *testPhaseMetrics) Phases(backend string, phases []Phase) { m.phases = phases }
+
+func TestPhaseMetrics(t *testing.T) {
+	m := &testPhaseMetrics{testMetrics: testMetrics{map[string]int{}, map[Severity]int{}}}
+	MetricsHook = m
+	defer func() { MetricsHook = nil }()
+
+	input := "% title = \"x\"\n\n# One\n\nSome *text* [@RFC2119].\n"
+	Parse([]byte(input), XmlRenderer(0), EXTENSION_TITLEBLOCK_TOML|EXTENSION_CITATION)
+	names := []string{}
+	for _, p := range m.phases {
+		names = append(names, p.Name)
+	}
+	if actual := strings.Join(names, ","); actual != "first pass,title block,blocks,inline,references,validation" {
+		t.Errorf("unexpected phases: %s", actual)
+	}
+	if m.documents["xml"] != 1 {
+		t.Errorf("unexpected documents: %v", m.documents)
+	}
+}
+
+func TestVerboseTiming(t *testing.T) {
+	VerboseTiming = true
+	defer func() { VerboseTiming = false }()
+
+	_, diags := ParseDiagnostics([]byte("# One\n"), HtmlRenderer(0, "", ""), 0)
+	if len(diags) != 6 || !strings.HasPrefix(diags[3].Message, "timing: inline ") || diags[3].Severity != SeverityInfo {
+		t.Errorf("expected the timings, got %v", diags)
+	}
+}
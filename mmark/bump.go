@@ -0,0 +1,99 @@
+package main
+
+// Bump the revision of a draft and check it agrees with the file name and the
+// changes section.
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/mmark"
+)
+
+var (
+	docNameLine = regexp.MustCompile(`(?m)^(%?\s*docName\s*=\s*")([^"]*)(")`)
+	changesLine = regexp.MustCompile(`(?mi)^#+\s*changes\s+(since|from)\b(.*)$`)
+	revision    = regexp.MustCompile(`(\d+)\D*$`)
+)
+
+// bump implements mmark bump [-n] file.
+func bump(args []string) {
+	fs := flag.NewFlagSet("bump", flag.ExitOnError)
+	check := fs.Bool("n", false, "only check the revision, don't increment it")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s bump [options] inputfile\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	file := fs.Arg(0)
+
+	input, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("error reading from %s: %v", file, err)
+	}
+	m := docNameLine.FindSubmatchIndex(input)
+	if m == nil {
+		log.Fatalf("no docName in the title block of %s", file)
+	}
+	docName := string(input[m[4]:m[5]])
+	name, rev := mmark.DocNameRevision(docName)
+	if rev < 0 {
+		log.Fatalf("docName %s has no -NN revision", docName)
+	}
+
+	// The file name is still for the revision before it is incremented.
+	fileDocName := docName
+	if !*check {
+		if rev == 99 {
+			log.Fatalf("docName %s can't be incremented", docName)
+		}
+		rev++
+		docName = fmt.Sprintf("%s-%02d", name, rev)
+		input = append(input[:m[4]:m[4]], append([]byte(docName), input[m[5]:]...)...)
+		if err := ioutil.WriteFile(file, input, 0644); err != nil {
+			log.Fatalf("error writing %s: %v", file, err)
+		}
+		fmt.Println(docName)
+	}
+
+	if problems := checkRevision(file, fileDocName, docName, rev, string(input)); len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, p)
+		}
+		os.Exit(exitError)
+	}
+}
+
+// checkRevision returns the ways in which the file name doesn't agree with
+// fileDocName and the changes sections don't agree with docName at revision rev.
+func checkRevision(file, fileDocName, docName string, rev int, input string) []string {
+	problems := []string{}
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if _, fileRev := mmark.DocNameRevision(base); fileRev >= 0 && base != fileDocName {
+		problems = append(problems, fmt.Sprintf("file name is for %s, docName is %s", base, fileDocName))
+	}
+
+	headers := changesLine.FindAllStringSubmatch(input, -1)
+	if rev == 0 || len(headers) == 0 {
+		return problems
+	}
+	for _, h := range headers {
+		if r := revision.FindStringSubmatch(h[2]); r != nil {
+			if n, _ := strconv.Atoi(r[1]); n == rev-1 {
+				return problems
+			}
+		}
+	}
+	return append(problems, fmt.Sprintf("no changes section since -%02d", rev-1))
+}
@@ -0,0 +1,186 @@
+package main
+
+// Read the settings for the command line flags from a TOML config file.
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"github.com/miekg/mmark"
+)
+
+// config holds the flags per output target, for instance:
+//
+//	target = "xml2"
+//	profile = "ietf"
+//	rfc7328 = false
+//	post = ["s/Internet-Draft/I-D/"]
+//
+//	[html]
+//	css = "style.css"
+//	page = true
+//
+//	[xml2]
+//	page = true
+//
+//	[bib]
+//	rfc = "https://example.org/bibxml/"
+//
+//	[code-aliases]
+//	shell = "bash"
+//
+// The same settings can be given in a [mmark] table in the TOML title block of the
+// document, those override the config file:
+//
+//	% [mmark.html]
+//	% css = "draft.css"
+//
+// Flags given on the command line override the values from both.
+type config struct {
+	Target  string
+	Profile string
+	Rfc7328 bool
+	Post    []string
+
+	HTML struct {
+		Css  string
+		Head string
+		Page bool
+	}
+	XML struct {
+		Page bool
+	}
+	XML2 struct {
+		Page bool
+	}
+	Bib struct {
+		RFC      string
+		ID       string
+		Template string
+	}
+	CodeAliases map[string]string `toml:"code-aliases"`
+}
+
+// readConfig reads file and sets every flag that was not set before.
+func readConfig(file string) error {
+	c := config{}
+	if _, err := toml.DecodeFile(file, &c); err != nil {
+		return err
+	}
+	c.apply()
+	return nil
+}
+
+// readDocumentConfig sets every flag that was not set before from the [mmark] table
+// in the TOML title block at the start of input.
+func readDocumentConfig(input []byte) error {
+	block := titleBlockSource(input)
+	if block == nil {
+		return nil
+	}
+	doc := struct{ Mmark *config }{}
+	if _, err := toml.Decode(string(block), &doc); err != nil {
+		return err
+	}
+	if doc.Mmark != nil {
+		doc.Mmark.apply()
+	}
+	return nil
+}
+
+// titleBlockSource returns the TOML of the title block at the start of input, either
+// the lines starting with % or the lines between two %%% lines.
+func titleBlockSource(input []byte) []byte {
+	lines := bytes.SplitAfter(input, []byte("\n"))
+	i := 0
+	for i < len(lines) && len(bytes.TrimSpace(lines[i])) == 0 {
+		i++
+	}
+	if i == len(lines) || !bytes.HasPrefix(lines[i], []byte("%")) {
+		return nil
+	}
+	block := []byte{}
+	if bytes.Equal(bytes.TrimSpace(lines[i]), []byte("%%%")) {
+		for i++; i < len(lines) && !bytes.Equal(bytes.TrimSpace(lines[i]), []byte("%%%")); i++ {
+			block = append(block, lines[i]...)
+		}
+		return block
+	}
+	for ; i < len(lines) && bytes.HasPrefix(lines[i], []byte("%")); i++ {
+		block = append(block, lines[i][1:]...)
+	}
+	return block
+}
+
+// apply sets every flag of c that was not set before, on the command line or by an
+// earlier apply.
+func (c config) apply() {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	setFlag := func(name, value string) {
+		if !set[name] && value != "" {
+			flag.Set(name, value)
+		}
+	}
+
+	target := c.Target
+	switch {
+	case set["xml"]:
+		target = "xml"
+	case set["xml2"]:
+		target = "xml2"
+	}
+
+	switch target {
+	case "xml":
+		setFlag("xml", "true")
+		setFlag("page", strconv.FormatBool(c.XML.Page))
+	case "xml2":
+		setFlag("xml2", "true")
+		setFlag("page", strconv.FormatBool(c.XML2.Page))
+	default:
+		setFlag("page", strconv.FormatBool(c.HTML.Page))
+		setFlag("css", c.HTML.Css)
+		setFlag("head", c.HTML.Head)
+	}
+	setFlag("profile", c.Profile)
+	setFlag("rfc7328", strconv.FormatBool(c.Rfc7328))
+	setFlag("bib-rfc", c.Bib.RFC)
+	setFlag("bib-id", c.Bib.ID)
+	setFlag("bib-template", c.Bib.Template)
+	for _, step := range c.Post {
+		setFlag("post", step)
+	}
+	if !set["code-aliases"] {
+		for k, v := range c.CodeAliases {
+			if _, ok := mmark.CodeLanguageAliases[strings.ToLower(k)]; !ok {
+				mmark.CodeLanguageAliases[strings.ToLower(k)] = v
+			}
+		}
+	}
+}
+
+// readTransliterations adds the transliterations in file, one character per key:
+//
+//	"ő" = "o"
+//	"ĳ" = "ij"
+func readTransliterations(file string) error {
+	t := map[string]string{}
+	if _, err := toml.DecodeFile(file, &t); err != nil {
+		return err
+	}
+	for k, v := range t {
+		r, size := utf8.DecodeRuneInString(k)
+		if size != len(k) || r == utf8.RuneError {
+			return fmt.Errorf("%q is not a single character", k)
+		}
+		mmark.Transliterations[r] = v
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+// Output diagnostics in a format editors and CI systems understand.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/miekg/mmark"
+)
+
+// Exit codes used when diagnostics are requested.
+const (
+	exitOK      = 0
+	exitFatal   = 1 // used by log.Fatal
+	exitError   = 2 // an error was diagnosed
+	exitWarning = 3 // only warnings were diagnosed
+)
+
+// exitCode returns the exit code for the most severe diagnostic in diags.
+func exitCode(diags []mmark.Diagnostic) int {
+	code := exitOK
+	for _, d := range diags {
+		switch d.Severity {
+		case mmark.SeverityError:
+			return exitError
+		case mmark.SeverityWarning:
+			code = exitWarning
+		}
+	}
+	return code
+}
+
+// writeDiagnostics writes diags for file in format, which is one of text, json or sarif.
+func writeDiagnostics(w io.Writer, format, file string, diags []mmark.Diagnostic) error {
+	switch format {
+	case "text":
+		for _, d := range diags {
+			fmt.Fprintf(w, "%s:%d: %s: %s\n", file, d.Line, d.Severity, d.Message)
+		}
+	case "json":
+		enc := json.NewEncoder(w)
+		for _, d := range diags {
+			if err := enc.Encode(jsonDiagnostic{file, d.Line, d.Severity.String(), d.Message}); err != nil {
+				return err
+			}
+		}
+	case "sarif":
+		return json.NewEncoder(w).Encode(sarif(file, diags))
+	default:
+		return fmt.Errorf("unknown diagnostics format: %s", format)
+	}
+	return nil
+}
+
+// writeDropped writes how often each construct the renderer could not output was
+// seen in file, most often first.
+func writeDropped(w io.Writer, file string, diags []mmark.Diagnostic) {
+	count := map[string]int{}
+	constructs := []string{}
+	for _, d := range diags {
+		if d.Construct == "" {
+			continue
+		}
+		if count[d.Construct] == 0 {
+			constructs = append(constructs, d.Construct)
+		}
+		count[d.Construct]++
+	}
+	sort.SliceStable(constructs, func(i, j int) bool { return count[constructs[i]] > count[constructs[j]] })
+	for _, c := range constructs {
+		fmt.Fprintf(w, "%s: dropped %s %d time(s)\n", file, c, count[c])
+	}
+}
+
+type jsonDiagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// sarif returns a minimal SARIF 2.1.0 log with a single run.
+func sarif(file string, diags []mmark.Diagnostic) interface{} {
+	type object map[string]interface{}
+	results := []object{}
+	for _, d := range diags {
+		level := "note"
+		switch d.Severity {
+		case mmark.SeverityWarning:
+			level = "warning"
+		case mmark.SeverityError:
+			level = "error"
+		}
+		physical := object{"artifactLocation": object{"uri": file}}
+		if d.Line > 0 {
+			physical["region"] = object{"startLine": d.Line}
+		}
+		results = append(results, object{
+			"level":     level,
+			"message":   object{"text": d.Message},
+			"locations": []object{{"physicalLocation": physical}},
+		})
+	}
+	return object{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": []object{{
+			"tool":    object{"driver": object{"name": "mmark", "version": mmark.Version}},
+			"results": results,
+		}},
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+// Check the links of a document for dead ones.
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/mmark"
+)
+
+// checkLinksCmd implements mmark check-links [options] [file]: the document is parsed,
+// but not output, and the dead links are reported. The exit code is non-zero when
+// there are any.
+func checkLinksCmd(args []string) {
+	fs := flag.NewFlagSet("check-links", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 4, "number of links checked at the same time")
+	allowFlag := fs.String("allow", "", "only check the links matching this regular expression")
+	denyFlag := fs.String("deny", "", "don't check the links matching this regular expression")
+	format := fs.String("diagnostics", "text", "write the dead links as text, json or sarif")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s check-links [options] [inputfile]\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var allow, deny *regexp.Regexp
+	var err error
+	if *allowFlag != "" {
+		if allow, err = regexp.Compile(*allowFlag); err != nil {
+			log.Fatalf("error in allow: %v", err)
+		}
+	}
+	if *denyFlag != "" {
+		if deny, err = regexp.Compile(*denyFlag); err != nil {
+			log.Fatalf("error in deny: %v", err)
+		}
+	}
+
+	var input []byte
+	file := "-"
+	switch fs.NArg() {
+	case 0:
+		if input, err = ioutil.ReadAll(os.Stdin); err != nil {
+			log.Fatalf("error reading from standard input: %v", err)
+		}
+	case 1:
+		file = fs.Arg(0)
+		if input, err = ioutil.ReadFile(file); err != nil {
+			log.Fatalf("error reading from %s: %v", file, err)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	_, res, _ := mmark.ParseWith(input, mmark.HtmlRenderer(0, "", ""), commonExtensions(), mmark.ParseOptions{Links: true, Diagnostics: true})
+	diags := checkLinks(res.Links, *concurrency, allow, deny)
+	if err := writeDiagnostics(os.Stdout, *format, file, diags); err != nil {
+		log.Fatalf("error writing diagnostics: %v", err)
+	}
+	os.Exit(exitCode(diags))
+}
+
+// checkLinks does a HEAD request for every http and https link that matches allow (when
+// not nil) and doesn't match deny (when not nil), at most concurrency at the same time.
+// Every dead link is returned as an error diagnostic.
+func checkLinks(links []mmark.Link, concurrency int, allow, deny *regexp.Regexp) []mmark.Diagnostic {
+	targets := []string{}
+	status := map[string]string{}
+	for _, l := range links {
+		if !strings.HasPrefix(l.Target, "http://") && !strings.HasPrefix(l.Target, "https://") {
+			continue
+		}
+		if allow != nil && !allow.MatchString(l.Target) || deny != nil && deny.MatchString(l.Target) {
+			continue
+		}
+		if _, ok := status[l.Target]; !ok {
+			status[l.Target] = ""
+			targets = append(targets, l.Target)
+		}
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, t := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(target string) {
+			defer func() { <-sem; wg.Done() }()
+			s := checkLink(client, target)
+			mu.Lock()
+			status[target] = s
+			mu.Unlock()
+		}(t)
+	}
+	wg.Wait()
+
+	diags := []mmark.Diagnostic{}
+	for _, l := range links {
+		if s := status[l.Target]; s != "" {
+			diags = append(diags, mmark.Diagnostic{Severity: mmark.SeverityError, Line: l.Line, Message: fmt.Sprintf("dead link %s: %s", l.Target, s)})
+		}
+	}
+	return diags
+}
+
+// checkLink returns why target is dead, or the empty string if it is not. Servers that
+// don't allow HEAD are asked with GET.
+func checkLink(client *http.Client, target string) string {
+	resp, err := client.Head(target)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = client.Get(target)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return resp.Status
+	}
+	return ""
+}
@@ -0,0 +1,405 @@
+package main
+
+// A language server (LSP) speaking JSON-RPC on standard input and output.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/miekg/mmark"
+)
+
+// Artwork lines longer than this don't fit in an RFC.
+const maxArtworkLine = 72
+
+type lspMessage struct {
+	ID     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method,omitempty"`
+	Params json.RawMessage  `json:"params,omitempty"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type lspServer struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]string // uri -> text
+
+	syms map[string][]mmark.Symbol // uri -> symbols, parsed when the text changes
+}
+
+// lsp runs the language server until the client tells it to exit.
+func lsp() {
+	s := &lspServer{in: bufio.NewReader(os.Stdin), out: os.Stdout, docs: map[string]string{}, syms: map[string][]mmark.Symbol{}}
+	for {
+		m, err := s.read()
+		if err != nil {
+			if err == io.EOF {
+				return
+			}
+			log.Fatalf("error reading lsp message: %v", err)
+		}
+		if m.Method == "exit" {
+			return
+		}
+		result, err := s.safeHandle(m)
+		if m.ID == nil { // notification
+			continue
+		}
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": m.ID, "result": result}
+		if err != nil {
+			code := -32601 // method not found
+			if _, ok := err.(lspPanic); ok {
+				code = -32603 // internal error
+			}
+			delete(resp, "result")
+			resp["error"] = map[string]interface{}{"code": code, "message": err.Error()}
+		}
+		s.write(resp)
+	}
+}
+
+func (s *lspServer) read() (*lspMessage, error) {
+	length := 0
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "Content-Length:") {
+			length, _ = strconv.Atoi(strings.TrimSpace(line[len("Content-Length:"):]))
+		}
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(s.in, buf); err != nil {
+		return nil, err
+	}
+	m := &lspMessage{}
+	return m, json.Unmarshal(buf, m)
+}
+
+func (s *lspServer) write(v interface{}) {
+	buf, _ := json.Marshal(v)
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(buf), buf)
+}
+
+// lspPanic is the error of a request that panicked.
+type lspPanic struct{ v interface{} }
+
+func (e lspPanic) Error() string { return fmt.Sprintf("internal error: %v", e.v) }
+
+// safeHandle is handle, but a panic is logged and returned as an error, so a
+// document that trips up the parser doesn't stop the server.
+func (s *lspServer) safeHandle(m *lspMessage) (result interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("lsp %s: %v", m.Method, v)
+			result, err = nil, lspPanic{v}
+		}
+	}()
+	return s.handle(m)
+}
+
+func (s *lspServer) handle(m *lspMessage) (interface{}, error) {
+	switch m.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1, // full
+				"documentSymbolProvider": true,
+				"definitionProvider":     true,
+				"completionProvider":     map[string]interface{}{"triggerCharacters": []string{"@", "#"}},
+			},
+		}, nil
+	case "initialized", "shutdown", "$/cancelRequest":
+		return nil, nil
+	case "textDocument/didOpen":
+		var p struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		json.Unmarshal(m.Params, &p)
+		s.update(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		json.Unmarshal(m.Params, &p)
+		if n := len(p.ContentChanges); n > 0 {
+			s.update(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p lspTextDocumentPosition
+		json.Unmarshal(m.Params, &p)
+		delete(s.docs, p.TextDocument.URI)
+		delete(s.syms, p.TextDocument.URI)
+		return nil, nil
+	case "textDocument/documentSymbol":
+		var p lspTextDocumentPosition
+		json.Unmarshal(m.Params, &p)
+		return s.symbols(p.TextDocument.URI), nil
+	case "textDocument/definition":
+		var p lspTextDocumentPosition
+		json.Unmarshal(m.Params, &p)
+		return s.definition(p.TextDocument.URI, p.Position), nil
+	case "textDocument/completion":
+		var p lspTextDocumentPosition
+		json.Unmarshal(m.Params, &p)
+		return s.completion(p.TextDocument.URI), nil
+	}
+	if m.ID == nil {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("method not found: %s", m.Method)
+}
+
+// update stores the new text of uri and publishes its diagnostics.
+func (s *lspServer) update(uri, text string) {
+	s.docs[uri] = text
+	lines := strings.Split(text, "\n")
+
+	// One parse gives both the diagnostics and the symbols. The whole document is
+	// parsed on every change: references, footnotes and anchors are document wide.
+	_, res, _ := mmark.ParseWith([]byte(text), mmark.Xml2Renderer(0), commonExtensions(), mmark.ParseOptions{Symbols: true, Diagnostics: true})
+	diags, syms := res.Diagnostics, res.Symbols
+	s.syms[uri] = syms
+
+	anchors := map[string]bool{}
+	for _, sym := range syms {
+		if sym.Kind != mmark.SymbolXref && sym.Kind != mmark.SymbolCitation && sym.Anchor != "" {
+			anchors[sym.Anchor] = true
+		}
+	}
+	for _, sym := range syms {
+		if sym.Kind == mmark.SymbolXref && !anchors[sym.Anchor] {
+			diags = append(diags, mmark.Diagnostic{Severity: mmark.SeverityError, Line: sym.Line,
+				Message: "cross reference to unknown anchor: " + sym.Anchor})
+		}
+	}
+	diags = append(diags, longArtworkLines(text)...)
+
+	list := []interface{}{}
+	for _, d := range diags {
+		severity := 3 // information
+		switch d.Severity {
+		case mmark.SeverityError:
+			severity = 1
+		case mmark.SeverityWarning:
+			severity = 2
+		}
+		list = append(list, map[string]interface{}{
+			"range":    lineRange(lines, d.Line),
+			"severity": severity,
+			"source":   "mmark",
+			"message":  d.Message,
+		})
+	}
+	s.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/publishDiagnostics",
+		"params":  map[string]interface{}{"uri": uri, "diagnostics": list},
+	})
+}
+
+// symbolsOf returns the symbols of the document uri.
+func (s *lspServer) symbolsOf(uri string) []mmark.Symbol { return s.syms[uri] }
+
+// longArtworkLines warns about lines in code blocks that are too long.
+func longArtworkLines(text string) []mmark.Diagnostic {
+	diags := []mmark.Diagnostic{}
+	fence := ""
+	prevBlank, prevCode := true, false
+	for i, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		code := false
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			} else {
+				code = true
+			}
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case (prevBlank || prevCode) && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			code = true
+		}
+		if code && len([]rune(line)) > maxArtworkLine {
+			diags = append(diags, mmark.Diagnostic{Severity: mmark.SeverityWarning, Line: i + 1,
+				Message: fmt.Sprintf("artwork line longer than %d characters", maxArtworkLine)})
+		}
+		prevBlank, prevCode = trimmed == "", code
+	}
+	return diags
+}
+
+func (s *lspServer) symbols(uri string) []interface{} {
+	lines := strings.Split(s.docs[uri], "\n")
+	list := []interface{}{}
+	for _, sym := range s.symbolsOf(uri) {
+		kind := 0
+		switch sym.Kind {
+		case mmark.SymbolSection, mmark.SymbolSpecialSection:
+			kind = 3 // namespace
+		case mmark.SymbolFigure, mmark.SymbolTable:
+			kind = 18 // array
+		case mmark.SymbolAnchor:
+			kind = 20 // key
+		default:
+			continue
+		}
+		name := sym.Name
+		if name == "" {
+			name = sym.Anchor
+		}
+		list = append(list, map[string]interface{}{
+			"name":     name,
+			"kind":     kind,
+			"location": lspLocation{uri, lineRange(lines, sym.Line)},
+		})
+	}
+	return list
+}
+
+// definition returns the location of the anchor referenced at pos.
+func (s *lspServer) definition(uri string, pos lspPosition) interface{} {
+	text := s.docs[uri]
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return nil
+	}
+	anchor := anchorAt(lines[pos.Line], byteColumn(lines[pos.Line], pos.Character))
+	if anchor == "" {
+		return nil
+	}
+	for _, sym := range s.symbolsOf(uri) {
+		if sym.Kind != mmark.SymbolXref && sym.Kind != mmark.SymbolCitation && sym.Anchor == anchor {
+			return lspLocation{uri, lineRange(lines, sym.Line)}
+		}
+	}
+	// A citation defined in the document as a raw XML reference.
+	for i, l := range lines {
+		if strings.Contains(l, `<reference anchor="`+anchor+`"`) {
+			return lspLocation{uri, lineRange(lines, i+1)}
+		}
+	}
+	return nil
+}
+
+// anchorAt returns the anchor in a (#anchor) or @anchor reference around column col.
+func anchorAt(line string, col int) string {
+	isAnchor := func(c byte) bool {
+		return c == '-' || c == '_' || c == ':' || c == '.' || c == '/' ||
+			(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+	}
+	if col > len(line) {
+		col = len(line)
+	}
+	beg, end := col, col
+	for beg > 0 && isAnchor(line[beg-1]) {
+		beg--
+	}
+	for end < len(line) && isAnchor(line[end]) {
+		end++
+	}
+	if beg == 0 || beg == end {
+		return ""
+	}
+	if line[beg-1] == '#' || line[beg-1] == '@' {
+		return line[beg:end]
+	}
+	return ""
+}
+
+// completion returns all anchors and citations used in the document.
+func (s *lspServer) completion(uri string) []interface{} {
+	list := []interface{}{}
+	seen := map[string]bool{}
+	for _, sym := range s.symbolsOf(uri) {
+		if sym.Anchor == "" || seen[sym.Anchor] || sym.Kind == mmark.SymbolXref {
+			continue
+		}
+		seen[sym.Anchor] = true
+		kind := 18 // reference
+		if sym.Kind == mmark.SymbolCitation {
+			kind = 21 // constant
+		}
+		list = append(list, map[string]interface{}{"label": sym.Anchor, "kind": kind, "detail": sym.Name})
+	}
+	return list
+}
+
+// lineRange returns the range of the (1 based) line in lines.
+func lineRange(lines []string, line int) lspRange {
+	if line > 0 {
+		line--
+	}
+	end := 0
+	if line < len(lines) {
+		end = utf16Column(lines[line], len(lines[line]))
+	}
+	return lspRange{lspPosition{line, 0}, lspPosition{line, end}}
+}
+
+// Columns in LSP count UTF-16 code units, the server works with byte offsets.
+
+// utf16Column returns the UTF-16 column of the byte offset col in line.
+func utf16Column(line string, col int) int {
+	n := 0
+	for _, r := range line[:col] {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// byteColumn returns the byte offset of the UTF-16 column col in line.
+func byteColumn(line string, col int) int {
+	n := 0
+	for i, r := range line {
+		if n >= col {
+			return i
+		}
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return len(line)
+}
@@ -12,11 +12,17 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"html/template"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
 
 	"github.com/miekg/mmark"
 )
@@ -25,23 +31,127 @@ var githash string
 
 const DEFAULT_TITLE = ""
 
+// commonExtensions returns the extensions mmark uses.
+func commonExtensions() int {
+	extensions := 0
+	extensions |= mmark.EXTENSION_TABLES
+	extensions |= mmark.EXTENSION_FENCED_CODE
+	extensions |= mmark.EXTENSION_AUTOLINK
+	extensions |= mmark.EXTENSION_SPACE_HEADERS
+	extensions |= mmark.EXTENSION_CITATION
+	extensions |= mmark.EXTENSION_TITLEBLOCK_TOML
+	extensions |= mmark.EXTENSION_HEADER_IDS
+	extensions |= mmark.EXTENSION_AUTO_HEADER_IDS
+	extensions |= mmark.EXTENSION_UNIQUE_HEADER_IDS
+	extensions |= mmark.EXTENSION_FOOTNOTES
+	extensions |= mmark.EXTENSION_SHORT_REF
+	extensions |= mmark.EXTENSION_INCLUDE
+	extensions |= mmark.EXTENSION_PARTS
+	extensions |= mmark.EXTENSION_ABBREVIATIONS
+	extensions |= mmark.EXTENSION_DEFINITION_LISTS
+	extensions |= mmark.EXTENSION_IANA
+	return extensions
+}
+
+// debugLogger logs the debug traces as: msg key=value ...
+type debugLogger struct{}
+
+func (debugLogger) Debug(msg string, args ...interface{}) {
+	for i := 0; i+1 < len(args); i += 2 {
+		msg += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+	log.Print("debug: " + msg)
+}
+
 func main() {
+	// mmark lsp runs the language server.
+	if len(os.Args) == 2 && os.Args[1] == "lsp" {
+		lsp()
+		return
+	}
+	// mmark reflow rewraps the paragraphs.
+	if len(os.Args) > 1 && os.Args[1] == "reflow" {
+		reflow(os.Args[2:])
+		return
+	}
+	// mmark check-links reports the dead links.
+	if len(os.Args) > 1 && os.Args[1] == "check-links" {
+		checkLinksCmd(os.Args[2:])
+		return
+	}
+	// mmark bump increments the revision of the docName.
+	if len(os.Args) > 1 && os.Args[1] == "bump" {
+		bump(os.Args[2:])
+		return
+	}
+
 	// parse command-line options
-	var page, xml, xml2, toml, rfc7328, version bool
-	var css, head string
+	var page, xml, xml2, slides, pn, captions, lof, components, openIssues, issueLinks, emoji, rfcMentions, hardWrap, ascii, toml, rfc7328, strict, debug, version, listExtensions bool
+	var css, head, manifest, defaults, config, diagnostics, tmpl, outline, review, issues, critic, inlineHTML, postCache, translit, bibliography, profile, links, email, newline, includePath, section, codeAliases string
+	var post postSteps
 
 	flag.BoolVar(&page, "page", false, "generate a standalone HTML page")
 	flag.BoolVar(&xml, "xml", false, "generate xml2rfc v3 output")
 	flag.BoolVar(&xml2, "xml2", false, "generate xml2rfc v2 output")
+	flag.BoolVar(&slides, "slides", false, "generate reveal.js HTML slides, -css sets the theme")
+	flag.BoolVar(&pn, "pn", false, "number paragraphs, pn attributes in xml2rfc v3 and ids in HTML")
+	flag.BoolVar(&captions, "captions", false, "number figure and table captions in HTML")
+	flag.BoolVar(&lof, "lof", false, "add a list of figures and a list of tables to HTML")
+	flag.BoolVar(&components, "components", false, "move code blocks with {component=\"true\"} to a Code Components appendix")
+	flag.BoolVar(&mmark.VerboseTiming, "verbose-timing", false, "write the time spent in each phase of the conversion to standard error")
+	flag.BoolVar(&debug, "debug", false, "write debug traces of the parser to standard error")
 	flag.BoolVar(&version, "version", false, "show mmark version")
+	flag.BoolVar(&listExtensions, "list-extensions", false, "list the extensions and renderer flags")
 	flag.StringVar(&css, "css", "", "link to a CSS stylesheet (implies -page)")
 	flag.StringVar(&head, "head", "", "link to HTML to be included in head (implies -page)")
+	flag.StringVar(&tmpl, "template", "", "html/template used to generate a standalone HTML page, HTML output only")
 
 	flag.StringVar(&mmark.CitationsID, "bib-id", mmark.CitationsID, "ID bibliography URL")
 	flag.StringVar(&mmark.CitationsRFC, "bib-rfc", mmark.CitationsRFC, "RFC bibliography URL")
+	flag.StringVar(&mmark.ReferenceFile, "bib-template", "", "text/template for the reference file of a citation, e.g. refs/{{.Anchor}}.xml")
+	flag.BoolVar(&issueLinks, "issue-links", false, "link #123 and org/repo#45 to the issue tracker in HTML")
+	flag.StringVar(&mmark.IssueRepo, "issue-repo", "", "the org/repo #123 refers to (implies -issue-links)")
+	flag.StringVar(&mmark.IssueTracker, "issue-tracker", mmark.IssueTracker, "URL of the issue tracker")
+	flag.StringVar(&mmark.HeaderIDPrefix, "id-prefix", "", "prefix the header IDs created from the header text with this")
+	flag.StringVar(&mmark.HeaderIDSuffix, "id-suffix", "", "suffix the header IDs created from the header text with this")
+	flag.StringVar(&email, "email", "", "hide email addresses in HTML from scrapers: entities, munge or text")
+	flag.StringVar(&newline, "newline", "lf", "newlines of the output: lf or crlf, the input may use either")
+	flag.BoolVar(&emoji, "emoji", false, "turn shortcodes like :warning: into emoji in HTML")
+	flag.BoolVar(&rfcMentions, "rfc-mentions", false, "cite the RFC of a mention like RFC 2119 in the text")
+	flag.BoolVar(&hardWrap, "hard-wrap", false, "keep the line breaks of paragraphs")
+	flag.BoolVar(&mmark.LowercaseKeywords, "lowercase-keywords", false, "lower case the keywords of the title block")
+	flag.BoolVar(&mmark.PrivateAddresses, "private-address", false, "leave out the street addresses and phone numbers of authors")
+	flag.BoolVar(&mmark.FootnotesPerSection, "footnotes-per-section", false, "put the footnotes at the end of each top level section and number them per section")
+	flag.BoolVar(&mmark.FootnoteCref, "footnote-cref", false, "make inline footnotes a cref in xml2rfc output, instead of text between parentheses")
+	flag.BoolVar(&mmark.Colophon, "colophon", false, "add a comment with the mmark version, time and extensions to the output")
+	flag.BoolVar(&ascii, "ascii", false, "transliterate non-ASCII characters in xml2rfc v2 output")
+	flag.StringVar(&translit, "transliterations", "", "TOML file with extra transliterations, like \"é\" = \"e\" (implies -ascii)")
+	flag.StringVar(&codeAliases, "code-aliases", "", "languages of code blocks to output as another language: shell=bash,c++=cc")
+	flag.StringVar(&mmark.Transition, "transition", mmark.Transition, "text a horizontal rule becomes in XML2RFC output, empty for a blank paragraph")
+	flag.IntVar(&mmark.MaxNesting, "max-nesting", mmark.MaxNesting, "how deep lists, quotes and inline elements nest, deeper content is flattened into text")
+	flag.IntVar(&mmark.ParagraphSentences, "sentences", 0, "split top level paragraphs into paragraphs of at most this many sentences")
 
 	flag.BoolVar(&toml, "toml", false, "input file is xml2rfc XML which is convert to TOML titleblock")
 	flag.BoolVar(&rfc7328, "rfc7328", false, "parse RFC 7328 style input")
+	flag.StringVar(&inlineHTML, "inline-html", "", "inline HTML: strip or escape it, by default HTML passes it through and XML maps the tags it knows")
+	flag.StringVar(&critic, "critic", "", "CriticMarkup changes: show, accept or reject them")
+	flag.StringVar(&profile, "profile", "", "use the extensions and flags of a profile: ietf, web or commonmark")
+	flag.StringVar(&review, "review", "", "anchor every top level block in the HTML and write their source lines as JSON to this file")
+	flag.StringVar(&issues, "issues", "", "write the TODO and ISSUE markers in comments as JSON to this file")
+	flag.StringVar(&links, "links", "", "write the link targets as JSON to this file")
+	flag.BoolVar(&openIssues, "open-issues", false, "end the document with an Open Issues section listing the TODO and ISSUE markers")
+	flag.StringVar(&section, "section", "", "output only the section with this anchor and its subsections")
+	flag.StringVar(&outline, "outline", "", "output the section outline with word counts as opml or markdown")
+	flag.StringVar(&bibliography, "bibliography", "", "output only the references as bibxml, bibtex, csl (CSL-JSON) or text")
+	flag.BoolVar(&strict, "strict", false, "fail on constructs the output format can't represent and list them (implies -diagnostics text)")
+	flag.StringVar(&diagnostics, "diagnostics", "", "write diagnostics to standard error as text, json or sarif and set the exit code")
+	flag.StringVar(&config, "config", "", "TOML file with the settings for these flags, per output target")
+	flag.StringVar(&defaults, "defaults", "", "TOML file with title block defaults, used for fields the document leaves unset")
+	flag.StringVar(&includePath, "include-path", "", "list of directories, separated like $PATH, searched for included files")
+	flag.StringVar(&mmark.IncludeRoot, "include-root", "", "only include files below this directory, for untrusted input")
+	flag.StringVar(&manifest, "manifest", "", "assemble the input from the files listed in this TOML manifest")
+	flag.Var(&post, "post", "post-process the output with s/regexp/replacement/, xslt:style.xsl or a shell command (repeatable)")
+	flag.StringVar(&postCache, "post-cache", "", "cache the results of XSLT and command post-processing in this directory")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Mmark Markdown Processor"+
@@ -50,42 +160,73 @@ func main() {
 			"Copyright © 2011 Russ Ross <russ@russross.com>\n"+
 			"Distributed under the Simplified BSD License\n\n"+
 			"Usage:\n"+
-			"  %s [options] [inputfile [outputfile]]\n\n"+
+			"  %s [options] [inputfile [outputfile]]\n"+
+			"  %s reflow [-width n] [-w] [inputfile]\n"+
+			"  %s check-links [-concurrency n] [-allow regexp] [-deny regexp] [inputfile]\n"+
+			"  %s lsp\n\n"+
 			"Options:\n",
-			os.Args[0])
+			os.Args[0], os.Args[0], os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	if version{
+	if version {
 		if githash != "" {
 			githash = "+" + githash
 		}
 		fmt.Printf("%s%s\n", mmark.Version, githash)
 		return
 	}
+	if listExtensions {
+		for _, l := range []struct {
+			title string
+			info  []mmark.ExtensionInfo
+		}{{"extensions", mmark.Extensions()}, {"html", mmark.HtmlFlags()}, {"xml", mmark.XmlFlags()}, {"xml2", mmark.Xml2Flags()}} {
+			fmt.Printf("%s:\n", l.title)
+			for _, e := range l.info {
+				fmt.Printf("  %-28s %s\n", e.Name, e.Description)
+			}
+		}
+		return
+	}
 
-	// enforce implied options
-	if css != "" {
-		page = true
+	if debug {
+		mmark.DebugLogger = debugLogger{}
 	}
-	if head != "" {
-		page = true
+
+	if defaults != "" {
+		d, err := ioutil.ReadFile(defaults)
+		if err != nil {
+			log.Fatalf("error reading defaults %s: %v", defaults, err)
+		}
+		mmark.TitleBlockDefaults = string(d)
 	}
 
 	// read the input
 	var input []byte
 	var err error
 	args := flag.Args()
-	switch len(args) {
-	case 0:
+	switch {
+	case manifest != "":
+		if len(args) > 1 {
+			flag.Usage()
+			return
+		}
+		if input, err = readManifest(manifest); err != nil {
+			log.Fatalf("error reading manifest %s: %v", manifest, err)
+		}
+		// The output file, if any, is the only argument.
+		args = append([]string{manifest}, args...)
+	case len(args) == 0:
 		if input, err = ioutil.ReadAll(os.Stdin); err != nil {
 			log.Fatalf("error reading from standard input: %v", err)
 		}
-	case 1, 2:
-		if input, err = ioutil.ReadFile(args[0]); err != nil {
+	case len(args) == 1, len(args) == 2:
+		var done func()
+		if input, done, err = readInput(args[0]); err != nil {
 			log.Fatalf("error reading from %s: %s", args[0], err)
 		}
+		defer done()
 	default:
 		flag.Usage()
 		return
@@ -97,52 +238,273 @@ func main() {
 		return
 	}
 
-	// set up options
-	extensions := 0
-	extensions |= mmark.EXTENSION_TABLES
-	extensions |= mmark.EXTENSION_FENCED_CODE
-	extensions |= mmark.EXTENSION_AUTOLINK
-	extensions |= mmark.EXTENSION_SPACE_HEADERS
-	extensions |= mmark.EXTENSION_CITATION
-	extensions |= mmark.EXTENSION_TITLEBLOCK_TOML
-	extensions |= mmark.EXTENSION_HEADER_IDS
-	extensions |= mmark.EXTENSION_AUTO_HEADER_IDS
-	extensions |= mmark.EXTENSION_UNIQUE_HEADER_IDS
-	extensions |= mmark.EXTENSION_FOOTNOTES
-	extensions |= mmark.EXTENSION_SHORT_REF
-	extensions |= mmark.EXTENSION_INCLUDE
-	extensions |= mmark.EXTENSION_PARTS
-	extensions |= mmark.EXTENSION_ABBREVIATIONS
-	extensions |= mmark.EXTENSION_DEFINITION_LISTS
+	// The settings in the title block override the config file.
+	if err := readDocumentConfig(input); err != nil {
+		log.Printf("error in the title block settings: %v", err)
+	}
+	if config != "" {
+		if err := readConfig(config); err != nil {
+			log.Fatalf("error reading config %s: %v", config, err)
+		}
+	}
 
+	// enforce implied options
+	if css != "" {
+		page = true
+	}
+	if head != "" {
+		page = true
+	}
+
+	if tmpl != "" && (xml || xml2 || slides) {
+		log.Fatalf("-template only applies to HTML output, not to -xml, -xml2 or -slides")
+	}
+
+	if mmark.ReferenceFile != "" {
+		if _, err := texttemplate.New("bib").Parse(mmark.ReferenceFile); err != nil {
+			log.Fatalf("error in bib-template: %v", err)
+		}
+	}
+
+	// set up options
+	extensions := commonExtensions()
+	prof := mmark.Profile{}
+	if profile != "" {
+		if prof, err = mmark.LookupProfile(profile); err != nil {
+			log.Fatal(err)
+		}
+		extensions = prof.Extensions
+	}
 	if rfc7328 {
 		extensions |= mmark.EXTENSION_RFC7328
 	}
+	if components {
+		extensions |= mmark.EXTENSION_CODE_COMPONENTS
+	}
+	if issueLinks || mmark.IssueRepo != "" {
+		extensions |= mmark.EXTENSION_ISSUE_LINKS
+	}
+	if emoji {
+		extensions |= mmark.EXTENSION_EMOJI
+	}
+	if rfcMentions {
+		extensions |= mmark.EXTENSION_RFC_MENTIONS
+	}
+	if mmark.MaxNesting < 1 {
+		log.Fatalf("max-nesting must be at least 1, not %d", mmark.MaxNesting)
+	}
+	if hardWrap {
+		extensions |= mmark.EXTENSION_HARD_LINE_BREAK
+	}
+	if strict {
+		extensions |= mmark.EXTENSION_STRICT
+		mmark.CheckCapabilities = true
+		if diagnostics == "" {
+			diagnostics = "text"
+		}
+	}
+	switch critic {
+	case "":
+	case "show":
+		extensions |= mmark.EXTENSION_CRITIC
+	case "accept":
+		extensions |= mmark.EXTENSION_CRITIC_ACCEPT
+	case "reject":
+		extensions |= mmark.EXTENSION_CRITIC_REJECT
+	default:
+		log.Fatalf("unknown critic mode: %s", critic)
+	}
+
+	switch inlineHTML {
+	case "", "strip", "escape":
+	default:
+		log.Fatalf("unknown inline HTML policy: %s", inlineHTML)
+	}
 
 	var renderer mmark.Renderer
 	xmlFlags := 0
 	switch {
 	case xml:
+		xmlFlags = prof.XmlFlags
 		if page {
-			xmlFlags = mmark.XML_STANDALONE
+			xmlFlags |= mmark.XML_STANDALONE
+		}
+		if pn {
+			xmlFlags |= mmark.XML_PARAGRAPH_NUMBERS
+		}
+		switch inlineHTML {
+		case "strip":
+			xmlFlags |= mmark.XML_SKIP_HTML
+		case "escape":
+			xmlFlags |= mmark.XML_ESCAPE_HTML
 		}
 		renderer = mmark.XmlRenderer(xmlFlags)
 	case xml2:
+		xmlFlags = prof.Xml2Flags
 		if page {
-			xmlFlags = mmark.XML2_STANDALONE
+			xmlFlags |= mmark.XML2_STANDALONE
+		}
+		switch inlineHTML {
+		case "strip":
+			xmlFlags |= mmark.XML2_SKIP_HTML
+		case "escape":
+			xmlFlags |= mmark.XML2_ESCAPE_HTML
+		}
+		if translit != "" {
+			if err := readTransliterations(translit); err != nil {
+				log.Fatalf("error reading transliterations %s: %v", translit, err)
+			}
+			ascii = true
+		}
+		if ascii {
+			xmlFlags |= mmark.XML2_TRANSLITERATE
 		}
 		renderer = mmark.Xml2Renderer(xmlFlags)
+	case slides:
+		slidesFlags := 0
+		if page {
+			slidesFlags = mmark.SLIDES_STANDALONE
+		}
+		switch inlineHTML {
+		case "strip":
+			slidesFlags |= mmark.SLIDES_SKIP_HTML
+		case "escape":
+			slidesFlags |= mmark.SLIDES_ESCAPE_HTML
+		}
+		renderer = mmark.SlidesRenderer(slidesFlags, css)
 	default:
 		// render the data into HTML
-		htmlFlags := 0
-		if page {
+		htmlFlags := prof.HtmlFlags
+		if page && tmpl == "" { // the template makes the page
 			htmlFlags |= mmark.HTML_COMPLETE_PAGE
 		}
-		renderer = mmark.HtmlRenderer(htmlFlags, css, head)
+		if pn {
+			htmlFlags |= mmark.HTML_PARAGRAPH_NUMBERS
+		}
+		if captions {
+			htmlFlags |= mmark.HTML_CAPTION_NUMBERS
+		}
+		if lof {
+			htmlFlags |= mmark.HTML_LIST_OF_FIGURES
+		}
+		switch inlineHTML {
+		case "strip":
+			htmlFlags |= mmark.HTML_SKIP_HTML
+		case "escape":
+			htmlFlags |= mmark.HTML_ESCAPE_HTML
+		}
+		switch email {
+		case "", "entities", "munge", "text":
+		default:
+			log.Fatalf("unknown email obfuscation: %s", email)
+		}
+		renderer = mmark.HtmlRendererWithParameters(htmlFlags, css, head, mmark.HtmlRendererParameters{EmailObfuscation: email})
+	}
+	if codeAliases != "" {
+		for _, a := range strings.Split(codeAliases, ",") {
+			kv := strings.SplitN(a, "=", 2)
+			if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+				log.Fatalf("error in code-aliases: %q is not language=alias", a)
+			}
+			mmark.CodeLanguageAliases[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+		}
+	}
+	if includePath != "" {
+		mmark.IncludePath = filepath.SplitList(includePath)
+	}
+	switch newline {
+	case "lf", "crlf":
+	default:
+		log.Fatalf("unknown newline: %s, use lf or crlf", newline)
 	}
 
 	// parse and render
-	output := mmark.Parse(input, renderer, extensions).Bytes()
+	var output []byte
+	var diags []mmark.Diagnostic
+	switch {
+	case outline != "":
+		root := mmark.Outline(input, extensions)
+		buf := &bytes.Buffer{}
+		switch outline {
+		case "opml":
+			err = mmark.WriteOPML(buf, root)
+		case "markdown":
+			err = mmark.WriteMarkdownOutline(buf, root)
+		default:
+			log.Fatalf("unknown outline format: %s", outline)
+		}
+		if err != nil {
+			log.Fatalf("error writing outline: %v", err)
+		}
+		output = buf.Bytes()
+	case bibliography != "":
+		refs := mmark.Bibliography(input, extensions)
+		buf := &bytes.Buffer{}
+		switch bibliography {
+		case "bibxml":
+			err = mmark.WriteBibXML(buf, refs)
+		case "bibtex":
+			err = mmark.WriteBibTeX(buf, refs)
+		case "csl":
+			err = mmark.WriteCSLJSON(buf, refs)
+		case "text":
+			err = mmark.WriteBibText(buf, refs)
+		default:
+			log.Fatalf("unknown bibliography format: %s", bibliography)
+		}
+		if err != nil {
+			log.Fatalf("error writing bibliography: %v", err)
+		}
+		output = buf.Bytes()
+	case tmpl != "":
+		t, err := template.ParseFiles(tmpl)
+		if err != nil {
+			log.Fatalf("error reading template %s: %v", tmpl, err)
+		}
+		doc := mmark.ParseDocument(input, renderer, extensions)
+		buf := &bytes.Buffer{}
+		if err := doc.ExecuteTemplate(buf, t); err != nil {
+			log.Fatalf("error executing template %s: %v", tmpl, err)
+		}
+		output = buf.Bytes()
+	default:
+		opts := mmark.ParseOptions{
+			Review:      review != "" && !xml && !xml2,
+			Issues:      issues != "",
+			OpenIssues:  openIssues,
+			Links:       links != "",
+			Section:     section,
+			Diagnostics: diagnostics != "",
+		}
+		buf, res, err := mmark.ParseWith(input, renderer, extensions, opts)
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		diags = res.Diagnostics
+		if opts.Review {
+			writeSidecar("review anchors", review, res.Anchors)
+		}
+		if issues != "" {
+			writeSidecar("issues", issues, res.Issues)
+		}
+		if links != "" {
+			writeSidecar("links", links, res.Links)
+		}
+		output = buf.Bytes()
+		if section != "" {
+			output = append(output, '\n')
+		}
+	}
+
+	if newline == "crlf" {
+		output = bytes.Replace(output, []byte("\n"), []byte("\r\n"), -1)
+	}
+
+	if len(post) > 0 {
+		if output, err = postProcess(output, post, postCache); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// output the result
 	out := os.Stdout
@@ -154,6 +516,32 @@ func main() {
 	}
 
 	if _, err = out.Write(output); err != nil {
-		log.Fatalf("error writing output:", err)
+		log.Fatalf("error writing output: %v", err)
+	}
+
+	if diagnostics != "" {
+		file := "-"
+		if len(args) > 0 {
+			file = args[0]
+		}
+		if err := writeDiagnostics(os.Stderr, diagnostics, file, diags); err != nil {
+			log.Fatalf("error writing diagnostics: %v", err)
+		}
+		if strict {
+			writeDropped(os.Stderr, file, diags)
+		}
+		out.Close()
+		os.Exit(exitCode(diags))
+	}
+}
+
+// writeSidecar writes v as JSON to file, what names it in the errors.
+func writeSidecar(what, file string, v interface{}) {
+	sidecar, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatalf("error encoding %s: %v", what, err)
+	}
+	if err := ioutil.WriteFile(file, append(sidecar, '\n'), 0644); err != nil {
+		log.Fatalf("error writing %s %s: %v", what, file, err)
 	}
 }
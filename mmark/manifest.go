@@ -0,0 +1,107 @@
+package main
+
+// Assemble a document from a pandoc2rfc style project manifest.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// manifest lists the files that make up a document and where they go. It
+// mirrors the pandoc2rfc layout of a template with separate abstract, middle
+// and back files:
+//
+//	titleblock = "template.toml"
+//	abstract   = ["abstract.md"]
+//	middle     = ["middle.md"]
+//	back       = ["back.md"]
+//
+// Relative paths are taken relative to the directory of the manifest.
+type manifest struct {
+	TitleBlock string
+	Abstract   []string
+	Middle     []string
+	Back       []string
+}
+
+// readManifest reads the manifest in file and returns the assembled document.
+func readManifest(file string) ([]byte, error) {
+	m := manifest{}
+	if _, err := toml.DecodeFile(file, &m); err != nil {
+		return nil, err
+	}
+	return m.assemble(filepath.Dir(file))
+}
+
+// assemble concatenates the files in m, relative to dir, and adds the
+// title block delimiters, abstract header and matter markers mmark needs.
+func (m manifest) assemble(dir string) ([]byte, error) {
+	doc := &bytes.Buffer{}
+	if m.TitleBlock != "" {
+		data, err := readPart(dir, m.TitleBlock)
+		if err != nil {
+			return nil, err
+		}
+		// A bare TOML file gets the %%% delimiters, a % prefixed one is used as is.
+		if !bytes.HasPrefix(data, []byte("%")) {
+			doc.WriteString("%%%\n")
+			doc.Write(data)
+			doc.WriteString("%%%\n")
+		} else {
+			doc.Write(data)
+		}
+		doc.WriteByte('\n')
+	}
+	for i, f := range m.Abstract {
+		data, err := readPart(dir, f)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && !bytes.HasPrefix(data, []byte(".#")) {
+			doc.WriteString(".# Abstract\n\n")
+		}
+		doc.Write(data)
+		doc.WriteByte('\n')
+	}
+	if len(m.Middle) > 0 {
+		doc.WriteString("{mainmatter}\n\n")
+	}
+	for _, f := range m.Middle {
+		data, err := readPart(dir, f)
+		if err != nil {
+			return nil, err
+		}
+		doc.Write(data)
+		doc.WriteByte('\n')
+	}
+	if len(m.Back) > 0 {
+		doc.WriteString("{backmatter}\n\n")
+	}
+	for _, f := range m.Back {
+		data, err := readPart(dir, f)
+		if err != nil {
+			return nil, err
+		}
+		doc.Write(data)
+		doc.WriteByte('\n')
+	}
+	return doc.Bytes(), nil
+}
+
+// readPart reads file relative to dir and makes sure it ends in a newline.
+func readPart(dir, file string) ([]byte, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	return data, nil
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import "io/ioutil"
+
+// readInput reads file, on this platform it isn't memory mapped.
+func readInput(file string) (input []byte, done func(), err error) {
+	input, err = ioutil.ReadFile(file)
+	return input, func() {}, err
+}
@@ -0,0 +1,36 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+// readInput memory maps file read-only, mmark doesn't modify or keep its input, so
+// large files are not copied into memory first. Call done when the input is no
+// longer used. Files that can't be mapped, like empty ones or pipes, are read.
+func readInput(file string) (input []byte, done func(), err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := fi.Size()
+	if !fi.Mode().IsRegular() || size == 0 || int64(int(size)) != size {
+		input, err = ioutil.ReadAll(f)
+		return input, func() {}, err
+	}
+	input, err = syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		input, err = ioutil.ReadAll(f)
+		return input, func() {}, err
+	}
+	return input, func() { syscall.Munmap(input) }, nil
+}
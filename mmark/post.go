@@ -0,0 +1,108 @@
+package main
+
+// Post-process the rendered output with regular expressions, XSLT style sheets
+// or commands, for local output conventions mmark doesn't know about.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// postSteps is the value of the repeatable -post flag, the steps are applied in
+// the order given:
+//
+//	s/regexp/replacement/   replace every match of regexp, one of /|#,:;!@% is the delimiter
+//	xslt:style.xsl          transform the output with xsltproc and the style sheet
+//	anything else           a shell command that reads the output on standard input
+type postSteps []string
+
+func (p *postSteps) String() string { return strings.Join(*p, ", ") }
+
+func (p *postSteps) Set(step string) error {
+	if re, _, ok := substitution(step); ok {
+		if _, err := regexp.Compile(re); err != nil {
+			return err
+		}
+	}
+	*p = append(*p, step)
+	return nil
+}
+
+// substitution returns the regexp and replacement of a s/regexp/replacement/ step.
+func substitution(step string) (re, repl string, ok bool) {
+	if len(step) < 4 || step[0] != 's' || !strings.ContainsAny(step[1:2], "/|#,:;!@%") {
+		return "", "", false
+	}
+	parts := strings.Split(step[2:], step[1:2])
+	if len(parts) != 3 || parts[2] != "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// postProcess applies steps to output. When cache is not empty the results of
+// XSLT and commands are stored in that directory, keyed on the step, the style
+// sheet and the input, and reused when the same output is post-processed again.
+func postProcess(output []byte, steps []string, cache string) ([]byte, error) {
+	for _, step := range steps {
+		if re, repl, ok := substitution(step); ok {
+			output = regexp.MustCompile(re).ReplaceAll(output, []byte(repl))
+			continue
+		}
+
+		var cmd *exec.Cmd
+		key := sha256.New()
+		key.Write([]byte(step))
+		if strings.HasPrefix(step, "xslt:") {
+			style := strings.TrimPrefix(step, "xslt:")
+			sheet, err := ioutil.ReadFile(style)
+			if err != nil {
+				return nil, err
+			}
+			key.Write(sheet)
+			cmd = exec.Command("xsltproc", style, "-")
+		} else {
+			cmd = exec.Command("sh", "-c", step)
+		}
+		key.Write(output)
+
+		cached := ""
+		if cache != "" {
+			cached = filepath.Join(cache, hex.EncodeToString(key.Sum(nil)))
+			if buf, err := ioutil.ReadFile(cached); err == nil {
+				output = buf
+				continue
+			}
+		}
+
+		var stderr bytes.Buffer
+		cmd.Stdin = bytes.NewReader(output)
+		cmd.Stderr = &stderr
+		buf, err := cmd.Output()
+		if err != nil {
+			if stderr.Len() > 0 {
+				err = fmt.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+			}
+			return nil, fmt.Errorf("post-processing with %q: %v", step, err)
+		}
+		output = buf
+
+		if cached != "" {
+			if err := os.MkdirAll(cache, 0755); err != nil {
+				return nil, err
+			}
+			if err := ioutil.WriteFile(cached, output, 0644); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return output, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+// Rewrap the paragraphs of a document, so changes to it merge more easily.
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/miekg/mmark"
+)
+
+// reflow implements mmark reflow [-width n] [-w] [file].
+func reflow(args []string) {
+	fs := flag.NewFlagSet("reflow", flag.ExitOnError)
+	width := fs.Int("width", 0, "wrap at this width instead of one sentence per line")
+	write := fs.Bool("w", false, "write the result to the file instead of standard output")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage:\n  %s reflow [options] [inputfile]\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var input []byte
+	var err error
+	switch fs.NArg() {
+	case 0:
+		if *write {
+			log.Fatalf("-w needs an input file")
+		}
+		if input, err = ioutil.ReadAll(os.Stdin); err != nil {
+			log.Fatalf("error reading from standard input: %v", err)
+		}
+	case 1:
+		if input, err = ioutil.ReadFile(fs.Arg(0)); err != nil {
+			log.Fatalf("error reading from %s: %v", fs.Arg(0), err)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	output := mmark.Reflow(input, *width, commonExtensions())
+	if *write {
+		if err := ioutil.WriteFile(fs.Arg(0), output, 0644); err != nil {
+			log.Fatalf("error writing %s: %v", fs.Arg(0), err)
+		}
+		return
+	}
+	if _, err := os.Stdout.Write(output); err != nil {
+		log.Fatalf("error writing output: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+// Command mmarkd is an HTTP server that converts markdown. POST the document to
+// /convert, either as the body with the target and flags in the query string:
+//
+//	curl --data-binary @draft.md 'localhost:8080/convert?target=xml&flags=1'
+//
+// or as JSON: {"markdown": "...", "target": "xml", "flags": 1}. The response is
+// JSON with the output and the diagnostics:
+//
+//	{"output": "...", "diagnostics": [{"severity": "warning", "line": 3, "message": "..."}]}
+//
+// Includes are not supported. Counters, and the parse and render time per
+// backend, are available as expvars on /debug/vars.
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/mmark"
+)
+
+var (
+	requests    = expvar.NewInt("requests")
+	failures    = expvar.NewInt("failures")
+	rejected    = expvar.NewInt("rejected") // too large or too many at the same time
+	bytesIn     = expvar.NewInt("bytes_in")
+	bytesOut    = expvar.NewInt("bytes_out")
+	documents   = expvar.NewMap("documents")      // by backend
+	parseTime   = expvar.NewMap("parse_seconds")  // by backend
+	renderTime  = expvar.NewMap("render_seconds") // by backend
+	diagnostics = expvar.NewMap("diagnostics")    // by severity
+)
+
+// metrics exports the mmark metrics as expvars.
+type metrics struct{}
+
+func (metrics) Document(backend string, parse, render time.Duration) {
+	documents.Add(backend, 1)
+	parseTime.AddFloat(backend, parse.Seconds())
+	renderTime.AddFloat(backend, render.Seconds())
+}
+
+func (metrics) Diagnostic(backend string, severity mmark.Severity) {
+	diagnostics.Add(severity.String(), 1)
+}
+
+type request struct {
+	Markdown string `json:"markdown"`
+	Target   string `json:"target"`
+	Flags    int    `json:"flags"`
+}
+
+type diagnostic struct {
+	Severity string `json:"severity"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+}
+
+type response struct {
+	Output      string       `json:"output"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+	Error       string       `json:"error,omitempty"`
+}
+
+type server struct {
+	maxSize int64
+	slots   chan struct{} // limits the number of concurrent conversions
+}
+
+func main() {
+	addr := flag.String("listen", ":8080", "address to listen on")
+	maxSize := flag.Int64("max-size", 1<<20, "maximum size of a document in bytes")
+	maxConcurrent := flag.Int("max-concurrent", 8, "maximum number of conversions at the same time")
+	timeout := flag.Duration("timeout", 10*time.Second, "maximum time for a request")
+	flag.Parse()
+
+	mmark.MetricsHook = metrics{}
+	s := &server{maxSize: *maxSize, slots: make(chan struct{}, *maxConcurrent)}
+	http.Handle("/convert", http.TimeoutHandler(s, *timeout, "conversion took too long\n"))
+	log.Printf("mmarkd %s listening on %s", mmark.Version, *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requests.Add(1)
+	if r.Method != "POST" {
+		s.error(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		rejected.Add(1)
+		s.error(w, http.StatusServiceUnavailable, "too many conversions")
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.maxSize))
+	if err != nil {
+		rejected.Add(1)
+		s.error(w, http.StatusRequestEntityTooLarge, "document too large")
+		return
+	}
+	bytesIn.Add(int64(len(body)))
+
+	req := request{Target: r.URL.Query().Get("target"), Markdown: string(body)}
+	if f := r.URL.Query().Get("flags"); f != "" {
+		if req.Flags, err = strconv.Atoi(f); err != nil {
+			s.error(w, http.StatusBadRequest, "flags must be a number")
+			return
+		}
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		req = request{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.error(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+	}
+	if req.Target == "" {
+		req.Target = "html"
+	}
+
+	out, diags, err := mmark.ConvertDiagnostics([]byte(req.Markdown), req.Target, req.Flags)
+	if err != nil {
+		s.error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := response{Output: string(out), Diagnostics: []diagnostic{}}
+	for _, d := range diags {
+		resp.Diagnostics = append(resp.Diagnostics, diagnostic{d.Severity.String(), d.Line, d.Message})
+	}
+	bytesOut.Add(int64(len(out)))
+	s.write(w, http.StatusOK, resp)
+}
+
+func (s *server) error(w http.ResponseWriter, code int, msg string) {
+	failures.Add(1)
+	s.write(w, code, response{Diagnostics: []diagnostic{}, Error: msg})
+}
+
+func (s *server) write(w http.ResponseWriter, code int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("error writing response: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Package mmarktest has helpers to test (custom) mmark renderers. Golden converts a
+// corpus of markdown files and compares the output with golden files, Table runs
+// the table driven tests mmark uses itself.
+//
+// Run the tests with -mmarktest.update to (re)write the golden files.
+package mmarktest
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("mmarktest.update", false, "update the golden files")
+
+// Corpus returns the directory with the markdown corpus that comes with this
+// package. Next to every file.md it has the golden files file.html, file.xml (v3)
+// and file.xml2 (v2), made with mmark.ConvertExtensions.
+func Corpus() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata")
+}
+
+// Golden renders every .md file in dir with render and compares the output with
+// the golden file with the same name and extension ext, e.g. ".html". Without a
+// golden file the test fails, unless -mmarktest.update is given, then the golden
+// files are written.
+func Golden(t testing.TB, dir, ext string, render func(input []byte) []byte) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no markdown files in %s", dir)
+	}
+	for _, file := range files {
+		input, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := render(input)
+
+		golden := strings.TrimSuffix(file, ".md") + ext
+		if *update {
+			if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if os.IsNotExist(err) {
+			t.Errorf("%s: no golden file %s, run with -mmarktest.update", file, golden)
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != string(expected) {
+			t.Errorf("%s: output differs from %s\nExpected[%s]\nActual  [%s]", file, golden, expected, actual)
+		}
+	}
+}
+
+// Table runs table driven tests: tests holds pairs of input and expected output.
+// Unless the tests are short, every substring of every input is rendered as well,
+// to stress test bounds checking. A panic is reported as an error.
+func Table(t testing.TB, tests []string, render func(input []byte) []byte) {
+	var candidate string
+	defer func() {
+		if err := recover(); err != nil {
+			t.Errorf("\npanic while processing [%#v]: %s\n", candidate, err)
+		}
+	}()
+
+	for i := 0; i+1 < len(tests); i += 2 {
+		input := tests[i]
+		candidate = input
+		if actual := string(render([]byte(input))); actual != tests[i+1] {
+			t.Errorf("\nInput   [%#v]\nExpected[%#v]\nActual  [%#v]", input, tests[i+1], actual)
+		}
+
+		if testing.Short() {
+			continue
+		}
+		for start := 0; start < len(input); start++ {
+			for end := start + 1; end <= len(input); end++ {
+				candidate = input[start:end]
+				render([]byte(candidate))
+			}
+		}
+	}
+}
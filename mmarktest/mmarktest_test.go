@@ -0,0 +1,24 @@
+package mmarktest
+
+import (
+	"testing"
+
+	"github.com/miekg/mmark"
+)
+
+func convert(target string) func([]byte) []byte {
+	return func(input []byte) []byte {
+		out, _ := mmark.Convert(input, target, 0)
+		return out
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	for _, ext := range []string{".html", ".xml", ".xml2"} {
+		Golden(t, Corpus(), ext, convert(ext[1:]))
+	}
+}
+
+func TestTable(t *testing.T) {
+	Table(t, []string{"*a*\n", "<p><em>a</em></p>\n"}, convert("html"))
+}
@@ -0,0 +1,78 @@
+// Content nested deeper than MaxNesting.
+
+package mmark
+
+import (
+	"bytes"
+	"unicode"
+)
+
+// MaxNesting is how deep lists, block quotes and inline elements can nest. Deeper
+// content is flattened into text, with a warning, which keeps the recursion and
+// the nesting of the output bounded for pathological input. It must be at least 1.
+var MaxNesting = defaultMaxNesting
+
+const defaultMaxNesting = 16
+
+// maxNesting returns MaxNesting, or the default if it is less than 1, which is reported.
+func maxNesting(p *parser) int {
+	if MaxNesting < 1 {
+		errorf(p, "maximum nesting must be at least 1, not %d, using %d", MaxNesting, defaultMaxNesting)
+		return defaultMaxNesting
+	}
+	return MaxNesting
+}
+
+// nestingTooDeep warns, once, about content nested deeper than MaxNesting.
+func (p *parser) nestingTooDeep() {
+	if p.tooDeep {
+		return
+	}
+	p.tooDeep = true
+	warnf(p, "content nested deeper than %d levels is flattened", p.maxNesting)
+}
+
+// flatten renders the blocks in data as a single paragraph of text, without the
+// block quote and list markers.
+func (p *parser) flatten(out *bytes.Buffer, data []byte) {
+	p.nestingTooDeep()
+	var text bytes.Buffer
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = stripBlockMarkers(line)
+		if len(line) == 0 {
+			continue
+		}
+		if text.Len() > 0 {
+			text.WriteByte('\n')
+		}
+		text.Write(line)
+	}
+	if text.Len() == 0 {
+		return
+	}
+	p.r.SetAttr(nil)
+	p.r.Paragraph(out, func() bool { p.r.NormalText(out, text.Bytes()); return true }, 0)
+}
+
+// stripBlockMarkers removes the block quote and list markers line starts with:
+// "> - 1. text" becomes "text".
+func stripBlockMarkers(line []byte) []byte {
+	for {
+		line = bytes.TrimLeftFunc(line, unicode.IsSpace)
+		switch {
+		case len(line) > 0 && line[0] == '>':
+			line = line[1:]
+		case len(line) > 1 && (line[0] == '*' || line[0] == '-' || line[0] == '+') && line[1] == ' ':
+			line = line[2:]
+		default:
+			i := 0
+			for i < len(line) && isnum(line[i]) {
+				i++
+			}
+			if i == 0 || i+1 >= len(line) || (line[i] != '.' && line[i] != ')') || line[i+1] != ' ' {
+				return line
+			}
+			line = line[i+2:]
+		}
+	}
+}
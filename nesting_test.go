@@ -0,0 +1,36 @@
+package mmark
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMaxNesting(t *testing.T) {
+	defer func() { MaxNesting = 16 }()
+	MaxNesting = 4
+
+	input := "> > > > > > Deep *text*.\n> > > > > > - item\n"
+	output, diags := ParseDiagnostics([]byte(input), HtmlRenderer(0, "", ""), 0)
+	if expected := "<p>Deep *text*.\nitem</p>"; !strings.Contains(output.String(), expected) {
+		t.Errorf("expected %q in %q", expected, output)
+	}
+	if strings.Count(output.String(), "<blockquote>") > 4 {
+		t.Errorf("expected at most 4 nested block quotes, got %q", output)
+	}
+	if len(diags) != 1 || diags[0].Message != "content nested deeper than 4 levels is flattened" {
+		t.Errorf("expected a warning, got %v", diags)
+	}
+
+	MaxNesting = 16
+	output, diags = ParseDiagnostics([]byte(input), HtmlRenderer(0, "", ""), 0)
+	if strings.Count(output.String(), "<blockquote>") != 6 || len(diags) != 0 {
+		t.Errorf("expected 6 block quotes and no warnings, got %q, %v", output, diags)
+	}
+
+	MaxNesting = 0
+	output, diags = ParseDiagnostics([]byte(input), HtmlRenderer(0, "", ""), 0)
+	if strings.Count(output.String(), "<blockquote>") != 6 || len(diags) != 1 ||
+		diags[0].Message != "maximum nesting must be at least 1, not 0, using 16" {
+		t.Errorf("expected 6 block quotes and an error, got %q, %v", output, diags)
+	}
+}
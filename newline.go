@@ -0,0 +1,41 @@
+// Newline and encoding normalization of the input and the newlines of the output.
+
+package mmark
+
+import "bytes"
+
+var bom = []byte("\xef\xbb\xbf")
+
+// normalizeInput strips the UTF-8 byte order mark from data and turns CRLF and
+// lone CR newlines into LF. Data is returned as is, not copied, when there is
+// nothing to do; it is never modified.
+func normalizeInput(data []byte) []byte {
+	data = bytes.TrimPrefix(data, bom)
+	cr := bytes.IndexByte(data, '\r')
+	if cr < 0 {
+		return data
+	}
+	out := make([]byte, cr, len(data))
+	copy(out, data[:cr])
+	for i := cr; i < len(data); i++ {
+		switch {
+		case data[i] != '\r':
+			out = append(out, data[i])
+		case i+1 < len(data) && data[i+1] == '\n':
+			// CRLF, the LF is copied next
+		default:
+			out = append(out, '\n')
+		}
+	}
+	return out
+}
+
+// newlines replaces the newlines in out with newline. The input is always
+// normalized to "\n" first, so documents written on Windows convert the same as
+// those written on Unix.
+func newlines(out *bytes.Buffer, newline string) *bytes.Buffer {
+	if newline == "" || newline == "\n" || out == nil {
+		return out
+	}
+	return bytes.NewBuffer(bytes.Replace(out.Bytes(), []byte("\n"), []byte(newline), -1))
+}
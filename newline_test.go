@@ -0,0 +1,35 @@
+package mmark
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeInput(t *testing.T) {
+	unix := "# Title\n\n```\ncode\n```\n\n{#fig-a title=\"A\"}\n![a](a.png)\n"
+	for _, input := range []string{
+		"\xef\xbb\xbf" + unix,
+		strings.Replace(unix, "\n", "\r\n", -1),
+		strings.Replace(unix, "\n", "\r", -1),
+	} {
+		if actual, expected := Parse([]byte(input), XmlRenderer(0), commonXmlExtensions).String(), Parse([]byte(unix), XmlRenderer(0), commonXmlExtensions).String(); actual != expected {
+			t.Errorf("expected %q for %q, got %q", expected, input, actual)
+		}
+	}
+}
+
+func TestNewline(t *testing.T) {
+	out, _, err := ParseWith([]byte("a\nb\n\nc\n"), HtmlRenderer(0, "", ""), 0, ParseOptions{Newline: "\r\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<p>a\r\nb</p>\r\n\r\n<p>c</p>\r\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+	if actual := Parse([]byte("a\n"), HtmlRenderer(0, "", ""), 0).String(); actual != "<p>a</p>\n" {
+		t.Errorf("expected LF newlines by default, got %q", actual)
+	}
+	if _, _, err := ParseWith([]byte("a\n"), HtmlRenderer(0, "", ""), 0, ParseOptions{Newline: "\r"}); err == nil {
+		t.Errorf("expected an error for an unknown newline")
+	}
+}
@@ -0,0 +1,97 @@
+// Parse options: the review, issues, links, symbols, section and diagnostics modes combined.
+
+package mmark
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ParseOptions selects what ParseWith does besides rendering. The options combine,
+// each one is the mode of ParseReview, ParseIssues, ParseLinks, Symbols, ParseSection
+// or ParseDiagnostics.
+type ParseOptions struct {
+	Review      bool   // precede the top level blocks with anchors, see ParseReview
+	Issues      bool   // collect the issues, see ParseIssues
+	OpenIssues  bool   // end with an Open Issues section, implies Issues
+	Links       bool   // collect the link targets, see ParseLinks
+	Symbols     bool   // collect the symbols, see Symbols
+	Section     string // only return the section with this anchor, see ParseSection
+	Diagnostics bool   // return the diagnostics instead of logging them
+	Newline     string // the newline of the output, "\n" (the default) or "\r\n"
+}
+
+// ParseResult is what ParseWith collected while parsing and rendering.
+type ParseResult struct {
+	Anchors     []ReviewAnchor
+	Issues      []Issue
+	Links       []Link
+	Symbols     []Symbol
+	Diagnostics []Diagnostic
+}
+
+// ParseWith is like Parse, but does what the options select. An error is returned
+// when the section of o.Section doesn't exist.
+func ParseWith(input []byte, renderer Renderer, extensions int, o ParseOptions) (*bytes.Buffer, *ParseResult, error) {
+	var (
+		rv  *review
+		is  *issues
+		l   *links
+		sy  *symbols
+		s   *section
+		res = &ParseResult{}
+	)
+	if o.Review {
+		rv = &review{Renderer: renderer}
+		renderer = rv
+	}
+	if o.Issues || o.OpenIssues {
+		is = &issues{Renderer: renderer, appendix: o.OpenIssues}
+		renderer = is
+	}
+	if o.Links {
+		l = &links{Renderer: renderer}
+		renderer = l
+	}
+	if o.Symbols {
+		sy = &symbols{Renderer: renderer, render: true}
+		renderer = sy
+	}
+	if o.Section != "" {
+		s = &section{Renderer: renderer, anchor: o.Section, start: -1, stop: -1}
+		renderer = s
+	}
+	var diagnostics *[]Diagnostic
+	if o.Diagnostics {
+		res.Diagnostics = []Diagnostic{}
+		diagnostics = &res.Diagnostics
+	}
+
+	if o.Newline != "" && o.Newline != "\n" && o.Newline != "\r\n" {
+		return nil, res, fmt.Errorf("unknown newline %q", o.Newline)
+	}
+
+	out := parse(input, renderer, extensions, diagnostics)
+	if out == nil {
+		return nil, res, nil
+	}
+	if rv != nil {
+		res.Anchors = rv.anchors
+	}
+	if is != nil {
+		res.Issues = is.issues
+	}
+	if l != nil {
+		res.Links = append(l.links, l.unused()...)
+	}
+	if sy != nil {
+		res.Symbols = sy.symbols
+	}
+	if s != nil {
+		if s.start < 0 {
+			return nil, res, fmt.Errorf("no section with anchor %s", o.Section)
+		}
+		out = bytes.NewBuffer(closeSections(bytes.TrimSpace(out.Bytes()[s.start:s.stop])))
+	}
+	return newlines(out, o.Newline), res, nil
+}
@@ -0,0 +1,38 @@
+package mmark
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWith(t *testing.T) {
+	input := "# One\n\nSee [x](http://example.com).\n\n# Two {#two}\n\n<!-- TODO: fix -->\n\nB [link](/b)\n\n# Three\n\nC\n"
+	opts := ParseOptions{Review: true, Issues: true, Links: true, Symbols: true, Section: "two", Diagnostics: true}
+	out, res, err := ParseWith([]byte(input), HtmlRenderer(0, "", ""), EXTENSION_HEADER_IDS, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := out.String()
+	if !strings.HasPrefix(output, "<a id=\"review-3\"></a>") || strings.Contains(output, "One") || strings.Contains(output, "Three") {
+		t.Errorf("expected only section two with its review anchors, got %q", output)
+	}
+	if len(res.Anchors) != 6 || res.Anchors[2].Line != 5 {
+		t.Errorf("expected 6 review anchors, the third on line 5, got %v", res.Anchors)
+	}
+	if len(res.Issues) != 1 || res.Issues[0].Line != 7 {
+		t.Errorf("expected the issue on line 7, got %v", res.Issues)
+	}
+	if len(res.Links) != 2 || res.Links[1].Target != "/b" {
+		t.Errorf("expected 2 links, got %v", res.Links)
+	}
+	if len(res.Symbols) != 3 || res.Symbols[1].Anchor != "two" || res.Symbols[1].Line != 5 {
+		t.Errorf("expected 3 symbols, the second section two on line 5, got %v", res.Symbols)
+	}
+	if res.Diagnostics == nil {
+		t.Errorf("expected the diagnostics to be returned")
+	}
+
+	if _, _, err := ParseWith([]byte(input), HtmlRenderer(0, "", ""), 0, ParseOptions{Links: true, Section: "nope"}); err == nil {
+		t.Errorf("expected an error for a missing section")
+	}
+}
@@ -0,0 +1,71 @@
+// Export the outline of a document as OPML or as a Markdown list.
+
+package mmark
+
+import (
+	xmllib "encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type opml struct {
+	XMLName xmllib.Name   `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Title   string        `xml:"head>title"`
+	Body    []opmlOutline `xml:"body>outline"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Anchor   string        `xml:"anchor,attr,omitempty"`
+	Words    int           `xml:"words,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+func opmlOutlines(sections []*Section) []opmlOutline {
+	o := []opmlOutline{}
+	for _, s := range sections {
+		o = append(o, opmlOutline{Text: s.Name, Anchor: s.Anchor, Words: s.TotalWords(), Outlines: opmlOutlines(s.Sections)})
+	}
+	return o
+}
+
+// WriteOPML writes the outline returned by Outline as an OPML 2.0 document. Every
+// section has its number of words, including those of its subsections, in the
+// words attribute.
+func WriteOPML(w io.Writer, root *Section) error {
+	if _, err := io.WriteString(w, xmllib.Header); err != nil {
+		return err
+	}
+	enc := xmllib.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(opml{Version: "2.0", Title: root.Name, Body: opmlOutlines(root.Sections)}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteMarkdownOutline writes the outline returned by Outline as a nested Markdown
+// list, with the number of words of every section, including its subsections.
+func WriteMarkdownOutline(w io.Writer, root *Section) error {
+	if root.Name != "" {
+		if _, err := fmt.Fprintf(w, "# %s\n\n", root.Name); err != nil {
+			return err
+		}
+	}
+	return writeMarkdownOutline(w, root.Sections, 0)
+}
+
+func writeMarkdownOutline(w io.Writer, sections []*Section, depth int) error {
+	for _, s := range sections {
+		if _, err := fmt.Fprintf(w, "%s* %s (%d words)\n", strings.Repeat("    ", depth), s.Name, s.TotalWords()); err != nil {
+			return err
+		}
+		if err := writeMarkdownOutline(w, s.Sections, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
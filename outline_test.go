@@ -0,0 +1,45 @@
+package mmark
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteOutline(t *testing.T) {
+	input := `% title = "The Title"
+
+Four words of preamble.
+
+# One two
+
+One *two* three.
+
+## Three
+
+One.
+
+# Four
+`
+	root := Outline([]byte(input), EXTENSION_TITLEBLOCK_TOML|EXTENSION_AUTO_HEADER_IDS)
+	if root.Name != "The Title" || root.Words != 4 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteMarkdownOutline(buf, root); err != nil {
+		t.Fatal(err)
+	}
+	expected := "# The Title\n\n* One two (4 words)\n    * Three (1 words)\n* Four (0 words)\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteOPML(buf, root); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<outline text="One two" anchor="one-two" words="4">`) {
+		t.Errorf("unexpected OPML: %s", buf.String())
+	}
+}
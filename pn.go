@@ -0,0 +1,74 @@
+// Paragraph numbering, as used in the pn attribute of RFC 7991.
+
+package mmark
+
+import "strconv"
+
+// paragraphNumbers assigns section relative numbers to top level paragraphs,
+// i.e. section-3.2-4 is the fourth paragraph of section 3.2. In the back matter
+// sections are lettered: section-appendix.a-1. The numbers only depend on the
+// structure of the document, so the v3 and HTML output use the same ones.
+type paragraphNumbers struct {
+	section  []int  // number of the current section
+	special  string // abstract or note.N in a special section
+	appendix bool
+	notes    int
+	para     int
+}
+
+func (n *paragraphNumbers) header(level int) {
+	for len(n.section) < level {
+		n.section = append(n.section, 0)
+	}
+	n.section = n.section[:level]
+	n.section[level-1]++
+	n.special = ""
+	n.para = 0
+}
+
+// specialSection starts an abstract, preface or note.
+func (n *paragraphNumbers) specialSection(what string) {
+	switch what {
+	case "preface":
+		what = "abstract"
+	case "note":
+		n.notes++
+		what = "note." + strconv.Itoa(n.notes)
+	}
+	n.special = what
+	n.para = 0
+}
+
+func (n *paragraphNumbers) matter(matter int) {
+	n.section = nil
+	n.special = ""
+	n.para = 0
+	n.appendix = matter == _DOC_BACK_MATTER
+}
+
+// next returns the number of the next paragraph.
+func (n *paragraphNumbers) next() string {
+	n.para++
+	return "section-" + n.name() + "-" + strconv.Itoa(n.para)
+}
+
+func (n *paragraphNumbers) name() string {
+	if n.special != "" {
+		return n.special
+	}
+	if len(n.section) == 0 {
+		return "0"
+	}
+	s := ""
+	for i, num := range n.section {
+		switch {
+		case i == 0 && n.appendix:
+			s = "appendix." + string('a'+rune(num-1))
+		case i == 0:
+			s = strconv.Itoa(num)
+		default:
+			s += "." + strconv.Itoa(num)
+		}
+	}
+	return s
+}
@@ -0,0 +1,53 @@
+// Named sets of extensions and renderer flags.
+
+package mmark
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile is a named set of extensions and renderer flags, so the usual combinations
+// don't have to be spelled out flag by flag.
+type Profile struct {
+	Description string
+	Extensions  int
+	HtmlFlags   int
+	XmlFlags    int
+	Xml2Flags   int
+}
+
+// Profiles are the profiles, select one with LookupProfile.
+var Profiles = map[string]Profile{
+	"ietf": {
+		Description: "Internet-Drafts and RFCs: citations, IAL, includes, TOML title block and IANA tables",
+		Extensions: commonXmlExtensions | EXTENSION_TITLEBLOCK_TOML | EXTENSION_FOOTNOTES | EXTENSION_INCLUDE |
+			EXTENSION_PARTS | EXTENSION_IANA,
+		HtmlFlags: HTML_CAPTION_NUMBERS,
+	},
+	"web": {
+		Description: "web pages and blogs: smartypants, footnotes, emoji and header IDs",
+		Extensions: commonExtensions | EXTENSION_FOOTNOTES | EXTENSION_AUTO_HEADER_IDS | EXTENSION_UNIQUE_HEADER_IDS |
+			EXTENSION_EMOJI,
+		HtmlFlags: commonHtmlFlags | HTML_FOOTNOTE_RETURN_LINKS,
+	},
+	"commonmark": {
+		Description: "CommonMark, without the mmark additions",
+		Extensions: EXTENSION_FENCED_CODE | EXTENSION_SPACE_HEADERS | EXTENSION_NO_EMPTY_LINE_BEFORE_BLOCK |
+			EXTENSION_BACKSLASH_LINE_BREAK,
+	},
+}
+
+// LookupProfile returns the profile name, an unknown name is an error that lists the profiles.
+func LookupProfile(name string) (Profile, error) {
+	if p, ok := Profiles[strings.ToLower(name)]; ok {
+		return p, nil
+	}
+	names := make([]string, 0, len(Profiles))
+	for n := range Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return Profile{}, fmt.Errorf("unknown profile %s, use one of: %s", name, strings.Join(names, ", "))
+}
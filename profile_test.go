@@ -0,0 +1,25 @@
+package mmark
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookupProfile(t *testing.T) {
+	p, err := LookupProfile("IETF")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Extensions&EXTENSION_CITATION == 0 || p.Extensions&EXTENSION_TITLEBLOCK_TOML == 0 {
+		t.Errorf("expected citations and the TOML title block in the ietf profile, got %s", flagString(extensionFlags, p.Extensions))
+	}
+
+	output := Parse([]byte("It's -- done\n"), HtmlRenderer(Profiles["web"].HtmlFlags, "", ""), Profiles["web"].Extensions)
+	if expected := "<p>It&rsquo;s &ndash; done</p>\n"; output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+
+	if _, err := LookupProfile("blog"); err == nil || !strings.Contains(err.Error(), "commonmark, ietf, web") {
+		t.Errorf("expected an error listing the profiles, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Reflow the paragraphs of a document.
+
+package mmark
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Reflow rewraps the top level paragraphs of input to one sentence per line, or
+// when width is larger than zero, to lines of at most width columns. Everything
+// else, i.e. code blocks, tables, lists, quotes and the title block, is left as
+// is. Paragraphs with hard line breaks or that come from an included file are not
+// changed either.
+func Reflow(input []byte, width, extensions int) []byte {
+	r := &reflow{Renderer: XmlRenderer(0)}
+	parse(input, r, extensions, &[]Diagnostic{})
+
+	lines := strings.SplitAfter(string(input), "\n")
+	for i := len(r.paragraphs) - 1; i >= 0; i-- {
+		para := r.paragraphs[i]
+		beg, end := para[0]-1, para[len(para)-1]
+		if end > len(lines) || !consecutive(para) {
+			continue
+		}
+		text := strings.Join(lines[beg:end], "")
+		if hardBreak(text) {
+			continue
+		}
+		indent := lines[beg][:len(lines[beg])-len(strings.TrimLeft(lines[beg], " "))]
+		wrapped := wrap(fields(text), width)
+		for j := range wrapped {
+			wrapped[j] = indent + wrapped[j] + "\n"
+		}
+		if !strings.HasSuffix(lines[end-1], "\n") {
+			wrapped[len(wrapped)-1] = strings.TrimSuffix(wrapped[len(wrapped)-1], "\n")
+		}
+		lines = append(lines[:beg], append(wrapped, lines[end:]...)...)
+	}
+	return []byte(strings.Join(lines, ""))
+}
+
+// reflow records the input lines of the top level paragraphs.
+type reflow struct {
+	Renderer
+	paragraphs [][]int
+
+	p *parser
+}
+
+// Capabilities returns everything, reflow writes markdown and drops nothing.
+func (r *reflow) Capabilities() int { return capabilityAll }
+
+func (r *reflow) setParser(p *parser) {
+	r.p = p
+	if s, ok := r.Renderer.(parserSetter); ok {
+		s.setParser(p)
+	}
+}
+
+func (r *reflow) Paragraph(out *bytes.Buffer, text func() bool, flags int) {
+	if lines := r.p.paragraphLines(); len(lines) > 0 {
+		r.paragraphs = append(r.paragraphs, lines)
+	}
+	r.Renderer.Paragraph(out, text, flags)
+}
+
+// consecutive returns true when lines don't skip a line, i.e. don't contain an include.
+func consecutive(lines []int) bool {
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != lines[i-1]+1 {
+			return false
+		}
+	}
+	return true
+}
+
+func hardBreak(text string) bool {
+	for _, l := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if strings.HasSuffix(l, "  ") || strings.HasSuffix(l, "\\") {
+			return true
+		}
+	}
+	return false
+}
+
+// fields splits text into words on white space, but not on non-breaking spaces,
+// i.e. U+00A0 and an escaped space.
+func fields(text string) []string {
+	words := []string{}
+	beg := -1
+	for i := 0; i < len(text); i++ {
+		space := isspace(text[i]) && !(text[i] == ' ' && escaped(text, i) && i+1 < len(text) && !isspace(text[i+1]))
+		switch {
+		case space && beg >= 0:
+			words = append(words, text[beg:i])
+			beg = -1
+		case !space && beg < 0:
+			beg = i
+		}
+	}
+	if beg >= 0 {
+		words = append(words, text[beg:])
+	}
+	return words
+}
+
+// escaped returns true if text[i] is preceded by an odd number of backslashes.
+func escaped(text string, i int) bool {
+	n := 0
+	for i > 0 && text[i-1] == '\\' {
+		n++
+		i--
+	}
+	return n%2 == 1
+}
+
+// wrap puts words on lines, one sentence per line if width is zero.
+func wrap(words []string, width int) []string {
+	lines := []string{}
+	line := ""
+	for i, w := range words {
+		switch {
+		case line == "":
+			line = w
+		case !canStartLine(w):
+			line += " " + w
+		case width > 0 && textWidth(line)+1+textWidth(w) > width:
+			lines = append(lines, line)
+			line = w
+		default:
+			line += " " + w
+		}
+		if width <= 0 && i+1 < len(words) && endOfSentence(w, words[i+1]) && canStartLine(words[i+1]) {
+			lines = append(lines, line)
+			line = ""
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// wide are the East Asian wide and fullwidth ranges, these take two columns.
+var wide = [][2]rune{
+	{0x1100, 0x115F},   // Hangul Jamo
+	{0x2E80, 0x303E},   // CJK radicals, Kangxi, CJK symbols and punctuation
+	{0x3041, 0x33FF},   // Hiragana, Katakana, Bopomofo, CJK compatibility
+	{0x3400, 0x4DBF},   // CJK extension A
+	{0x4E00, 0x9FFF},   // CJK unified ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xAC00, 0xD7A3},   // Hangul syllables
+	{0xF900, 0xFAFF},   // CJK compatibility ideographs
+	{0xFE30, 0xFE4F},   // CJK compatibility forms
+	{0xFF00, 0xFF60},   // fullwidth forms
+	{0xFFE0, 0xFFE6},   // fullwidth signs
+	{0x1F300, 0x1F64F}, // pictographs and emoticons
+	{0x1F900, 0x1F9FF}, // supplemental pictographs
+	{0x20000, 0x3FFFD}, // CJK extensions B and later
+}
+
+// textWidth returns the number of columns s takes in a terminal or a text file:
+// wide characters count twice and combining marks and format characters not at all.
+func textWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		case r >= wide[0][0] && isWide(r):
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+func isWide(r rune) bool {
+	for _, w := range wide {
+		if r >= w[0] && r <= w[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// endOfSentence returns true if w ends a sentence and next starts a new one.
+func endOfSentence(w, next string) bool {
+	w = strings.TrimRight(w, `)"'*_`)
+	if w == "" || !strings.ContainsAny(w[len(w)-1:], ".!?") {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(strings.TrimLeft(next, `("'*_`))
+	return unicode.IsUpper(r)
+}
+
+// canStartLine returns false if w would start a new block when it is the first
+// word on a line.
+func canStartLine(w string) bool {
+	switch w {
+	case "-", "*", "+", "---", "***", "___":
+		return false
+	}
+	if strings.ContainsAny(w[:1], "#>|{%=:~`<[.(") || strings.HasPrefix(w, "^[") {
+		return false
+	}
+	if len(w) == 2 && w[1] == '>' { // A>, N>, F>
+		return false
+	}
+	// ordered list item: 1. or 1)
+	digits := strings.TrimLeft(w, "0123456789")
+	return !(len(digits) < len(w) && (digits == "." || digits == ")"))
+}
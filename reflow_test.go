@@ -0,0 +1,64 @@
+package mmark
+
+import "testing"
+
+func TestReflow(t *testing.T) {
+	input := `% title = "Test"
+
+# Introduction
+
+This is the first sentence, it is
+rather long. A second
+one, e.g. with an abbreviation. Third
+- not a list.
+
+    Code is not
+    reflowed. At all.
+
+* A list
+  item. Isn't either.
+
+Hard  
+break. Stays.
+`
+	expected := `% title = "Test"
+
+# Introduction
+
+This is the first sentence, it is rather long.
+A second one, e.g. with an abbreviation.
+Third - not a list.
+
+    Code is not
+    reflowed. At all.
+
+* A list
+  item. Isn't either.
+
+Hard  
+break. Stays.
+`
+	extensions := EXTENSION_TITLEBLOCK_TOML | EXTENSION_FENCED_CODE
+	if actual := string(Reflow([]byte(input), 0, extensions)); actual != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, actual)
+	}
+
+	input = "One two three four five six seven.\n"
+	expected = "One two three\nfour five six\nseven.\n"
+	if actual := string(Reflow([]byte(input), 14, 0)); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	input = "See RFC\\ 2119 and RFC\u00a08174 now.\n"
+	expected = "See\nRFC\\ 2119\nand\nRFC\u00a08174\nnow.\n"
+	if actual := string(Reflow([]byte(input), 8, 0)); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// 日本語 takes six columns, the e with a combining acute accent one.
+	input = "日本語 ab cafe\u0301 x y.\n"
+	expected = "日本語\nab cafe\u0301\nx y.\n"
+	if actual := string(Reflow([]byte(input), 8, 0)); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
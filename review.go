@@ -0,0 +1,111 @@
+// Review output: anchors on every top level block that map back to the source.
+
+package mmark
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// ReviewAnchor maps an anchor added to the output to the line in the input the
+// block starts on.
+type ReviewAnchor struct {
+	Anchor string `json:"anchor"`
+	Line   int    `json:"line"`
+	Kind   string `json:"kind"` // paragraph, header, code, quote, list, table, figure, ...
+}
+
+// ParseReview is like Parse, but every top level block is preceded by an empty
+// <a id="review-N"></a> element, numbered in document order. The returned anchors
+// tell on which line in input each block starts, so comments made on the output
+// can be mapped back to the source. The renderer should output HTML.
+func ParseReview(input []byte, renderer Renderer, extensions int) (*bytes.Buffer, []ReviewAnchor) {
+	out, res, _ := ParseWith(input, renderer, extensions, ParseOptions{Review: true})
+	return out, res.Anchors
+}
+
+// review adds the anchors to the blocks rendered by the embedded renderer.
+type review struct {
+	Renderer
+	anchors []ReviewAnchor
+
+	p *parser
+}
+
+func (r *review) setParser(p *parser) {
+	r.p = p
+	if s, ok := r.Renderer.(parserSetter); ok {
+		s.setParser(p)
+	}
+}
+
+// anchor writes the anchor for a block of kind, if it is a top level one.
+func (r *review) anchor(out *bytes.Buffer, kind string) {
+	if r.p == nil || r.p.nesting != 1 {
+		return
+	}
+	a := ReviewAnchor{Anchor: "review-" + strconv.Itoa(len(r.anchors)+1), Line: r.p.line, Kind: kind}
+	r.anchors = append(r.anchors, a)
+	doubleSpace(out)
+	out.WriteString("<a id=\"" + a.Anchor + "\"></a>")
+}
+
+func (r *review) BlockCode(out *bytes.Buffer, text []byte, info CodeInfo, caption []byte, subfigure bool, callouts bool) {
+	r.anchor(out, "code")
+	r.Renderer.BlockCode(out, text, info, caption, subfigure, callouts)
+}
+
+func (r *review) BlockQuote(out *bytes.Buffer, text []byte, attribution []byte) {
+	r.anchor(out, "quote")
+	r.Renderer.BlockQuote(out, text, attribution)
+}
+
+func (r *review) BlockHtml(out *bytes.Buffer, text []byte) {
+	r.anchor(out, "html")
+	r.Renderer.BlockHtml(out, text)
+}
+
+func (r *review) SpecialHeader(out *bytes.Buffer, what []byte, text func() bool, id string) {
+	r.anchor(out, "header")
+	r.Renderer.SpecialHeader(out, what, text, id)
+}
+
+func (r *review) Note(out *bytes.Buffer, text func() bool, id string) {
+	r.anchor(out, "header")
+	r.Renderer.Note(out, text, id)
+}
+
+func (r *review) Part(out *bytes.Buffer, text func() bool, id string) {
+	r.anchor(out, "header")
+	r.Renderer.Part(out, text, id)
+}
+
+func (r *review) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	r.anchor(out, "header")
+	r.Renderer.Header(out, text, level, id)
+}
+
+func (r *review) List(out *bytes.Buffer, text func() bool, flags, start int, group []byte) {
+	r.anchor(out, "list")
+	r.Renderer.List(out, text, flags, start, group)
+}
+
+func (r *review) Paragraph(out *bytes.Buffer, text func() bool, flags int) {
+	r.anchor(out, "paragraph")
+	r.Renderer.Paragraph(out, text, flags)
+}
+
+func (r *review) Table(out *bytes.Buffer, header []byte, body []byte, footer []byte, columnData []int, caption []byte) {
+	r.anchor(out, "table")
+	r.Renderer.Table(out, header, body, footer, columnData, caption)
+}
+
+func (r *review) Aside(out *bytes.Buffer, text []byte) {
+	r.anchor(out, "aside")
+	r.Renderer.Aside(out, text)
+}
+
+func (r *review) Figure(out *bytes.Buffer, text []byte, caption []byte) {
+	r.anchor(out, "figure")
+	r.Renderer.Figure(out, text, caption)
+}
@@ -2,7 +2,11 @@
 
 package mmark
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/miekg/mmark/mmarktest"
+)
 
 func init() {
 	test = true
@@ -21,34 +25,9 @@ func runMarkdownBlockXML_rfc7328(input string, extensions int) string {
 }
 
 func doTestsBlockXML_rfc7328(t *testing.T, tests []string, extensions int) {
-	// catch and report panics
-	var candidate string
-	defer func() {
-		if err := recover(); err != nil {
-			t.Errorf("\npanic while processing [%#v]: %s\n", candidate, err)
-		}
-	}()
-
-	for i := 0; i+1 < len(tests); i += 2 {
-		input := tests[i]
-		candidate = input
-		expected := tests[i+1]
-		actual := runMarkdownBlockXML_rfc7328(candidate, extensions)
-		if actual != expected {
-			t.Errorf("\nInput   [%#v]\nExpected[%#v]\nActual  [%#v]",
-				candidate, expected, actual)
-		}
-
-		// now test every substring to stress test bounds checking
-		if !testing.Short() {
-			for start := 0; start < len(input); start++ {
-				for end := start + 1; end <= len(input); end++ {
-					candidate = input[start:end]
-					_ = runMarkdownBlockXML_rfc7328(candidate, extensions)
-				}
-			}
-		}
-	}
+	mmarktest.Table(t, tests, func(input []byte) []byte {
+		return []byte(runMarkdownBlockXML_rfc7328(string(input), extensions))
+	})
 }
 
 func TestConversionFromRFC7328(t *testing.T) {
@@ -0,0 +1,132 @@
+// Render a single section of a document.
+
+package mmark
+
+import "bytes"
+
+// ParseSection is like Parse, but only returns the rendering of the section with
+// anchor, its subsections included, for embedding a section elsewhere. The
+// anchor can also be an alias of the section. Footnotes and references of the
+// document are not included. An error is returned when there is no such section.
+func ParseSection(input []byte, renderer Renderer, extensions int, anchor string) (*bytes.Buffer, error) {
+	out, _, err := ParseWith(input, renderer, extensions, ParseOptions{Section: anchor})
+	return out, err
+}
+
+// closeSections drops the closing tags of the previous sections the XML renderers
+// write before the <section> of a header, and adds the closing tags of the section
+// and its subsections they would write at the next header.
+func closeSections(b []byte) []byte {
+	for bytes.HasPrefix(b, []byte("</section>")) {
+		b = bytes.TrimSpace(b[len("</section>"):])
+	}
+	open := bytes.Count(b, []byte("<section ")) + bytes.Count(b, []byte("<section>")) - bytes.Count(b, []byte("</section>"))
+	if open <= 0 {
+		return b
+	}
+	b = append(b[:len(b):len(b)], '\n')
+	for ; open > 0; open-- {
+		b = append(b, "</section>\n"...)
+	}
+	return bytes.TrimSpace(b)
+}
+
+// section finds where the section with anchor starts and stops in the output of
+// the embedded renderer: at the top level block of its header and at that of the
+// next header of the same or a higher level.
+type section struct {
+	Renderer
+	anchor string
+
+	level       int  // level of the section's header
+	inside      bool // rendering the section
+	start, stop int  // the section in the output, -1 if not seen
+	block       int  // start in the output of the current top level block
+	ial         *inlineAttr
+
+	p *parser
+}
+
+func (s *section) setParser(p *parser) {
+	s.p = p
+	p.section = s
+	if r, ok := s.Renderer.(parserSetter); ok {
+		r.setParser(p)
+	}
+}
+
+// mark records where in out a top level block starts.
+func (s *section) mark(p *parser, out *bytes.Buffer) {
+	if s == nil || p.nesting != 1 {
+		return
+	}
+	s.block = out.Len()
+}
+
+// end stops the section when the top level blocks end.
+func (s *section) end(p *parser, out *bytes.Buffer) {
+	if s == nil || p.nesting != 1 || !s.inside {
+		return
+	}
+	s.inside = false
+	s.stop = out.Len()
+}
+
+// header starts or stops the section on a top level header with id.
+func (s *section) header(level int, id string) {
+	if s.p == nil || s.p.nesting != 1 {
+		return
+	}
+	if s.inside && level <= s.level {
+		s.inside = false
+		s.stop = s.block
+	}
+	ids := []string{id}
+	if s.ial != nil && s.ial.id != "" {
+		ids = append(ids, s.ial.id) // {#id} before the header
+	}
+	if s.start < 0 && s.matches(ids) {
+		s.inside = true
+		s.level = level
+		s.start = s.block
+	}
+}
+
+// matches returns true if one of the ids of a header is the anchor, or the anchor
+// is an alias of it.
+func (s *section) matches(ids []string) bool {
+	for _, id := range ids {
+		if id != "" && (id == s.anchor || s.p.anchorAliases[s.anchor] == id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *section) SetAttr(i *inlineAttr) {
+	s.ial = i
+	s.Renderer.SetAttr(i)
+}
+
+func (s *section) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	s.header(level, id)
+	s.Renderer.Header(out, text, level, id)
+}
+
+func (s *section) SpecialHeader(out *bytes.Buffer, what []byte, text func() bool, id string) {
+	s.header(1, id)
+	s.Renderer.SpecialHeader(out, what, text, id)
+}
+
+func (s *section) Part(out *bytes.Buffer, text func() bool, id string) {
+	s.header(0, id)
+	s.Renderer.Part(out, text, id)
+}
+
+func (s *section) DocumentMatter(out *bytes.Buffer, matter int) {
+	if s.inside && s.p.nesting == 1 {
+		s.inside = false
+		s.stop = s.block
+	}
+	s.Renderer.DocumentMatter(out, matter)
+}
@@ -0,0 +1,57 @@
+package mmark
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSection(t *testing.T) {
+	input := `# Introduction
+
+Intro.
+
+{#security aliases="sec-cons"}
+# Security Considerations
+
+Be careful.
+
+## Threats
+
+Many.
+
+# IANA Considerations
+
+None.
+`
+	extensions := commonXmlExtensions | EXTENSION_AUTO_HEADER_IDS
+	for _, anchor := range []string{"security", "sec-cons"} {
+		out, err := ParseSection([]byte(input), HtmlRenderer(0, "", ""), extensions, anchor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "<h1 id=\"security\"><a id=\"sec-cons\"></a>Security Considerations</h1>\n\n<p>Be careful.</p>\n\n<h2 id=\"threats\">Threats</h2>\n\n<p>Many.</p>"
+		if !strings.HasPrefix(out.String(), expected) || strings.Contains(out.String(), "Intro.") || strings.Contains(out.String(), "IANA") {
+			t.Errorf("expected only %q, got %q", expected, out)
+		}
+	}
+
+	out, err := ParseSection([]byte(input), HtmlRenderer(0, "", ""), extensions, "iana-considerations")
+	if err != nil || out.String() != "<h1 id=\"iana-considerations\">IANA Considerations</h1>\n\n<p>None.</p>" {
+		t.Errorf("expected the last section, got %q, %v", out, err)
+	}
+
+	out, err = ParseSection([]byte(input), XmlRenderer(0), extensions, "security")
+	expected := "<section anchor=\"security\">\n<name>Security Considerations</name>\n<t>\nBe careful.\n</t>\n\n" +
+		"<section anchor=\"threats\">\n<name>Threats</name>\n<t>\nMany.\n</t>\n</section>\n</section>"
+	if err != nil || out.String() != expected {
+		t.Errorf("expected %q, got %q, %v", expected, out, err)
+	}
+	out, err = ParseSection([]byte(input), Xml2Renderer(0), extensions, "iana-considerations")
+	if expected := "<section anchor=\"iana-considerations\" title=\"IANA Considerations\">\n<t>None.\n</t>\n</section>"; err != nil || out.String() != expected {
+		t.Errorf("expected %q, got %q, %v", expected, out, err)
+	}
+
+	if _, err := ParseSection([]byte(input), HtmlRenderer(0, "", ""), extensions, "nope"); err == nil {
+		t.Errorf("expected an error for a section that doesn't exist")
+	}
+}
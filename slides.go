@@ -0,0 +1,165 @@
+// reveal.js HTML slides rendering backend
+
+package mmark
+
+import "bytes"
+
+// Slides renderer configuration options.
+const (
+	SLIDES_STANDALONE  = 1 << iota // create a complete reveal.js page
+	SLIDES_SKIP_HTML               // skip raw HTML, like HTML_SKIP_HTML
+	SLIDES_ESCAPE_HTML             // output raw HTML as text, like HTML_ESCAPE_HTML
+)
+
+// RevealJS is the URL reveal.js is loaded from in standalone slides.
+var RevealJS = "https://cdn.jsdelivr.net/npm/reveal.js@3.9.2/"
+
+// slides renders reveal.js slides. A level 1 or 2 header or a horizontal rule
+// starts a new slide. An aside (A>) or a block quote with the IAL class notes,
+// i.e. {.notes}, becomes the speaker notes and other classes, like .fragment,
+// are output as is. Everything else is rendered by the embedded Html renderer.
+type slides struct {
+	Renderer
+	flags int
+	css   string // reveal.js theme, the default is white
+	open  bool   // is a slide <section> open
+	start int    // where in the output the open slide's content starts
+}
+
+// SlidesRenderer creates and configures a slides object, which
+// satisfies the Renderer interface.
+//
+// flags is a set of SLIDES_* options ORed together.
+// css is a URL of the reveal.js theme to use.
+func SlidesRenderer(flags int, css string) Renderer {
+	htmlFlags := 0
+	if flags&SLIDES_SKIP_HTML != 0 {
+		htmlFlags |= HTML_SKIP_HTML
+	}
+	if flags&SLIDES_ESCAPE_HTML != 0 {
+		htmlFlags |= HTML_ESCAPE_HTML
+	}
+	return &slides{Renderer: HtmlRenderer(htmlFlags, "", ""), flags: flags, css: css}
+}
+
+func (options *slides) setParser(p *parser) {
+	if r, ok := options.Renderer.(parserSetter); ok {
+		r.setParser(p)
+	}
+}
+
+func (options *slides) Flags() int { return options.flags }
+
+// Capabilities returns what the slides can output, the same as HTML.
+func (options *slides) Capabilities() int { return Capabilities(options.Renderer) }
+
+// slide closes the current slide, if any, and opens a new one. An empty slide is
+// kept open instead.
+func (options *slides) slide(out *bytes.Buffer) {
+	if options.open && out.Len() == options.start {
+		return
+	}
+	options.close(out)
+	doubleSpace(out)
+	out.WriteString("<section>")
+	options.open = true
+	options.start = out.Len()
+}
+
+func (options *slides) close(out *bytes.Buffer) {
+	if options.open {
+		out.WriteString("</section>\n")
+		options.open = false
+	}
+}
+
+func (options *slides) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	if level <= 2 {
+		options.slide(out)
+	}
+	options.Renderer.Header(out, text, level, id)
+}
+
+func (options *slides) HRule(out *bytes.Buffer) {
+	options.slide(out)
+}
+
+func (options *slides) Aside(out *bytes.Buffer, text []byte) {
+	options.notes(out, text)
+}
+
+func (options *slides) BlockQuote(out *bytes.Buffer, text []byte, attribution []byte) {
+	ial := options.Attr()
+	if _, ok := ial.class["notes"]; ok {
+		options.notes(out, text)
+		return
+	}
+	options.Renderer.BlockQuote(out, text, attribution)
+}
+
+func (options *slides) notes(out *bytes.Buffer, text []byte) {
+	doubleSpace(out)
+	out.WriteString("<aside class=\"notes\">\n")
+	out.Write(text)
+	out.WriteString("</aside>\n")
+}
+
+func (options *slides) TitleBlockTOML(out *bytes.Buffer, block *TitleBlock) {
+	options.slide(out)
+	out.WriteString("\n<h1>")
+	options.NormalText(out, []byte(block.Title))
+	out.WriteString("</h1>\n")
+	for _, a := range block.Author {
+		out.WriteString("<p class=\"author\">")
+		options.NormalText(out, []byte(a.Fullname))
+		out.WriteString("</p>\n")
+	}
+	options.slide(out)
+}
+
+// DocumentHeader opens the first slide, for what comes before the first header
+// or horizontal rule.
+func (options *slides) DocumentHeader(out *bytes.Buffer, first bool) {
+	if !first {
+		return
+	}
+	defer options.slide(out)
+	if options.flags&SLIDES_STANDALONE == 0 {
+		return
+	}
+	css := options.css
+	if css == "" {
+		css = RevealJS + "css/theme/white.css"
+	}
+	out.WriteString("<!DOCTYPE html>\n")
+	out.WriteString("<html>\n<head>\n")
+	out.WriteString("  <meta charset=\"utf-8\">\n")
+	out.WriteString("  <meta name=\"GENERATOR\" content=\"Mmark Markdown Processor v" + Version + "\">\n")
+	out.WriteString("  <link rel=\"stylesheet\" href=\"" + RevealJS + "css/reveal.css\">\n")
+	out.WriteString("  <link rel=\"stylesheet\" href=\"")
+	attrEscape(out, []byte(css))
+	out.WriteString("\">\n")
+	out.WriteString("  <link rel=\"stylesheet\" href=\"" + RevealJS + "lib/css/monokai.css\">\n")
+	out.WriteString("</head>\n<body>\n")
+	out.WriteString("<div class=\"reveal\">\n<div class=\"slides\">\n")
+}
+
+func (options *slides) DocumentFooter(out *bytes.Buffer, first bool) {
+	if !first {
+		return
+	}
+	options.close(out)
+	options.Renderer.DocumentFooter(out, first)
+	if options.flags&SLIDES_STANDALONE == 0 {
+		return
+	}
+	out.WriteString("</div>\n</div>\n")
+	out.WriteString("<script src=\"" + RevealJS + "js/reveal.js\"></script>\n")
+	// Code blocks are highlighted by the highlight.js plugin, it uses the
+	// class="language-x" set on the <code> element.
+	out.WriteString("<script>\nReveal.initialize({\n  dependencies: [\n")
+	out.WriteString("    { src: '" + RevealJS + "plugin/highlight/highlight.js', async: true },\n")
+	out.WriteString("    { src: '" + RevealJS + "plugin/notes/notes.js', async: true }\n")
+	out.WriteString("  ]\n});\n</script>\n")
+	out.WriteString("</body>\n</html>\n")
+}
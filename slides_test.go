@@ -0,0 +1,35 @@
+package mmark
+
+import (
+	"testing"
+
+	"github.com/miekg/mmark/mmarktest"
+)
+
+func runMarkdownSlides(input string, extensions int) string {
+	return Parse([]byte(input), SlidesRenderer(0, ""), extensions).String()
+}
+
+func TestSlides(t *testing.T) {
+	var tests = []string{
+		"# One\n\nText\n\n## Two\n\n### Three\n",
+		"<section>\n<h1 id=\"one\">One</h1>\n\n<p>Text</p>\n</section>\n\n<section>\n<h2 id=\"two\">Two</h2>\n\n<h3 id=\"three\">Three</h3>\n</section>\n",
+
+		"# One\n\n{.fragment}\n* item\n\n{.notes}\n> Say this.\n",
+		"<section>\n<h1 id=\"one\">One</h1>\n\n<ul class=\"fragment\">\n<li>item</li>\n</ul>\n\n<aside class=\"notes\">\n<p>Say this.</p>\n</aside>\n</section>\n",
+
+		"Title\n\n---\n\nMore\n\nA> Say this.\n",
+		"<section>\n<p>Title</p>\n</section>\n\n<section>\n<p>More</p>\n\n<aside class=\"notes\">\n<p>Say this.</p>\n</aside>\n</section>\n",
+	}
+	mmarktest.Table(t, tests, func(input []byte) []byte {
+		return []byte(runMarkdownSlides(string(input), EXTENSION_AUTO_HEADER_IDS))
+	})
+}
+
+func TestSlidesTitleBlock(t *testing.T) {
+	input := "% title = \"Talk\"\n\nFirst\n\n# One\n"
+	expected := "<section>\n<h1>Talk</h1>\n</section>\n\n<section>\n<p>First</p>\n</section>\n\n<section>\n<h1 id=\"one\">One</h1>\n</section>\n"
+	if actual := runMarkdownSlides(input, EXTENSION_AUTO_HEADER_IDS|EXTENSION_TITLEBLOCK_TOML); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
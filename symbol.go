@@ -0,0 +1,337 @@
+// Extract the symbols (sections, figures, anchors, references) from a document.
+
+package mmark
+
+import (
+	"bytes"
+	"strings"
+)
+
+// SymbolKind is the kind of a Symbol.
+type SymbolKind int
+
+const (
+	SymbolSection        SymbolKind = iota // a header, Level is set
+	SymbolFigure                           // a figure or code block with a caption
+	SymbolTable                            // a table
+	SymbolAnchor                           // any other block with an anchor set in an IAL
+	SymbolXref                             // a cross reference to Anchor
+	SymbolCitation                         // a citation of Anchor
+	SymbolSpecialSection                   // an abstract, preface or note, Level is 1
+)
+
+var symbolKindString = map[SymbolKind]string{
+	SymbolSection:        "section",
+	SymbolSpecialSection: "special section",
+	SymbolFigure:         "figure",
+	SymbolTable:          "table",
+	SymbolAnchor:         "anchor",
+	SymbolXref:           "xref",
+	SymbolCitation:       "citation",
+}
+
+func (k SymbolKind) String() string { return symbolKindString[k] }
+
+// Symbol is an element of a document that has a name or an anchor, or that refers
+// to one.
+type Symbol struct {
+	Kind   SymbolKind
+	Level  int    // header level for sections, 0 otherwise
+	Name   string // header or caption text
+	Anchor string
+	Line   int // line of the top level block the symbol is in, 0 if not known
+}
+
+// Symbols parses input and returns the symbols found in it, in document order.
+// The document is parsed but no output is generated. Diagnostics are discarded.
+func Symbols(input []byte, extensions int) []Symbol {
+	return parseSymbols(input, extensions).symbols
+}
+
+func parseSymbols(input []byte, extensions int) *symbols {
+	r := &symbols{Renderer: XmlRenderer(0)}
+	parse(input, r, extensions, &[]Diagnostic{})
+	return r
+}
+
+// symbols is a Renderer that records symbols. Everything it doesn't care
+// about is handled by the embedded renderer. Only when render is true the
+// embedded renderer is used for the elements that are recorded as well.
+type symbols struct {
+	Renderer
+	render bool
+
+	symbols    []Symbol
+	titleBlock *TitleBlock
+
+	words []int // words per section, words[0] counts the words before the first one
+	name  bool  // rendering a header, don't count its words
+
+	p *parser
+}
+
+// Capabilities returns what the embedded renderer can output when it renders,
+// otherwise nothing is dropped.
+func (s *symbols) Capabilities() int {
+	if s.render {
+		return Capabilities(s.Renderer)
+	}
+	return capabilityAll
+}
+
+func (s *symbols) setParser(p *parser) {
+	s.p = p
+	if r, ok := s.Renderer.(parserSetter); ok {
+		r.setParser(p)
+	}
+}
+
+// add adds a new symbol. When the previous symbol is an anchor with the same name
+// (added by SetAttr for the same block) it is replaced.
+func (s *symbols) add(kind SymbolKind, level int, name []byte, anchor string) {
+	ial := s.Renderer.Attr()
+	ial.GetOrDefaultId(anchor)
+	anchor = ial.id
+	sym := Symbol{Kind: kind, Level: level, Name: plainText(name), Anchor: anchor, Line: s.p.line}
+	if kind == SymbolSection || kind == SymbolSpecialSection {
+		s.count(0)
+		s.words = append(s.words, 0)
+	}
+	if l := len(s.symbols) - 1; l >= 0 && anchor != "" && s.symbols[l].Kind == SymbolAnchor && s.symbols[l].Anchor == anchor {
+		s.symbols[l] = sym
+		return
+	}
+	s.symbols = append(s.symbols, sym)
+}
+
+// text returns the text rendered by the callback text and a callback that
+// writes it again.
+func (s *symbols) text(out *bytes.Buffer, text func() bool) ([]byte, func() bool) {
+	start := out.Len()
+	s.name = true
+	text()
+	s.name = false
+	name := append([]byte{}, out.Bytes()[start:]...)
+	out.Truncate(start)
+	return name, func() bool { out.Write(name); return true }
+}
+
+func (s *symbols) SetAttr(i *inlineAttr) {
+	if i != nil && i.id != "" {
+		s.symbols = append(s.symbols, Symbol{Kind: SymbolAnchor, Anchor: i.id, Line: s.p.line})
+	}
+	s.Renderer.SetAttr(i)
+}
+
+func (s *symbols) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	name, work := s.text(out, text)
+	s.add(SymbolSection, level, name, id)
+	if s.render {
+		s.Renderer.Header(out, work, level, id)
+	}
+}
+
+func (s *symbols) SpecialHeader(out *bytes.Buffer, what []byte, text func() bool, id string) {
+	name, work := s.text(out, text)
+	s.add(SymbolSpecialSection, 1, name, id)
+	if s.render {
+		s.Renderer.SpecialHeader(out, what, work, id)
+	}
+}
+
+func (s *symbols) Note(out *bytes.Buffer, text func() bool, id string) {
+	name, work := s.text(out, text)
+	s.add(SymbolSpecialSection, 1, name, id)
+	if s.render {
+		s.Renderer.Note(out, work, id)
+	}
+}
+
+func (s *symbols) Part(out *bytes.Buffer, text func() bool, id string) {
+	name, work := s.text(out, text)
+	s.add(SymbolSection, 0, name, id)
+	if s.render {
+		s.Renderer.Part(out, work, id)
+	}
+}
+
+func (s *symbols) BlockCode(out *bytes.Buffer, text []byte, info CodeInfo, caption []byte, subfigure bool, callouts bool) {
+	if len(caption) > 0 && !subfigure {
+		s.add(SymbolFigure, 0, caption, "")
+	}
+	if s.render {
+		s.Renderer.BlockCode(out, text, info, caption, subfigure, callouts)
+	}
+}
+
+func (s *symbols) Figure(out *bytes.Buffer, text []byte, caption []byte) {
+	s.add(SymbolFigure, 0, caption, "")
+	if s.render {
+		s.Renderer.Figure(out, text, caption)
+	}
+}
+
+func (s *symbols) Table(out *bytes.Buffer, header []byte, body []byte, footer []byte, columnData []int, caption []byte) {
+	s.add(SymbolTable, 0, caption, "")
+	if s.render {
+		s.Renderer.Table(out, header, body, footer, columnData, caption)
+	}
+}
+
+func (s *symbols) Link(out *bytes.Buffer, link []byte, title []byte, content []byte) {
+	if len(link) > 1 && link[0] == '#' {
+		s.symbols = append(s.symbols, Symbol{Kind: SymbolXref, Name: plainText(content), Anchor: string(link[1:]), Line: s.p.line})
+	}
+	s.Renderer.Link(out, link, title, content)
+}
+
+func (s *symbols) Citation(out *bytes.Buffer, link, title []byte) {
+	s.symbols = append(s.symbols, Symbol{Kind: SymbolCitation, Anchor: string(link), Line: s.p.line})
+	s.Renderer.Citation(out, link, title)
+}
+
+func (s *symbols) NormalText(out *bytes.Buffer, text []byte) {
+	if !s.name {
+		s.count(len(bytes.Fields(text)))
+	}
+	s.Renderer.NormalText(out, text)
+}
+
+// count adds n words to the current section.
+func (s *symbols) count(n int) {
+	if len(s.words) == 0 {
+		s.words = []int{0}
+	}
+	s.words[len(s.words)-1] += n
+}
+
+func (s *symbols) TitleBlockTOML(out *bytes.Buffer, data *TitleBlock) {
+	s.titleBlock = data
+	if s.render {
+		s.Renderer.TitleBlockTOML(out, data)
+	}
+}
+
+func (s *symbols) References(out *bytes.Buffer, citations map[string]*citation) {
+	if s.render {
+		s.Renderer.References(out, citations)
+	}
+}
+
+func (s *symbols) DocumentHeader(out *bytes.Buffer, start bool) {
+	if s.render {
+		s.Renderer.DocumentHeader(out, start)
+	}
+}
+
+func (s *symbols) DocumentFooter(out *bytes.Buffer, start bool) {
+	if s.render {
+		s.Renderer.DocumentFooter(out, start)
+	}
+}
+
+func (s *symbols) DocumentMatter(out *bytes.Buffer, matter int) {
+	if s.render {
+		s.Renderer.DocumentMatter(out, matter)
+	}
+}
+
+var xmlUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&", "&quot;", "\"")
+
+// plainText strips the XML markup from text.
+func plainText(text []byte) string {
+	text = sanitizeXML(append([]byte{}, text...))
+	return xmlUnescaper.Replace(string(bytes.TrimSpace(text)))
+}
+
+// Section is a section in the outline of a document.
+type Section struct {
+	Symbol
+
+	Figures   []Symbol // figures in this section, not in its subsections
+	Tables    []Symbol
+	Anchors   []Symbol // other blocks with an anchor
+	Citations []Symbol
+	Words     int // words in the text of this section, not in its subsections
+
+	Sections []*Section
+}
+
+// TotalWords returns the number of words in this section and its subsections.
+func (s *Section) TotalWords() int {
+	n := s.Words
+	for _, c := range s.Sections {
+		n += c.TotalWords()
+	}
+	return n
+}
+
+// Outline parses input and returns the section hierarchy of the document. The
+// returned root section has level -1, the document title as its name and holds
+// everything before the first header; parts have level 0. Like Symbols no output
+// is generated, which makes this cheap enough to call whenever an editor buffer
+// changes.
+func Outline(input []byte, extensions int) *Section {
+	r := parseSymbols(input, extensions)
+	r.count(0)
+	root := &Section{Symbol: Symbol{Level: -1}, Words: r.words[0]}
+	if r.titleBlock != nil {
+		root.Name = r.titleBlock.Title
+	}
+	stack := []*Section{root}
+	words := r.words[1:]
+	for _, sym := range r.symbols {
+		cur := stack[len(stack)-1]
+		switch sym.Kind {
+		case SymbolSection, SymbolSpecialSection:
+			for len(stack) > 1 && stack[len(stack)-1].Level >= sym.Level {
+				stack = stack[:len(stack)-1]
+			}
+			s := &Section{Symbol: sym, Words: words[0]}
+			words = words[1:]
+			parent := stack[len(stack)-1]
+			parent.Sections = append(parent.Sections, s)
+			stack = append(stack, s)
+		case SymbolFigure:
+			cur.Figures = append(cur.Figures, sym)
+		case SymbolTable:
+			cur.Tables = append(cur.Tables, sym)
+		case SymbolAnchor:
+			cur.Anchors = append(cur.Anchors, sym)
+		case SymbolCitation:
+			cur.Citations = append(cur.Citations, sym)
+		}
+	}
+	return root
+}
+
+// TOCEntry is an entry in the table of contents.
+type TOCEntry struct {
+	Level  int // 0 for parts
+	Title  string
+	Anchor string
+	Line   int
+}
+
+// TOC returns the table of contents of input, which is parsed with the extensions
+// the XML renderers normally use. Abstract, preface and note sections are not
+// included, nor are sections deeper than the title block's tocdepth.
+func TOC(input []byte) []TOCEntry {
+	r := parseSymbols(input, commonXmlExtensions|EXTENSION_TITLEBLOCK_TOML|EXTENSION_PARTS)
+	return tocEntries(r.symbols, r.titleBlock)
+}
+
+// tocEntries returns the sections in syms, up to the tocdepth of block, which may be nil.
+func tocEntries(syms []Symbol, block *TitleBlock) []TOCEntry {
+	depth := 0
+	if block != nil {
+		depth = block.TocDepth
+	}
+	toc := []TOCEntry{}
+	for _, sym := range syms {
+		if sym.Kind == SymbolSection && (depth == 0 || sym.Level <= depth) {
+			toc = append(toc, TOCEntry{sym.Level, sym.Name, sym.Anchor, sym.Line})
+		}
+	}
+	return toc
+}
@@ -0,0 +1,105 @@
+package mmark
+
+import "testing"
+
+func TestSymbols(t *testing.T) {
+	input := `# Introduction
+
+See (#fig) and [@RFC2119].
+
+{#fig}
+    Code
+Figure: Some *code*.
+
+## Sub & section {#sub}
+
+{#quote}
+> A quote.
+`
+	expected := []Symbol{
+		{Kind: SymbolSection, Level: 1, Name: "Introduction", Anchor: "introduction", Line: 1},
+		{Kind: SymbolXref, Anchor: "fig", Line: 3},
+		{Kind: SymbolCitation, Anchor: "RFC2119", Line: 3},
+		{Kind: SymbolFigure, Name: "Some code.", Anchor: "fig", Line: 6},
+		{Kind: SymbolSection, Level: 2, Name: "Sub & section", Anchor: "sub", Line: 9},
+		{Kind: SymbolAnchor, Anchor: "quote", Line: 12},
+	}
+	extensions := EXTENSION_HEADER_IDS | EXTENSION_AUTO_HEADER_IDS | EXTENSION_CITATION | EXTENSION_SHORT_REF
+	actual := Symbols([]byte(input), extensions)
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d symbols, got %d: %+v", len(expected), len(actual), actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("symbol %d: expected %+v, got %+v", i, expected[i], actual[i])
+		}
+	}
+}
+
+func TestOutline(t *testing.T) {
+	input := `Preamble [@RFC2119].
+
+# One
+
+## One.One
+
+| a |
+|---|
+| b |
+Table: A table.
+
+# Two
+
+## Two.One
+
+### Two.One.One
+`
+	root := Outline([]byte(input), EXTENSION_TABLES|EXTENSION_CITATION|EXTENSION_AUTO_HEADER_IDS)
+	if len(root.Citations) != 1 || len(root.Sections) != 2 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	one, two := root.Sections[0], root.Sections[1]
+	if one.Name != "One" || len(one.Sections) != 1 || len(one.Sections[0].Tables) != 1 {
+		t.Errorf("unexpected section one: %+v", one)
+	}
+	if two.Name != "Two" || len(two.Sections) != 1 || len(two.Sections[0].Sections) != 1 ||
+		two.Sections[0].Sections[0].Name != "Two.One.One" {
+		t.Errorf("unexpected section two: %+v", two)
+	}
+}
+
+func TestTOC(t *testing.T) {
+	input := `% title = "Test"
+
+.# Abstract
+
+Abstract.
+
+{mainmatter}
+
+# Introduction
+
+## Terminology {#terms}
+`
+	expected := []TOCEntry{
+		{1, "Introduction", "introduction", 9},
+		{2, "Terminology", "terms", 11},
+	}
+	actual := TOC([]byte(input))
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("entry %d: expected %+v, got %+v", i, expected[i], actual[i])
+		}
+	}
+}
+
+func TestTOCDepth(t *testing.T) {
+	input := "% title = \"Test\"\n% tocdepth = 1\n\n# Introduction\n\n## Terminology\n\n# Conclusion\n"
+	actual := TOC([]byte(input))
+	if len(actual) != 2 || actual[0].Title != "Introduction" || actual[1].Title != "Conclusion" {
+		t.Errorf("expected the level 1 sections, got %+v", actual)
+	}
+}
@@ -1,6 +1,9 @@
 package mmark
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestTableColSpan(t *testing.T) {
 	var tests = []string{`
@@ -22,3 +25,20 @@ func TestTableColSpan(t *testing.T) {
 	}
 	doTestsBlock(t, tests, EXTENSION_TABLES)
 }
+
+func TestTableCellCount(t *testing.T) {
+	input := "Para\n\n| a | b |\n|---|---|\n| 1 |\n| 1 | 2 | 3 |  \n| 1 | 2 |\n"
+	output, diags := ParseDiagnostics([]byte(input), Xml2Renderer(0), EXTENSION_TABLES)
+	if n := strings.Count(output.String(), "<c>"); n != 6 {
+		t.Errorf("expected 6 cells, got %d in %q", n, output)
+	}
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %v", diags)
+	}
+	if d := diags[0]; d.Line != 5 || d.Message != "table row has 1 cells instead of 2, padding it with empty cells" {
+		t.Errorf("unexpected diagnostic: %s", d)
+	}
+	if d := diags[1]; d.Line != 6 || d.Message != "table row has 3 cells instead of 2, dropping the extra cells" {
+		t.Errorf("unexpected diagnostic: %s", d)
+	}
+}
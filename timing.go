@@ -0,0 +1,80 @@
+// Time spent per phase of a conversion.
+
+package mmark
+
+import "time"
+
+// VerboseTiming reports the time spent in every phase of a conversion as info
+// diagnostics: "timing: inline 1.2ms".
+var VerboseTiming = false
+
+// Phase is the time spent in a phase of a conversion. The phases are:
+//
+//	first pass   includes, reference definitions and tabs
+//	title block  decoding the TOML title block
+//	blocks       parsing the blocks and rendering them, without their inline content
+//	inline       parsing and rendering the inline content
+//	references   finding and rendering the references
+//	validation   the checks on the whole document, like anchor conflicts
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// PhaseMetrics is a Metrics that also receives the time spent per phase. When
+// MetricsHook implements it, Phases is called after Document.
+type PhaseMetrics interface {
+	Metrics
+	Phases(backend string, phases []Phase)
+}
+
+var phaseNames = []string{"first pass", "title block", "blocks", "inline", "references", "validation"}
+
+// phaseStart returns the start of a phase, use with phaseEnd:
+//
+//	defer p.phaseEnd("validation", p.phaseStart())
+func (p *parser) phaseStart() time.Time {
+	if p.phases == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// phaseEnd adds the time since start to the phase name.
+func (p *parser) phaseEnd(name string, start time.Time) {
+	if p.phases == nil {
+		return
+	}
+	p.phases[name] += time.Since(start)
+}
+
+// reportPhases reports the phases of the document, parse and render are the
+// times of the first and second pass.
+func (p *parser) reportPhases(parse, render time.Duration) {
+	if p.phases == nil {
+		return
+	}
+	p.phases["first pass"] = parse
+	blocks := render
+	for _, name := range phaseNames[1:] {
+		blocks -= p.phases[name]
+	}
+	if blocks < 0 {
+		blocks = 0
+	}
+	p.phases["blocks"] = blocks
+
+	phases := make([]Phase, len(phaseNames))
+	for i, name := range phaseNames {
+		phases[i] = Phase{Name: name, Duration: p.phases[name]}
+	}
+	if m, ok := MetricsHook.(PhaseMetrics); ok {
+		m.Phases(backendName(p.r), phases)
+	}
+	if VerboseTiming {
+		p.line = 0
+		for _, ph := range phases {
+			printf(p, "timing: %s %s", ph.Name, ph.Duration)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package mmark
 
 import (
 	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -15,15 +18,56 @@ const (
 	DefaultArea = "Internet"
 )
 
+// TitleBlockDefaults holds a TOML title block that is used for every field the document's
+// own title block leaves unset. Authors are matched on their fullname (or surname) and only
+// their empty fields are filled in; if the document has no authors, all default ones are used.
+var TitleBlockDefaults string
+
 type author struct {
 	Initials           string
 	Surname            string
 	Fullname           string
 	Organization       string
-	OrganizationAbbrev string `toml:"abbrev"`
+	OrganizationAbbrev string        `toml:"abbrev" json:"abbrev"`
+	Affiliation        []affiliation // more organizations the author belongs to
 	Role               string
 	Ascii              string
 	Address            address
+	File               string // vCard or JSON file with the other fields, see authorFiles
+}
+
+// affiliation is another organization of an author:
+//
+//	[[author.affiliation]]
+//	organization = "Example University"
+//	abbrev = "EU"
+type affiliation struct {
+	Organization string
+	Abbrev       string
+}
+
+// organizations returns the organizations of a, Organization first.
+func (a author) organizations() []affiliation {
+	orgs := []affiliation{}
+	if a.Organization != "" || a.OrganizationAbbrev != "" {
+		orgs = append(orgs, affiliation{a.Organization, a.OrganizationAbbrev})
+	}
+	return append(orgs, a.Affiliation...)
+}
+
+// organization returns the names and the abbreviations of the organizations of a,
+// separated by commas, as XML2RFC allows only one organization per author.
+func (a author) organization() (name, abbrev string) {
+	names, abbrevs := []string{}, []string{}
+	for _, o := range a.organizations() {
+		if o.Organization != "" {
+			names = append(names, o.Organization)
+		}
+		if o.Abbrev != "" {
+			abbrevs = append(abbrevs, o.Abbrev)
+		}
+	}
+	return strings.Join(names, ", "), strings.Join(abbrevs, ", ")
 }
 
 type address struct {
@@ -63,9 +107,56 @@ type pi struct {
 	Comments   string // Typeset cref's in the text.
 	Header     string // Top-Left header, usually Internet-Draft.
 	Footer     string // Bottom-Center footer, usually Expires ...
+
+	Extra map[string]string `toml:"-"` // Other processing instructions in the [pi] table.
 }
 
-type title struct {
+// piName returns true if name is a letter followed by letters, digits, '-', '_' or '.'.
+func piName(name string) bool {
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// extraPIs returns the processing instructions in table that are not in PIs,
+// true and false become yes and no. Names that can't be a pseudo-attribute of a
+// processing instruction are skipped with a warning.
+func extraPIs(p *parser, table map[string]interface{}) map[string]string {
+	known := map[string]bool{}
+	for _, name := range PIs {
+		known[name] = true
+	}
+	extra := map[string]string{}
+	for k, v := range table {
+		if known[strings.ToLower(k)] {
+			continue
+		}
+		if !piName(k) {
+			warnf(p, "invalid PI name in TOML titleblock: %q, ignoring it", k)
+			continue
+		}
+		switch v := v.(type) {
+		case bool:
+			extra[k] = "no"
+			if v {
+				extra[k] = "yes"
+			}
+		default:
+			extra[k] = fmt.Sprint(v)
+		}
+	}
+	return extra
+}
+
+// TitleBlock is the TOML title block of a document. The TitleBlock of a Document,
+// HtmlPage or Abstract is nil when the document doesn't have one.
+type TitleBlock struct {
 	Title  string
 	Abbrev string
 
@@ -81,25 +172,313 @@ type title struct {
 	Date      time.Time
 	Area      string
 	Workgroup string
-	Keyword   []string
+	Keyword   keywords
 	Author    []author
+
+	Internal     []string          // anchors that are cited, but are not references, like companion documents
+	Aliases      map[string]string // anchors cited under another name, like HTTP2 = "RFC9113"
+	References   referenceTitles
+	Bibliography bibliography // [bibliography], where the references come from
+
+	Contributor      []author // [[contributor]], listed in the Contributors section
+	Acknowledgements string   // markdown text of the Acknowledgements section
+
+	Language string // language of the text, e.g. "de", xml:lang in XML2RFC v3
+	Dir      string // direction of the text, ltr or rtl, see Direction, only used in HTML
+
+	Coding   string // encoding declared in the output, UTF-8 or US-ASCII
+	TocDepth int    // levels of sections in the table of contents, 0 for all
+}
+
+// Direction returns the direction of the text: Dir if set, otherwise rtl for
+// Arabic, Hebrew, Persian, Urdu and Yiddish and ltr for other languages.
+func (t *TitleBlock) Direction() string {
+	if t.Dir != "" {
+		return t.Dir
+	}
+	switch strings.ToLower(strings.SplitN(t.Language, "-", 2)[0]) {
+	case "ar", "he", "fa", "ur", "yi":
+		return "rtl"
+	}
+	return "ltr"
 }
 
-func (p *parser) titleBlockTOML(out *bytes.Buffer, data []byte) title {
+// DocNameRevision splits docName in the name and the revision, i.e. draft-foo-03
+// gives draft-foo and 3. If docName has no revision, rev is -1.
+func DocNameRevision(docName string) (name string, rev int) {
+	i := strings.LastIndex(docName, "-")
+	if i < 0 || len(docName)-i != 3 {
+		return docName, -1
+	}
+	rev, err := strconv.Atoi(docName[i+1:])
+	if err != nil || rev < 0 {
+		return docName, -1
+	}
+	return docName[:i], rev
+}
+
+func (p *parser) titleBlockTOML(out *bytes.Buffer, data []byte) TitleBlock {
+	defer p.phaseEnd("title block", p.phaseStart())
 	data = bytes.TrimPrefix(data, []byte("%"))
 	data = bytes.Replace(data, []byte("\n%"), []byte("\n"), -1)
 
 	// Set some sentinels and defaults.
-	var block title
+	var block TitleBlock
 	block.PI.Header = piNotSet
 	block.PI.Footer = piNotSet
 	block.Area = DefaultArea
 	block.Ipr = DefaultIpr
 	block.Date = time.Now()
 
+	var defaults []author
+	if TitleBlockDefaults != "" {
+		if _, err := toml.Decode(TitleBlockDefaults, &block); err != nil {
+			errorf(p, "error in TOML titleblock defaults: %s", err.Error())
+		}
+		defaults = block.Author
+		block.Author = nil
+		p.authorFiles(defaults)
+	}
+
 	if _, err := toml.Decode(string(data), &block); err != nil {
-		printf(p, "error in TOML titleblock: %s", err.Error())
-		return block // never an error when encoding markdown
+		errorf(p, "error in TOML titleblock: %s", err.Error())
+	}
+	var table struct{ PI map[string]interface{} }
+	if _, err := toml.Decode(string(data), &table); err == nil {
+		block.PI.Extra = extraPIs(p, table.PI)
+	}
+	p.authorFiles(block.Author)
+	p.authorFiles(block.Contributor)
+	block.Author = mergeAuthors(block.Author, defaults)
+	if !iprs[block.Ipr] {
+		errorf(p, "unknown ipr in TOML titleblock: %s, using %s", block.Ipr, DefaultIpr)
+		block.Ipr = DefaultIpr
+	}
+	block.Keyword = normalizeKeywords(p, block.Keyword)
+	block.Coding = coding(p, block.Coding)
+	block.TocDepth = tocDepth(p, block.TocDepth, &block.PI)
+	if PrivateAddresses {
+		for i := range block.Author {
+			block.Author[i].private()
+		}
+		for i := range block.Contributor {
+			block.Contributor[i].private()
+		}
+	}
+	p.internal = internalAnchors(block)
+	p.groups = block.References.Groups
+	p.aliases = block.Aliases
+	p.contributors = block.Contributor
+	p.acknowledgements = block.Acknowledgements
+	p.bibliography = block.Bibliography
+	return block // never an error when encoding markdown
+}
+
+// referenceTitles are the titles of the reference sections, for instance:
+//
+//	[references]
+//	informative = "Further Reading"
+//	[references.groups]
+//	u = "URIs"
+//
+// Every letter in groups is an extra reference section, cited with [@u:anchor].
+type referenceTitles struct {
+	Normative   string
+	Informative string
+	Groups      map[string]string
+}
+
+// LowercaseKeywords makes the keywords of the title block lower case.
+var LowercaseKeywords = false
+
+// keywords are the keywords of the title block, either a list or a string with
+// comma separated keywords: keyword = "DNS, DNSSEC".
+type keywords []string
+
+func (k *keywords) UnmarshalTOML(v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		*k = strings.Split(v, ",")
+	case []interface{}:
+		*k = nil // replace the keywords of TitleBlockDefaults
+		for _, s := range v {
+			s, ok := s.(string)
+			if !ok {
+				return fmt.Errorf("keyword is not a string: %v", s)
+			}
+			*k = append(*k, s)
+		}
+	default:
+		return fmt.Errorf("keyword is not a string or a list of strings: %v", v)
+	}
+	return nil
+}
+
+// normalizeKeywords trims the keywords, lower cases them when LowercaseKeywords is
+// set and drops empty and duplicate ones, which are reported.
+func normalizeKeywords(p *parser, k keywords) keywords {
+	seen := map[string]bool{}
+	var norm keywords
+	for _, w := range k {
+		w = strings.Join(strings.Fields(w), " ")
+		if LowercaseKeywords {
+			w = strings.ToLower(w)
+		}
+		switch {
+		case w == "":
+			warnf(p, "empty keyword in TOML titleblock")
+		case seen[strings.ToLower(w)]:
+			warnf(p, "duplicate keyword in TOML titleblock: %s", w)
+		default:
+			seen[strings.ToLower(w)] = true
+			norm = append(norm, w)
+		}
+	}
+	return norm
+}
+
+// codings are the encodings the output can declare, the output is always UTF-8
+// and only with transliteration (see -ascii) it is US-ASCII as well.
+var codings = []string{"UTF-8", "US-ASCII"}
+
+// coding returns the coding c in its canonical case, UTF-8 if it is not set,
+// unknown or US-ASCII without transliteration, which is reported.
+func coding(p *parser, c string) string {
+	if c == "" {
+		return codings[0]
+	}
+	for _, known := range codings {
+		if !strings.EqualFold(c, known) {
+			continue
+		}
+		if known == codings[1] && !p.translit.on {
+			errorf(p, "coding %s in TOML titleblock needs transliterated xml2rfc v2 output, using %s", known, codings[0])
+			return codings[0]
+		}
+		return known
+	}
+	errorf(p, "unknown coding in TOML titleblock: %s, using %s", c, codings[0])
+	return codings[0]
+}
+
+// tocDepth returns the depth of the table of contents, set with tocdepth in the
+// title block or in [pi], which it is copied to for the xml2rfc processing
+// instruction. If both are set, the title block's is used.
+func tocDepth(p *parser, depth int, pi *pi) int {
+	if depth < 0 {
+		errorf(p, "negative tocdepth in TOML titleblock: %d", depth)
+		depth = 0
+	}
+	for k, v := range pi.Extra {
+		if strings.ToLower(k) != "tocdepth" {
+			continue
+		}
+		if depth > 0 {
+			delete(pi.Extra, k)
+			if v != strconv.Itoa(depth) {
+				warnf(p, "tocdepth is set in the TOML titleblock and in [pi], using %d", depth)
+			}
+			break
+		}
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 {
+			errorf(p, "tocdepth in [pi] is not a number: %s", v)
+			delete(pi.Extra, k)
+			return 0
+		}
+		return d
+	}
+	if depth > 0 {
+		if pi.Extra == nil {
+			pi.Extra = map[string]string{}
+		}
+		pi.Extra["tocdepth"] = strconv.Itoa(depth)
+	}
+	return depth
+}
+
+// internalAnchors returns the anchors that don't get a reference when cited: the
+// document itself, as I-D.name or RFCnnnn, and the anchors listed in internal. Like
+// citations they are matched without regard to case, the keys are in lower case.
+func internalAnchors(block TitleBlock) map[string]string {
+	anchors := []string{}
+	if name, _ := DocNameRevision(block.DocName); strings.HasPrefix(name, "draft-") {
+		anchors = append(anchors, "I-D."+strings.TrimPrefix(name, "draft-"))
+	}
+	if block.Number > 0 {
+		anchors = append(anchors, "RFC"+strconv.Itoa(block.Number))
+	}
+	internal := map[string]string{}
+	for _, a := range append(anchors, block.Internal...) {
+		internal[strings.ToLower(a)] = a
+	}
+	return internal
+}
+
+// mergeAuthors fills the empty fields of the authors in a from the matching author in defaults.
+func mergeAuthors(a, defaults []author) []author {
+	if len(a) == 0 {
+		return defaults
+	}
+	for i := range a {
+		for _, d := range defaults {
+			if a[i].same(d) {
+				a[i].merge(d)
+				break
+			}
+		}
+	}
+	return a
+}
+
+// PrivateAddresses leaves out the street addresses and phone numbers of the authors
+// and contributors, their organizations, email and URI are kept.
+var PrivateAddresses = false
+
+// private removes the street address, postal code and phone number of a.
+func (a *author) private() {
+	a.Address.Phone = ""
+	a.Address.Postal.Street = ""
+	a.Address.Postal.Streets = nil
+	a.Address.Postal.Code = ""
+	a.Address.Postal.Codes = nil
+	a.Address.Postal.PostalLine = nil
+}
+
+func (a author) same(b author) bool {
+	if a.Fullname != "" && b.Fullname != "" {
+		return a.Fullname == b.Fullname
+	}
+	return a.Surname != "" && a.Surname == b.Surname
+}
+
+func (a *author) merge(b author) {
+	mergeString(&a.Initials, b.Initials)
+	mergeString(&a.Surname, b.Surname)
+	mergeString(&a.Fullname, b.Fullname)
+	mergeString(&a.Organization, b.Organization)
+	mergeString(&a.OrganizationAbbrev, b.OrganizationAbbrev)
+	if len(a.Affiliation) == 0 {
+		a.Affiliation = b.Affiliation
+	}
+	mergeString(&a.Role, b.Role)
+	mergeString(&a.Ascii, b.Ascii)
+	mergeString(&a.Address.Phone, b.Address.Phone)
+	mergeString(&a.Address.Email, b.Address.Email)
+	mergeString(&a.Address.Uri, b.Address.Uri)
+	if a.Address.Postal.empty() {
+		a.Address.Postal = b.Address.Postal
+	}
+}
+
+func (a addressPostal) empty() bool {
+	return a.Street == "" && a.City == "" && a.Code == "" && a.Country == "" && a.Region == "" &&
+		len(a.PostalLine) == 0 && len(a.Streets) == 0 && len(a.Cities) == 0 &&
+		len(a.Codes) == 0 && len(a.Countries) == 0 && len(a.Regions) == 0
+}
+
+func mergeString(s *string, def string) {
+	if *s == "" {
+		*s = def
 	}
-	return block
 }
@@ -0,0 +1,127 @@
+// Transliteration of non-ASCII characters for XML2RFC v2 output.
+
+package mmark
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// Transliterations maps characters to their ASCII replacement when XML2_TRANSLITERATE
+// is set. The replacements are escaped when they are written to the XML.
+var Transliterations = map[rune]string{
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "Ae", 'Å': "A", 'Æ': "AE", 'Ç': "C",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I",
+	'Ð': "D", 'Ñ': "N", 'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "Oe", 'Ø': "O",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "Ue", 'Ý': "Y", 'Þ': "Th", 'ß': "ss",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "ae", 'å': "a", 'æ': "ae", 'ç': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ð': "d", 'ñ': "n", 'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "oe", 'ø': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "ue", 'ý': "y", 'þ': "th", 'ÿ': "y",
+	'Ą': "A", 'ą': "a", 'Ć': "C", 'ć': "c", 'Č': "C", 'č': "c", 'Ď': "D", 'ď': "d",
+	'Ę': "E", 'ę': "e", 'Ě': "E", 'ě': "e", 'Ł': "L", 'ł': "l", 'Ń': "N", 'ń': "n",
+	'Ň': "N", 'ň': "n", 'Œ': "OE", 'œ': "oe", 'Ř': "R", 'ř': "r", 'Ś': "S", 'ś': "s",
+	'Š': "S", 'š': "s", 'Ť': "T", 'ť': "t", 'Ů': "U", 'ů': "u", 'Ź': "Z", 'ź': "z",
+	'Ż': "Z", 'ż': "z", 'Ž': "Z", 'ž': "z",
+
+	' ': " ", ' ': " ", ' ': " ", ' ': " ", '​': "",
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "--", '―': "--", '−': "-",
+	'‘': "'", '’': "'", '‚': "'", '“': "\"", '”': "\"", '„': "\"", '«': "\"", '»': "\"",
+	'…': "...", '•': "*", '·': ".", '×': "x", '÷': "/", '±': "+/-", '°': " degrees",
+	'©': "(c)", '®': "(R)", '™': "(TM)", '§': "Section ", '¶': "P.", '€': "EUR",
+	'£': "GBP", '¥': "JPY", '←': "<-", '→': "->", '⇒': "=>", '≤': "<=", '≥': ">=", '≠': "!=",
+}
+
+// TransliterateFunc, when not nil, is asked first for the replacement of a
+// character, for instance to turn CJK into pinyin. If it returns false the
+// Transliterations table is used.
+var TransliterateFunc func(r rune) (string, bool)
+
+// translitState is where the text that is not transliterated yet starts in the
+// output, and the line it comes from.
+type translitState struct {
+	on    bool // XML2_TRANSLITERATE is set
+	start int
+	line  int
+}
+
+// transliterateBlock transliterates the top level block rendered since the last
+// call, with the line of that block for the diagnostics, call it at the start of
+// every top level block and after the last one.
+func (p *parser) transliterateBlock(out *bytes.Buffer) {
+	if !p.translit.on || p.nesting != 1 {
+		return
+	}
+	line := p.line
+	p.line = p.translit.line
+	transliterate(p, out, p.translit.start)
+	p.line = line
+	p.translit.start = out.Len()
+	p.translit.line = line
+}
+
+// transliterateRest transliterates what is rendered after the top level blocks,
+// like the footnotes and references.
+func (p *parser) transliterateRest(out *bytes.Buffer) {
+	if !p.translit.on {
+		return
+	}
+	p.line = 0
+	transliterate(p, out, p.translit.start)
+}
+
+// transliterate replaces the non-ASCII characters in out from start and reports
+// every substitution. Characters without a transliteration become '?'.
+func transliterate(p *parser, out *bytes.Buffer, start int) {
+	if start > out.Len() {
+		start = out.Len()
+	}
+	text := out.Bytes()
+	i := start
+	for i < len(text) && text[i] < utf8.RuneSelf {
+		i++
+	}
+	if i == len(text) {
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.Write(text[start:i])
+	for i < len(text) {
+		if text[i] < utf8.RuneSelf {
+			buf.WriteByte(text[i])
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(text[i:])
+		s, ok := "", false
+		if TransliterateFunc != nil {
+			s, ok = TransliterateFunc(r)
+		}
+		if !ok {
+			s, ok = Transliterations[r]
+		}
+		if ok {
+			warnf(p, "transliterated '%c' as '%s' in '%s'", r, s, surroundingWord(text, i))
+		} else {
+			s = "?"
+			warnf(p, "no transliteration for '%c' (%U) in '%s', using '?'", r, r, surroundingWord(text, i))
+		}
+		attrEscape(&buf, []byte(s))
+		i += size
+	}
+	out.Truncate(start)
+	out.Write(buf.Bytes())
+}
+
+// surroundingWord returns the text around text[i] up to a space or a tag.
+func surroundingWord(text []byte, i int) []byte {
+	beg, end := i, i
+	for beg > 0 && !isspace(text[beg-1]) && text[beg-1] != '>' {
+		beg--
+	}
+	for end < len(text) && !isspace(text[end]) && text[end] != '<' {
+		end++
+	}
+	return text[beg:end]
+}
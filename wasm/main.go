@@ -0,0 +1,39 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command wasm exposes mmark to JavaScript. After loading mmark.wasm (with
+// wasm_exec.js from the Go distribution) the global function
+//
+//	mmarkConvert(input, target, flags)
+//
+// returns the document rendered for target (html, xml, xml2 or slides) as a
+// string; flags are the renderer flags, i.e. 1 is a standalone document for the
+// XML targets. For an unknown target an Error is returned.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/miekg/mmark"
+)
+
+func convert(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return js.Global().Get("Error").New("mmarkConvert: need input and target")
+	}
+	flags := 0
+	if len(args) > 2 {
+		flags = args[2].Int()
+	}
+	out, err := mmark.Convert([]byte(args[0].String()), args[1].String(), flags)
+	if err != nil {
+		return js.Global().Get("Error").New(err.Error())
+	}
+	return string(out)
+}
+
+func main() {
+	js.Global().Set("mmarkConvert", js.FuncOf(convert))
+	js.Global().Set("mmarkVersion", mmark.Version)
+	select {} // keep the functions alive
+}
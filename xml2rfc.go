@@ -3,8 +3,12 @@ package mmark
 import (
 	"bytes"
 	"fmt"
+	htmllib "html"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 )
 
@@ -26,8 +30,23 @@ var (
 
 	// CitationsW3C is the URL where the citations for W3C documents are.
 	CitationsW3C = CitationsBase + "bibxml4/"
+
+	// ReferenceFile, when not empty, is a text/template that gives the file or URL
+	// of the reference for a citation, with .Anchor (I-D.ietf-foo-bar), .Version
+	// (07 or empty) and .Default (the file mmark would use) as fields, for instance
+	// "refs/{{.Anchor}}{{if .Version}}-{{.Version}}{{end}}.xml".
+	ReferenceFile = ""
 )
 
+// referenceTemplate is ReferenceFile parsed, or the error parsing it. Documents are
+// parsed concurrently, so it is only used with the lock held.
+var referenceTemplate struct {
+	sync.Mutex
+	text string
+	tmpl *template.Template
+	err  error
+}
+
 const (
 	referenceRFC      = "reference.RFC."
 	referenceID       = "reference.I-D.draft-"
@@ -42,7 +61,56 @@ const (
 // create http://<CitationsID>/reference.I-D.draft-ietf-dane-openpgpkey-02.xml
 // without an sequence number it becomes:
 // http://<CitationsID>/reference.I-D.ietf-dane-openpgpkey.xml
-func referenceFile(c *citation) string {
+func referenceFile(p *parser, c *citation) string {
+	if c.file != "" {
+		return c.file
+	}
+	f := defaultReferenceFile(c)
+	if ReferenceFile == "" {
+		return f
+	}
+	referenceTemplate.Lock()
+	if referenceTemplate.text != ReferenceFile {
+		referenceTemplate.text = ReferenceFile
+		referenceTemplate.tmpl, referenceTemplate.err = template.New("reference").Parse(ReferenceFile)
+	}
+	tmpl, err := referenceTemplate.tmpl, referenceTemplate.err
+	referenceTemplate.Unlock()
+	if err == nil {
+		var file string
+		if file, err = executeReferenceTemplate(tmpl, c, f); err == nil {
+			return file
+		}
+	}
+	referenceTemplateError(p, c, err, f)
+	return f
+}
+
+// referenceTemplateError warns, on the line of the citation c, that the reference
+// file template failed with err and f is used instead.
+func referenceTemplateError(p *parser, c *citation, err error, f string) {
+	line := p.line
+	defer func() { p.line = line }()
+	p.line = c.line
+	warnf(p, "error in reference file template for `%s': %s, using %s", c.link, err, f)
+}
+
+// executeReferenceTemplate executes a reference file template, see ReferenceFile,
+// for c. Def is the file mmark would use.
+func executeReferenceTemplate(tmpl *template.Template, c *citation, def string) (string, error) {
+	data := struct{ Anchor, Version, Default string }{Anchor: string(c.link), Default: def}
+	if c.seq != -1 {
+		data.Version = fmt.Sprintf("%02d", c.seq)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// defaultReferenceFile is the reference file for c on the xml2rfc tools site.
+func defaultReferenceFile(c *citation) string {
 	if len(c.link) < 4 {
 		return ""
 	}
@@ -77,6 +145,166 @@ func referenceFile(c *citation) string {
 	return ""
 }
 
+// citePart is a citation of a part of a reference, see citationSection.
+type citePart struct {
+	label    string // Section or Appendix
+	section  string // 3.2
+	relative string // #section-3.2, may be empty
+	format   string // of, comma or parens, the sectionFormat in XML2RFC v3
+}
+
+// citationSection parses the title of a citation of a part of a reference, in
+// [@RFC7230 Section 3.2]. The title can be:
+//
+//	Section 3.2       [RFC7230], Section 3.2
+//	(Section 3.2)     [RFC7230] (Section 3.2)
+//	of Section 3.2    Section 3.2 of [RFC7230]
+//
+// Appendix works as Section, and a #fragment at the end is the relative URL of the part.
+func citationSection(title []byte) (citePart, bool) {
+	c := citePart{format: "comma"}
+	t := strings.TrimSpace(string(title))
+	if strings.HasPrefix(t, "(") && strings.HasSuffix(t, ")") {
+		c.format = "parens"
+		t = t[1 : len(t)-1]
+	}
+	f := strings.Fields(t)
+	if len(f) > 0 && f[0] == "of" && c.format == "comma" {
+		c.format = "of"
+		f = f[1:]
+	}
+	if len(f) < 2 || len(f) > 3 || (f[0] != "Section" && f[0] != "Appendix") {
+		return c, false
+	}
+	if len(f) == 3 {
+		if !strings.HasPrefix(f[2], "#") {
+			return c, false
+		}
+		c.relative = f[2]
+	}
+	c.label, c.section = f[0], f[1]
+	return c, true
+}
+
+// citationFragment returns the title of a citation of a part given as an anchor in
+// the cited document, [@RFC7950#section-7.19]: section-7.19 becomes "Section 7.19
+// #section-7.19" and appendix-a "Appendix A #appendix-a". Other anchors can't be
+// cited as a part, ok is false for those.
+func citationFragment(frag []byte) (title []byte, ok bool) {
+	f := string(frag)
+	for _, part := range []string{"Section", "Appendix"} {
+		prefix := strings.ToLower(part) + "-"
+		if strings.HasPrefix(f, prefix) && len(f) > len(prefix) {
+			return []byte(part + " " + strings.ToUpper(f[len(prefix):]) + " #" + f), true
+		}
+	}
+	return nil, false
+}
+
+// around returns cite, the rendered citation, with the part added as text.
+func (c citePart) around(cite string) string {
+	part := c.label + " " + c.section
+	switch c.format {
+	case "of":
+		return part + " of " + cite
+	case "parens":
+		return cite + " (" + part + ")"
+	}
+	return cite + ", " + part
+}
+
+// canonicalAnchor returns the anchor id refers to: the anchor of an alias from
+// the title block, RFC and I-D. in upper case, or the spelling of an anchor that
+// was cited before if id only differs from it in case. Case differences that
+// match more than one anchor are reported and left alone.
+func (p *parser) canonicalAnchor(id []byte) []byte {
+	s := string(id)
+	for alias, anchor := range p.aliases {
+		if strings.EqualFold(alias, s) {
+			printf(p, "citing `%s' as `%s'", s, anchor)
+			return []byte(anchor)
+		}
+	}
+	switch {
+	case len(s) > 3 && strings.EqualFold(s[:3], "RFC") && strings.Trim(s[3:], "0123456789") == "":
+		s = "RFC" + s[3:]
+	case len(s) > 4 && strings.EqualFold(s[:4], "I-D."):
+		s = "I-D." + s[4:]
+	}
+	if _, ok := p.citations[s]; ok {
+		return []byte(s)
+	}
+	matches := []string{}
+	for k := range p.citations {
+		if strings.EqualFold(k, s) {
+			matches = append(matches, k)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return []byte(s)
+	case 1:
+		return []byte(matches[0])
+	}
+	sort.Strings(matches)
+	warnf(p, "citation `%s' matches %s, which differ only in case", s, strings.Join(matches, ", "))
+	return []byte(s)
+}
+
+// draftVersion splits a versioned draft anchor, I-D.ietf-foo-bar-07, into the
+// anchor and the version. If there is no version, seq is -1.
+func draftVersion(id []byte) (anchor []byte, seq int) {
+	if !bytes.HasPrefix(id, []byte("I-D.")) {
+		return id, -1
+	}
+	name, seq := DocNameRevision(string(id))
+	return id[:len(name)], seq
+}
+
+// unversionedDrafts warns about the drafts in the normative references that are
+// not pinned to a version.
+func (p *parser) unversionedDrafts() {
+	_, _, keys := countCitationsAndSort(p.citations)
+	for _, k := range keys {
+		c := p.citations[k]
+		if c.typ == 'n' && c.xml == nil && c.seq == -1 && bytes.HasPrefix(c.link, []byte("I-D.")) {
+			warnf(p, "normative reference %s has no version, pin it with [@!%s-NN]", k, k)
+		}
+	}
+}
+
+// referenceGroup is a references section with the citations of type typ.
+type referenceGroup struct {
+	typ   byte
+	title string
+}
+
+// referenceGroups returns the references sections: normative, informative and
+// the groups from the title block, sorted on their letter.
+func referenceGroups(block *TitleBlock) []referenceGroup {
+	groups := []referenceGroup{{'n', "Normative References"}, {'i', "Informative References"}}
+	if block == nil {
+		return groups
+	}
+	if block.References.Normative != "" {
+		groups[0].title = block.References.Normative
+	}
+	if block.References.Informative != "" {
+		groups[1].title = block.References.Informative
+	}
+	letters := make([]string, 0, len(block.References.Groups))
+	for l := range block.References.Groups {
+		if len(l) == 1 && l != "n" && l != "i" {
+			letters = append(letters, l)
+		}
+	}
+	sort.Strings(letters)
+	for _, l := range letters {
+		groups = append(groups, referenceGroup{l[0], block.References.Groups[l]})
+	}
+	return groups
+}
+
 // countCitationsAndSort returns the number of informative and normative
 // references and a string slice with the sorted keys.
 func countCitationsAndSort(citations map[string]*citation) (int, int, []string) {
@@ -104,6 +332,53 @@ var entityConvert = map[byte][]byte{
 	//	'"': []byte("&quot;"),
 }
 
+// xmlEntities are the entities XML itself defines.
+var xmlEntities = map[string]bool{"&amp;": true, "&lt;": true, "&gt;": true, "&quot;": true, "&apos;": true}
+
+// xmlEntity writes entity for XML2RFC. Numeric entities are decoded by the parser
+// and only need escaping, the ones XML defines are kept and other HTML entities are
+// written in UTF-8 or, when numeric is true, as numeric character references.
+// Unknown entities are warned about and written as text.
+func xmlEntity(p *parser, out *bytes.Buffer, entity []byte, numeric bool) {
+	if len(entity) == 0 || entity[0] != '&' {
+		writeEntity(out, entity)
+		return
+	}
+	if xmlEntities[string(entity)] {
+		out.Write(entity)
+		return
+	}
+	s := htmllib.UnescapeString(string(entity))
+	if s == string(entity) {
+		warnf(p, "entity not defined: %s", entity)
+		writeEntity(out, entity)
+		return
+	}
+	if !numeric {
+		out.WriteString(s)
+		return
+	}
+	for _, r := range s {
+		out.WriteString("&#" + strconv.Itoa(int(r)) + ";")
+	}
+}
+
+// xmlDeclaration is the XML declaration the XML renderers start a document with.
+const xmlDeclaration = "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"
+
+// xmlCoding changes the encoding in the XML declaration out starts with to the
+// coding of the title block. The title block is rendered after the declaration,
+// so out then only holds the declaration and the DOCTYPE.
+func xmlCoding(out *bytes.Buffer, block *TitleBlock) {
+	if block.Coding == "" || block.Coding == codings[0] || !bytes.HasPrefix(out.Bytes(), []byte(xmlDeclaration)) {
+		return
+	}
+	rest := append([]byte{}, out.Bytes()[len(xmlDeclaration):]...)
+	out.Reset()
+	out.WriteString("<?xml version=\"1.0\" encoding=\"" + block.Coding + "\"?>\n")
+	out.Write(rest)
+}
+
 func writeEntity(out *bytes.Buffer, text []byte) {
 	for i := 0; i < len(text); i++ {
 		if s, ok := entityConvert[text[i]]; ok {
@@ -135,55 +410,88 @@ func sanitizeXML(s []byte) []byte {
 	return s[:j]
 }
 
-// writeSanitizeXML strips XML from a string and writes
-// to out.
-func writeSanitizeXML(out *bytes.Buffer, s []byte) {
-	inTag := false
+// writePlainXML writes the text of the rendered XML s to out, for where no
+// elements are allowed: attributes and, in xml2rfc v2, <ttcol>. Quotes are
+// escaped, a <vspace/> becomes a space and an <xref> without content is replaced
+// by its target in brackets. A warning is given when other elements are removed,
+// where says what s is.
+func writePlainXML(p *parser, out *bytes.Buffer, s []byte, where string) {
+	n := out.Len()
+	stripped := false
 	for i := 0; i < len(s); i++ {
-		if s[i] == '<' {
-			inTag = true
+		if s[i] == '"' {
+			out.WriteString("&quot;")
 			continue
 		}
-		if s[i] == '>' {
-			inTag = false
+		if s[i] != '<' {
+			out.WriteByte(s[i])
 			continue
 		}
-		if !inTag {
-			out.WriteByte(s[i])
+		j := bytes.IndexByte(s[i:], '>')
+		if j < 0 {
+			break
+		}
+		tag := s[i : i+j+1]
+		if bytes.HasPrefix(tag, []byte("<vspace")) {
+			out.WriteByte(' ')
+			i += j
+			continue
+		}
+		if bytes.HasPrefix(tag, []byte("<xref ")) && bytes.HasSuffix(tag, []byte("/>")) {
+			if k := bytes.Index(tag, []byte(" target=\"")); k > 0 {
+				target := tag[k+9:]
+				out.WriteByte('[')
+				out.Write(target[:bytes.IndexByte(target, '"')])
+				out.WriteByte(']')
+			}
 		}
+		stripped = true
+		i += j
+	}
+	if stripped {
+		warnf(p, "elements are not allowed in %s, using its text: '%s'", where, out.Bytes()[n:])
 	}
 }
 
+// writePlainText calls text and replaces what it rendered with its plain text,
+// see writePlainXML.
+func writePlainText(p *parser, out *bytes.Buffer, text func() bool, where string) {
+	marker := out.Len()
+	text()
+	rendered := append([]byte{}, out.Bytes()[marker:]...)
+	out.Truncate(marker)
+	writePlainXML(p, out, rendered, where)
+}
+
 // titleBlockTOMLAuthor outputs the author from the TOML title block.
 func titleBlockTOMLAuthor(out *bytes.Buffer, a author) {
 	out.WriteString("<author")
 
 	if a.Role != "" {
 		out.WriteString(" role=\"")
-		writeEntity(out, []byte(a.Role))
+		attrEscape(out, []byte(a.Role))
 		out.WriteString("\"")
 	}
 
 	out.WriteString(" initials=\"")
-	writeEntity(out, []byte(a.Initials))
+	attrEscape(out, []byte(a.Initials))
 	out.WriteString("\"")
 
 	out.WriteString(" surname=\"")
-	writeEntity(out, []byte(a.Surname))
+	attrEscape(out, []byte(a.Surname))
 	out.WriteString("\"")
 
 	out.WriteString(" fullname=\"")
-	writeEntity(out, []byte(a.Fullname))
+	attrEscape(out, []byte(a.Fullname))
 	out.WriteString("\">\n")
 
-	abbrev := ""
-	if a.OrganizationAbbrev != "" {
-		abbrev = " abbrev=\"" + a.OrganizationAbbrev + "\""
-	}
+	name, abbrev := a.organization()
 	out.WriteString("<organization")
-	writeEntity(out, []byte(abbrev))
+	if abbrev != "" {
+		out.WriteString(" abbrev=\"" + escapeString(abbrev) + "\"")
+	}
 	out.WriteString(">")
-	writeEntity(out, []byte(a.Organization))
+	writeEntity(out, []byte(name))
 	out.WriteString("</organization>\n")
 
 	out.WriteString("<address>\n")
@@ -236,9 +544,9 @@ func titleBlockTOMLAuthor(out *bytes.Buffer, a author) {
 
 	out.WriteString("</postal>\n")
 
-	out.WriteString("<phone>" + a.Address.Phone + "</phone>\n")
-	out.WriteString("<email>" + a.Address.Email + "</email>\n")
-	out.WriteString("<uri>" + a.Address.Uri + "</uri>\n")
+	out.WriteString("<phone>" + escapeString(a.Address.Phone) + "</phone>\n")
+	out.WriteString("<email>" + escapeString(a.Address.Email) + "</email>\n")
+	out.WriteString("<uri>" + escapeString(a.Address.Uri) + "</uri>\n")
 
 	out.WriteString("</address>\n")
 	out.WriteString("</author>\n")
@@ -264,14 +572,14 @@ func titleBlockTOMLDate(out *bytes.Buffer, d time.Time) {
 // titleBlockTOMLKeyword outputs the keywords from the TOML title block.
 func titleBlockTOMLKeyword(out *bytes.Buffer, keywords []string) {
 	for _, k := range keywords {
-		out.WriteString("<keyword>" + k + "</keyword>\n")
+		out.WriteString("<keyword>" + escapeString(k) + "</keyword>\n")
 	}
 }
 
 // titleBlockTOMLPI returns "yes" or "no" or a stringified number
 // for use as process instruction. If version is 3 they are returned
 // as attributes for use *inside* the <rfc> tag.
-func titleBlockTOMLPI(pi pi, name string, version int) string {
+func titleBlockTOMLPI(p *parser, pi pi, name string, version int) string {
 	if version == 2 {
 		switch name {
 		case "toc":
@@ -294,14 +602,14 @@ func titleBlockTOMLPI(pi pi, name string, version int) string {
 			if pi.Header == piNotSet {
 				return ""
 			}
-			return "<?rfc header=\"" + pi.Header + "\"?>\n"
+			return "<?rfc header=\"" + escapeString(pi.Header) + "\"?>\n"
 		case "footer":
 			if pi.Footer == piNotSet {
 				return ""
 			}
-			return "<?rfc footer=\"" + pi.Footer + "\"?>\n"
+			return "<?rfc footer=\"" + escapeString(pi.Footer) + "\"?>\n"
 		default:
-			printf(nil, "unhandled or unknown PI seen: %s", name)
+			warnf(p, "unhandled or unknown PI seen: %s", name)
 			return ""
 		}
 	}
@@ -309,6 +617,118 @@ func titleBlockTOMLPI(pi pi, name string, version int) string {
 	return ""
 }
 
+// piAttributes maps the processing instructions with an equivalent <rfc>
+// attribute in xml2rfc v3 to that attribute.
+var piAttributes = map[string]string{
+	"toc":      "tocInclude",
+	"tocdepth": "tocDepth",
+	"symrefs":  "symRefs",
+	"sortrefs": "sortRefs",
+}
+
+// titleBlockTOMLPIAttributes returns the processing instructions set in the title
+// block as xml2rfc v3 <rfc> attributes, the ones without an equivalent are
+// ignored with a warning.
+func titleBlockTOMLPIAttributes(p *parser, pi pi) string {
+	set := map[string]string{
+		"toc": pi.Toc, "symrefs": pi.Symrefs, "sortrefs": pi.Sortrefs, "compact": pi.Compact,
+		"subcompact": pi.Subcompact, "private": pi.Private, "topblock": pi.Topblock, "comments": pi.Comments,
+	}
+	if pi.Header != piNotSet {
+		set["header"] = pi.Header
+	}
+	if pi.Footer != piNotSet {
+		set["footer"] = pi.Footer
+	}
+	for k, v := range pi.Extra {
+		set[strings.ToLower(k)] = v
+	}
+	names := []string{}
+	for name, v := range set {
+		if v != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	attrs := ""
+	for _, name := range names {
+		attr, ok := piAttributes[name]
+		if !ok {
+			warnf(p, "PI %s has no xml2rfc v3 equivalent, ignoring it", name)
+			continue
+		}
+		v := set[name]
+		switch v {
+		case "yes":
+			v = "true"
+		case "no":
+			v = "false"
+		}
+		attrs += " " + attr + "=\"" + escapeString(v) + "\""
+	}
+	return attrs
+}
+
+// expires returns the date an Internet-Draft written on date expires, which
+// is 185 days later.
+func expires(date time.Time) time.Time { return date.AddDate(0, 0, 185) }
+
+// running holds the values the header and footer processing instructions can use
+// in a template, e.g. footer = "Expires {{.Expires}}".
+type running struct {
+	Title   string
+	Abbrev  string // the short title, or the title if not set
+	DocName string
+	Authors string // the header convention: "Surname", "Surname & Surname" or "Surname, et al."
+	Date    string // as "January 2006"
+	Expires string // as "July 5, 2006"
+}
+
+// runningText executes the header or footer template s with the values of block.
+// If s is not a template it is returned as is. The text is not escaped, that is
+// done when the processing instruction is written.
+func runningText(p *parser, s string, block TitleBlock) string {
+	if s == piNotSet || !strings.Contains(s, "{{") {
+		return s
+	}
+	t, err := template.New("pi").Parse(s)
+	if err != nil {
+		warnf(p, "error in header or footer template: %s", err)
+		return s
+	}
+	surnames := []string{}
+	for _, a := range block.Author {
+		surname := a.Surname
+		if surname == "" {
+			if f := strings.Fields(a.Fullname); len(f) > 0 {
+				surname = f[len(f)-1]
+			}
+		}
+		surnames = append(surnames, surname)
+	}
+	r := running{Title: block.Title, Abbrev: block.Abbrev, DocName: block.DocName,
+		Date: block.Date.Format("January 2006"), Expires: expires(block.Date).Format("January 2, 2006")}
+	if r.Abbrev == "" {
+		r.Abbrev = r.Title
+	}
+	switch len(surnames) {
+	case 0:
+	case 1:
+		r.Authors = surnames[0]
+	case 2:
+		r.Authors = surnames[0] + " & " + surnames[1]
+	default:
+		r.Authors = surnames[0] + ", et al."
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, r); err != nil {
+		warnf(p, "error in header or footer template: %s", err)
+		return s
+	}
+	return buf.String()
+}
+
 func yesno(s, def string) string {
 	if s == "" {
 		return def
@@ -5,6 +5,7 @@ package mmark
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -13,7 +14,10 @@ import (
 
 // XML renderer configuration options.
 const (
-	XML2_STANDALONE = 1 << iota // create standalone document
+	XML2_STANDALONE    = 1 << iota // create standalone document
+	XML2_SKIP_HTML                 // skip inline HTML
+	XML2_ESCAPE_HTML               // output inline HTML as text
+	XML2_TRANSLITERATE             // replace non-ASCII characters, see Transliterations
 )
 
 // Xml2 is a type that implements the Renderer interface for XML2RFV3 output.
@@ -26,15 +30,18 @@ type xml2 struct {
 	part           bool // parts cannot nest, if true a part has been opened
 	specialSection int  // are we in a special section
 	paraInList     bool // subsequent paras in lists are faked with vspace
+	para           bool // in a <t>, which a figure closes and reopens
 
 	// store the IAL we see for this block element
 	ial *inlineAttr
 
 	// titleBlock in TOML
-	titleBlock *title
+	titleBlock *TitleBlock
 
 	// (@good) example list group counter
 	group map[string]int
+
+	p *parser // for reporting diagnostics
 }
 
 // Xml2Renderer creates and configures a Xml2 object, which
@@ -47,6 +54,19 @@ func Xml2Renderer(flags int) Renderer {
 func (options *xml2) Flags() int { return options.flags }
 func (options *xml2) State() int { return 0 }
 
+// RawHTML returns if inline HTML is skipped or escaped.
+func (options *xml2) RawHTML() (skip, escape bool) {
+	return options.flags&XML2_SKIP_HTML != 0, options.flags&XML2_ESCAPE_HTML != 0
+}
+
+// Capabilities returns what xml2rfc v2 can output, only math as artwork.
+func (options *xml2) Capabilities() int { return CAPABILITY_MATH }
+
+func (options *xml2) setParser(p *parser) {
+	options.p = p
+	p.translit.on = options.flags&XML2_TRANSLITERATE != 0
+}
+
 func (options *xml2) SetAttr(i *inlineAttr) {
 	options.ial = i
 }
@@ -85,7 +105,8 @@ func (options *xml2) AttrString(i *inlineAttr) string {
 }
 
 // render code chunks using verbatim, or listings if we have a language
-func (options *xml2) BlockCode(out *bytes.Buffer, text []byte, lang string, caption []byte, subfigure, callout bool) {
+func (options *xml2) BlockCode(out *bytes.Buffer, text []byte, info CodeInfo, caption []byte, subfigure, callout bool) {
+	lang := info.Lang
 	ial := options.Attr()
 	ial.GetOrDefaultAttr("align", "center")
 
@@ -101,10 +122,16 @@ func (options *xml2) BlockCode(out *bytes.Buffer, text []byte, lang string, capt
 		ialArtwork.SetAttr("type", lang)
 	}
 	ial.DropAttr("type")
+	options.figureAttr(ial)
+	if info.Title != "" {
+		ialArtwork.SetAttr("name", info.Title)
+	}
 
 	// subfigure stuff. TODO(miek): check
 	if len(caption) > 0 {
-		ial.GetOrDefaultAttr("title", string(sanitizeXML(caption)))
+		var title bytes.Buffer
+		writePlainXML(options.p, &title, caption, "a figure caption")
+		ial.GetOrDefaultAttr("title", title.String())
 	}
 	s := options.AttrString(ial)
 
@@ -119,6 +146,45 @@ func (options *xml2) BlockCode(out *bytes.Buffer, text []byte, lang string, capt
 	out.WriteString("</artwork></figure>\n")
 }
 
+// figureAttributes are the attributes of <figure> in xml2rfc v2, with their
+// valid values, nil allows any value.
+var figureAttributes = map[string][]string{
+	"align":          {"left", "center", "right"},
+	"alt":            nil,
+	"height":         nil,
+	"src":            nil,
+	"suppress-title": {"true", "false"},
+	"title":          nil,
+	"width":          nil,
+}
+
+// figureAttr drops, with a warning, the attributes in ial that are not valid on
+// a <figure>, e.g. {suppress-title="true" align="left" alt="..."} is kept.
+func (options *xml2) figureAttr(ial *inlineAttr) {
+	for _, k := range ial.SortAttributes() {
+		values, ok := figureAttributes[k]
+		if !ok {
+			warnf(options.p, "attribute %s is not valid on a figure in xml2rfc v2, dropping it", k)
+			ial.DropAttr(k)
+			continue
+		}
+		if values == nil {
+			continue
+		}
+		v := ial.Value(k)
+		valid := false
+		for _, value := range values {
+			if v == value {
+				valid = true
+			}
+		}
+		if !valid {
+			warnf(options.p, "attribute %s of a figure must be one of %s, not %q, dropping it", k, strings.Join(values, ", "), v)
+			ial.DropAttr(k)
+		}
+	}
+}
+
 func (options *xml2) CalloutCode(out *bytes.Buffer, index, id string) {
 	// Should link to id
 	attrEscape(out, []byte("<"))
@@ -138,15 +204,16 @@ func (options *xml2) CalloutText(out *bytes.Buffer, index string, id []string) {
 	out.WriteByte(')')
 }
 
-func (options *xml2) TitleBlockTOML(out *bytes.Buffer, block *title) {
+func (options *xml2) TitleBlockTOML(out *bytes.Buffer, block *TitleBlock) {
 	if options.flags&XML2_STANDALONE == 0 {
 		return
 	}
 	options.titleBlock = block
+	xmlCoding(out, block)
 	out.WriteString("<rfc")
-	out.WriteString(" ipr=\"" + options.titleBlock.Ipr + "\"")
-	out.WriteString(" category=\"" + options.titleBlock.Category + "\"")
-	out.WriteString(" docName=\"" + options.titleBlock.DocName + "\"")
+	out.WriteString(" ipr=\"" + escapeString(options.titleBlock.Ipr) + "\"")
+	out.WriteString(" category=\"" + escapeString(options.titleBlock.Category) + "\"")
+	out.WriteString(" docName=\"" + escapeString(options.titleBlock.DocName) + "\"")
 	if len(options.titleBlock.Updates) > 0 {
 		updates := make([]string, len(options.titleBlock.Updates))
 		for i := range updates {
@@ -167,14 +234,27 @@ func (options *xml2) TitleBlockTOML(out *bytes.Buffer, block *title) {
 	out.WriteString(">\n")
 
 	// Default processing instructions
-	for _, p := range PIs {
-		out.WriteString(titleBlockTOMLPI(options.titleBlock.PI, p, 2))
+	pi := options.titleBlock.PI
+	pi.Header = runningText(options.p, pi.Header, *options.titleBlock)
+	pi.Footer = runningText(options.p, pi.Footer, *options.titleBlock)
+	for _, name := range PIs {
+		out.WriteString(titleBlockTOMLPI(options.p, pi, name, 2))
+	}
+	extra := []string{}
+	for k := range pi.Extra {
+		extra = append(extra, k)
+	}
+	sort.Strings(extra)
+	for _, k := range extra {
+		out.WriteString("<?rfc " + k + "=\"")
+		attrEscape(out, []byte(pi.Extra[k]))
+		out.WriteString("\"?>\n")
 	}
 
 	out.WriteString("<front>\n")
 	options.docLevel = _DOC_FRONT_MATTER
-	out.WriteString("<title abbrev=\"" + options.titleBlock.Abbrev + "\">")
-	out.WriteString(options.titleBlock.Title + "</title>\n\n")
+	out.WriteString("<title abbrev=\"" + escapeString(options.titleBlock.Abbrev) + "\">")
+	out.WriteString(escapeString(options.titleBlock.Title) + "</title>\n\n")
 
 	for _, a := range options.titleBlock.Author {
 		titleBlockTOMLAuthor(out, a)
@@ -182,8 +262,8 @@ func (options *xml2) TitleBlockTOML(out *bytes.Buffer, block *title) {
 
 	titleBlockTOMLDate(out, options.titleBlock.Date)
 
-	out.WriteString("<area>" + options.titleBlock.Area + "</area>\n")
-	out.WriteString("<workgroup>" + options.titleBlock.Workgroup + "</workgroup>\n")
+	out.WriteString("<area>" + escapeString(options.titleBlock.Area) + "</area>\n")
+	out.WriteString("<workgroup>" + escapeString(options.titleBlock.Workgroup) + "</workgroup>\n")
 
 	titleBlockTOMLKeyword(out, options.titleBlock.Keyword)
 	out.WriteString("\n")
@@ -226,7 +306,11 @@ func (options *xml2) BlockQuote(out *bytes.Buffer, text []byte, attribution []by
 }
 
 func (options *xml2) Aside(out *bytes.Buffer, text []byte) {
-	options.BlockQuote(out, text, nil)
+	// An indented block, like a block quote, that starts with a marker.
+	options.Attr()
+	out.WriteString("<t><list style=\"empty\">\n<t>Aside:</t>\n")
+	out.Write(text)
+	out.WriteString("</list></t>\n")
 }
 
 func (options *xml2) CommentHtml(out *bytes.Buffer, text []byte) {
@@ -263,14 +347,17 @@ func (options *xml2) CommentHtml(out *bytes.Buffer, text []byte) {
 }
 
 func (options *xml2) BlockHtml(out *bytes.Buffer, text []byte) {
-	printf(nil, "syntax not supported: BlockHtml")
+	unsupported(options.p, "BlockHtml", "")
 }
 
 func (options *xml2) Part(out *bytes.Buffer, text func() bool, id string) {
-	printf(nil, "syntax not supported: Part")
+	unsupported(options.p, "Part", "")
 }
 
 func (options *xml2) Note(out *bytes.Buffer, text func() bool, id string) {
+	if options.docLevel == _DOC_MAIN_MATTER || options.docLevel == _DOC_BACK_MATTER {
+		unsupported(options.p, "Note", "notes are only allowed in the front matter")
+	}
 	switch options.specialSection {
 	case _ABSTRACT:
 		out.WriteString("</abstract>\n\n")
@@ -290,7 +377,7 @@ func (options *xml2) Note(out *bytes.Buffer, text func() bool, id string) {
 
 	out.WriteString("\n<note" + options.AttrString(ial))
 	out.WriteString(" title=\"")
-	text()
+	writePlainText(options.p, out, text, "a note title")
 	out.WriteString("\">\n")
 	options.sectionLevel = 0
 	options.specialSection = _NOTE
@@ -299,7 +386,7 @@ func (options *xml2) Note(out *bytes.Buffer, text func() bool, id string) {
 
 func (options *xml2) SpecialHeader(out *bytes.Buffer, what []byte, text func() bool, id string) {
 	if string(what) == "preface" {
-		printf(nil, "handling preface like abstract")
+		printf(options.p, "handling preface like abstract")
 		what = []byte("abstract")
 	}
 	switch options.specialSection {
@@ -334,7 +421,7 @@ func (options *xml2) Header(out *bytes.Buffer, text func() bool, level int, id s
 	}
 
 	if level > options.sectionLevel+1 {
-		printf(nil, "section jump from H%d to H%d, id: \"%s\"", options.sectionLevel, level, id)
+		warnf(options.p, "section jump from H%d to H%d, id: \"%s\"", options.sectionLevel, level, id)
 	}
 
 	if level <= options.sectionLevel {
@@ -352,7 +439,7 @@ func (options *xml2) Header(out *bytes.Buffer, text func() bool, level int, id s
 	// new section
 	out.WriteString("\n<section" + options.AttrString(ial))
 	out.WriteString(" title=\"")
-	text()
+	writePlainText(options.p, out, text, "a section title")
 	out.WriteString("\">\n")
 	options.sectionLevel = level
 	options.specialSection = 0
@@ -360,7 +447,7 @@ func (options *xml2) Header(out *bytes.Buffer, text func() bool, level int, id s
 }
 
 func (options *xml2) HRule(out *bytes.Buffer) {
-	printf(nil, "syntax not supported: HRule")
+	transition(out)
 }
 
 func (options *xml2) List(out *bytes.Buffer, text func() bool, flags, start int, group []byte) {
@@ -410,6 +497,7 @@ func (options *xml2) List(out *bytes.Buffer, text func() bool, flags, start int,
 
 	if !text() {
 		out.Truncate(marker)
+		truncated(options.p, "List")
 		return
 	}
 	switch {
@@ -438,9 +526,9 @@ func (options *xml2) ListItem(out *bytes.Buffer, text []byte, flags int) {
 		// close previous one?/
 		out.WriteString("<t hangText=\"")
 		n := out.Len()
-		writeSanitizeXML(out, text)
+		writePlainXML(options.p, out, text, "a definition term")
 		if n == out.Len() {
-			printf(nil, "no text remained after sanitizing XML for definition term: '"+string(text)+"'")
+			warnf(options.p, "no text remained after sanitizing XML for definition term: '%s'", text)
 		}
 		out.WriteString("\">\n")
 		out.WriteString("<vspace />\n") // Align HTML and XML2 output, but inserting a new line (vspace here)
@@ -462,6 +550,8 @@ func (options *xml2) Paragraph(out *bytes.Buffer, text func() bool, flags int) {
 	marker := out.Len()
 	if flags&_LIST_TYPE_DEFINITION == 0 && flags&_LIST_INSIDE_LIST == 0 {
 		out.WriteString("<t>")
+		options.para = true
+		defer func() { options.para = false }()
 	} else {
 		if options.paraInList && flags&_LIST_ITEM_BEGINNING_OF_LIST != 0 {
 			out.WriteString("<vspace blankLines=\"1\" />\n")
@@ -469,12 +559,17 @@ func (options *xml2) Paragraph(out *bytes.Buffer, text func() bool, flags int) {
 	}
 	if !text() {
 		out.Truncate(marker)
+		truncated(options.p, "Paragraph")
 		return
 	}
 	if marker+3 == out.Len() { // empty paragraph, suppress
 		out.Truncate(marker)
 		return
 	}
+	if options.para && bytes.HasSuffix(out.Bytes(), []byte("<t>")) { // reopened after a figure, drop it
+		out.Truncate(out.Len() - 3)
+		return
+	}
 	out.WriteByte('\n')
 	if flags&_LIST_TYPE_DEFINITION == 0 && flags&_LIST_INSIDE_LIST == 0 {
 		out.WriteString("</t>\n")
@@ -491,7 +586,9 @@ func (options *xml2) Math(out *bytes.Buffer, text []byte, display bool) {
 func (options *xml2) Table(out *bytes.Buffer, header []byte, body []byte, footer []byte, columnData []int, caption []byte) {
 	ial := options.Attr()
 	if caption != nil {
-		ial.GetOrDefaultAttr("title", string(sanitizeXML(caption)))
+		var title bytes.Buffer
+		writePlainXML(options.p, &title, caption, "a table caption")
+		ial.GetOrDefaultAttr("title", title.String())
 	}
 
 	s := options.AttrString(ial)
@@ -509,7 +606,7 @@ func (options *xml2) TableRow(out *bytes.Buffer, text []byte) {
 
 func (options *xml2) TableHeaderCell(out *bytes.Buffer, text []byte, align, colspan int) {
 	if colspan > 1 {
-		printf(nil, "syntax not supported: TableHeaderCell: colspan=%d", colspan)
+		unsupported(options.p, "TableHeaderCell", "colspan="+strconv.Itoa(colspan))
 	}
 	a := ""
 	switch align {
@@ -521,13 +618,13 @@ func (options *xml2) TableHeaderCell(out *bytes.Buffer, text []byte, align, cols
 		a = " align=\"center\""
 	}
 	out.WriteString("<ttcol" + a + ">")
-	writeSanitizeXML(out, text)
+	writePlainXML(options.p, out, text, "a table header")
 	out.WriteString("</ttcol>\n")
 }
 
 func (options *xml2) TableCell(out *bytes.Buffer, text []byte, align, colspan int) {
 	if colspan > 1 {
-		printf(nil, "syntax not supported: TableCell: colspan=%d", colspan)
+		unsupported(options.p, "TableCell", "colspan="+strconv.Itoa(colspan))
 	}
 	out.WriteString("<c>")
 	out.Write(text)
@@ -535,11 +632,11 @@ func (options *xml2) TableCell(out *bytes.Buffer, text []byte, align, colspan in
 }
 
 func (options *xml2) Footnotes(out *bytes.Buffer, text func() bool) {
-	printf(nil, "syntax not supported: Footnotes")
+	unsupported(options.p, "Footnotes", "")
 }
 
 func (options *xml2) FootnoteItem(out *bytes.Buffer, name, text []byte, flags int) {
-	printf(nil, "syntax not supported: FootnoteItem")
+	unsupported(options.p, "FootnoteItem", "")
 }
 
 func (options *xml2) Index(out *bytes.Buffer, primary, secondary []byte, prim bool) {
@@ -552,11 +649,11 @@ func (options *xml2) Index(out *bytes.Buffer, primary, secondary []byte, prim bo
 }
 
 func (options *xml2) Citation(out *bytes.Buffer, link, title []byte) {
-	if len(title) == 0 {
-		out.WriteString("<xref target=\"" + string(link) + "\"/>")
-		return
+	cite := "<xref target=\"" + string(link) + "\"/>"
+	if part, ok := citationSection(title); ok {
+		cite = part.around(cite)
 	}
-	out.WriteString("<xref target=\"" + string(link) + "\"/>")
+	out.WriteString(cite)
 }
 
 func (options *xml2) References(out *bytes.Buffer, citations map[string]*citation) {
@@ -580,43 +677,31 @@ func (options *xml2) References(out *bytes.Buffer, citations map[string]*citatio
 	}
 	options.docLevel = _DOC_BACK_MATTER
 
-	keys := []string{}
-	refi, refn, keys := countCitationsAndSort(citations)
+	_, _, keys := countCitationsAndSort(citations)
 
-	// output <xi:include href="<references file>.xml"/>, we use file it its not empty, otherwise
+	// output <?rfc include="<references file>.xml"?>, we use file it its not empty, otherwise
 	// we construct one for RFCNNNN and I-D.something something.
-	if refi+refn > 0 {
-		if refn > 0 {
-			out.WriteString("<references title=\"Normative References\">\n")
-			for _, k := range keys {
-				c := citations[k]
-				if c.typ == 'n' {
-					if c.xml != nil {
-						out.Write(c.xml)
-						out.WriteByte('\n')
-						continue
-					}
-					f := referenceFile(c)
-					out.WriteString("<?rfc include=\"" + f + "\"?>\n")
-				}
+	for _, g := range referenceGroups(options.titleBlock) {
+		opened := false
+		for _, k := range keys {
+			c := citations[k]
+			if c.typ != g.typ {
+				continue
 			}
-			out.WriteString("</references>\n")
-		}
-		if refi > 0 {
-			out.WriteString("<references title=\"Informative References\">\n")
-			for _, k := range keys {
-				c := citations[k]
-				if c.typ == 'i' {
-					// if we have raw xml, output that
-					if c.xml != nil {
-						out.Write(c.xml)
-						out.WriteByte('\n')
-						continue
-					}
-					f := referenceFile(c)
-					out.WriteString("<?rfc include=\"" + f + "\"?>\n")
-				}
+			if !opened {
+				out.WriteString("<references title=\"" + escapeString(g.title) + "\">\n")
+				opened = true
+			}
+			// if we have raw xml, output that
+			if c.xml != nil {
+				out.Write(c.xml)
+				out.WriteByte('\n')
+				continue
 			}
+			f := referenceFile(options.p, c)
+			out.WriteString("<?rfc include=\"" + f + "\"?>\n")
+		}
+		if opened {
 			out.WriteString("</references>\n")
 		}
 	}
@@ -632,7 +717,14 @@ func (options *xml2) AutoLink(out *bytes.Buffer, link []byte, kind int) {
 }
 
 func (options *xml2) CodeSpan(out *bytes.Buffer, text []byte) {
-	out.WriteString("<spanx style=\"verb\">")
+	style := "verb"
+	switch codeRole(options.Attr()) {
+	case roleKbd:
+		style = "strong"
+	case roleSamp:
+		style = "emph"
+	}
+	out.WriteString("<spanx style=\"" + style + "\">")
 	writeEntity(out, text)
 	out.WriteString("</spanx>")
 }
@@ -674,31 +766,64 @@ func (options *xml2) Figure(out *bytes.Buffer, text []byte, caption []byte) {
 	out.Write(text)
 }
 
+// Image renders a local image as an <artwork> with src in a <figure> and a remote
+// one as an <eref> to it, in a <figure> when there is a title.
 func (options *xml2) Image(out *bytes.Buffer, link []byte, title []byte, alt []byte, subfigure bool) {
-	// convert to url or image wrapped in figure
 	ial := options.Attr()
 	ial.GetOrDefaultAttr("align", "center")
 	ial.DropAttr("type") // type may be set, but is not valid in xml 2 syntax
+	options.figureAttr(ial)
 
-	s := options.AttrString(ial)
+	remote := bytes.HasPrefix(link, []byte("http://")) || bytes.HasPrefix(link, []byte("https://"))
+	if remote && len(title) == 0 {
+		options.imageLink(out, link, alt)
+		return
+	}
+	if options.para {
+		// a figure can't be in a <t>, close it, or drop it when still empty
+		if bytes.HasSuffix(out.Bytes(), []byte("<t>")) {
+			out.Truncate(out.Len() - 3)
+		} else {
+			out.WriteString("\n</t>\n")
+		}
+		defer out.WriteString("<t>")
+	}
+
+	out.WriteString("<figure" + options.AttrString(ial))
 	if len(title) != 0 {
-		out.WriteString("<figure" + s + " title=\"")
-		title1 := sanitizeXML(title)
-		out.Write(title1)
-		out.WriteString("\">\n")
-		// empty artwork
-		out.WriteString("<artwork" + ial.Key("align") + ">" + string(link) + "</artwork>\n")
-		out.WriteString("<postamble>")
+		out.WriteString(" title=\"")
+		out.Write(sanitizeXML(title))
+		out.WriteString("\"")
+	}
+	out.WriteString(">\n")
+	if !remote {
+		ialArtwork := newInlineAttr()
+		if align := ial.Value("align"); align != "" {
+			ialArtwork.SetAttr("align", align)
+		}
+		ialArtwork.SetAttr("src", escapeString(string(link)))
+		if len(alt) != 0 {
+			ialArtwork.SetAttr("alt", escapeString(string(alt)))
+		}
+		out.WriteString("<artwork" + options.AttrString(ialArtwork) + "/>\n")
+		out.WriteString("</figure>\n")
+		return
 	}
+	// an empty artwork, a figure must have one
+	out.WriteString("<artwork" + ial.Key("align") + "/>\n")
+	out.WriteString("<postamble>")
+	options.imageLink(out, link, alt)
+	out.WriteString("</postamble>\n")
+	out.WriteString("</figure>\n")
+}
+
+// imageLink renders a link to a remote image, with the alt text as its text.
+func (options *xml2) imageLink(out *bytes.Buffer, link, alt []byte) {
 	out.WriteString("<eref target=\"")
-	out.Write(link)
+	attrEscape(out, link)
 	out.WriteString("\">")
-	out.Write(alt)
+	writeEntity(out, alt)
 	out.WriteString("</eref>")
-	if len(title) != 0 {
-		out.WriteString("</postamble>\n")
-		out.WriteString("</figure>\n")
-	}
 }
 
 func (options *xml2) LineBreak(out *bytes.Buffer) {
@@ -724,14 +849,34 @@ func (options *xml2) Abbreviation(out *bytes.Buffer, abbr, title []byte) {
 }
 
 func (options *xml2) RawHtmlTag(out *bytes.Buffer, tag []byte) {
-	// We recognize a few tags: <br/>
 	switch {
-	case bytes.Compare(tag, []byte("<br/>")) == 0:
-		out.WriteString("<vspace/>\n")
+	case options.flags&XML2_SKIP_HTML != 0:
+		return
+	case options.flags&XML2_ESCAPE_HTML != 0:
+		attrEscape(out, tag)
 		return
 	}
-
-	printf(nil, "syntax not supported: RawHtmlTag: %s", string(tag))
+	// We map the tags that have an XML2RFC equivalent, there is no
+	// superscript and subscript, so these are done as in Superscript
+	// and Subscript.
+	name, closing := htmlTagName(tag)
+	switch name {
+	case "br":
+		out.WriteString("<vspace/>\n")
+	case "sup":
+		out.WriteByte('^')
+	case "sub":
+		out.WriteByte('~')
+	case "tt", "em", "strong":
+		if closing {
+			out.WriteString("</spanx>")
+			return
+		}
+		style := map[string]string{"tt": "verb", "em": "emph", "strong": "strong"}[name]
+		out.WriteString("<spanx style=\"" + style + "\">")
+	default:
+		unsupported(options.p, "RawHtmlTag", string(tag))
+	}
 }
 
 func (options *xml2) TripleEmphasis(out *bytes.Buffer, text []byte) {
@@ -741,15 +886,40 @@ func (options *xml2) TripleEmphasis(out *bytes.Buffer, text []byte) {
 }
 
 func (options *xml2) StrikeThrough(out *bytes.Buffer, text []byte) {
+	unsupported(options.p, "StrikeThrough", "")
+	out.Write(text)
+}
+
+// Changes are made visible with a cref, which only holds text in xml2rfc v2.
+func (options *xml2) Insertion(out *bytes.Buffer, text []byte) {
+	out.WriteString("<cref>Insert: ")
+	writePlainXML(options.p, out, text, "a cref")
+	out.WriteString("</cref>")
+}
+
+func (options *xml2) Deletion(out *bytes.Buffer, text []byte) {
+	out.WriteString("<cref>Delete: ")
+	writePlainXML(options.p, out, text, "a cref")
+	out.WriteString("</cref>")
+}
+
+func (options *xml2) CriticComment(out *bytes.Buffer, text []byte) {
+	out.WriteString("<cref>")
+	writePlainXML(options.p, out, text, "a cref")
+	out.WriteString("</cref>")
+}
+
+func (options *xml2) Highlight(out *bytes.Buffer, text []byte) {
 	out.Write(text)
 }
 
 func (options *xml2) FootnoteRef(out *bytes.Buffer, ref []byte, id int) {
-	printf(nil, "syntax not supported: FootnoteRef")
+	unsupported(options.p, "FootnoteRef", "")
 }
 
 func (options *xml2) Entity(out *bytes.Buffer, entity []byte) {
-	out.Write(entity)
+	// Only numeric references are sure to be understood by xml2rfc.
+	xmlEntity(options.p, out, entity, true)
 }
 
 func (options *xml2) NormalText(out *bytes.Buffer, text []byte) {
@@ -761,7 +931,7 @@ func (options *xml2) DocumentHeader(out *bytes.Buffer, first bool) {
 	if !first || options.flags&XML2_STANDALONE == 0 {
 		return
 	}
-	out.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	out.WriteString(xmlDeclaration)
 	out.WriteString("<!DOCTYPE rfc SYSTEM 'rfc2629.dtd' []>\n")
 }
 
@@ -11,9 +11,16 @@ import (
 
 // XML renderer configuration options.
 const (
-	XML_STANDALONE = 1 << iota // create standalone document
+	XML_STANDALONE        = 1 << iota // create standalone document
+	XML_PARAGRAPH_NUMBERS             // add pn attributes to top level paragraphs
+	XML_SKIP_HTML                     // skip inline HTML
+	XML_ESCAPE_HTML                   // output inline HTML as text
 )
 
+// Transition is the text of the paragraph a horizontal rule becomes in XML2RFC
+// output. When empty, an empty paragraph is used to separate the text.
+var Transition = "* * *"
+
 var words2119 = map[string]bool{
 	"MUST":        true,
 	"MUST NOT":    true,
@@ -37,12 +44,15 @@ type xml struct {
 	part           bool // parts cannot nest, if true a part has been opened
 	specialSection int
 	para           bool // when true we're in a para, artworks need to close it first then.
+	pn             paragraphNumbers
 
 	// Store the IAL we see for this block element
 	ial *inlineAttr
 
 	// TitleBlock in TOML
-	titleBlock *title
+	titleBlock *TitleBlock
+
+	p *parser // for reporting diagnostics
 }
 
 // XmlRenderer creates and configures a Xml object, which
@@ -53,6 +63,17 @@ func XmlRenderer(flags int) Renderer { return &xml{flags: flags} }
 func (options *xml) Flags() int      { return options.flags }
 func (options *xml) State() int      { return 0 }
 
+// RawHTML returns if inline HTML is skipped or escaped.
+func (options *xml) RawHTML() (skip, escape bool) {
+	return options.flags&XML_SKIP_HTML != 0, options.flags&XML_ESCAPE_HTML != 0
+}
+
+// Capabilities returns what xml2rfc v3 can output: no footnotes, math, strike
+// through or parts.
+func (options *xml) Capabilities() int { return CAPABILITY_SVG | CAPABILITY_COLSPAN }
+
+func (options *xml) setParser(p *parser) { options.p = p }
+
 func (options *xml) SetAttr(i *inlineAttr) {
 	options.ial = i
 }
@@ -82,6 +103,9 @@ func (options *xml) AttrString(i *inlineAttr) string {
 	attr := make([]string, len(keys))
 	for j, k := range keys {
 		v := i.attr[k]
+		if k == "lang" {
+			k = "xml:lang"
+		}
 		attr[j] = k + "=\"" + v + "\""
 	}
 	if len(keys) > 0 {
@@ -91,7 +115,8 @@ func (options *xml) AttrString(i *inlineAttr) string {
 }
 
 // render code chunks using verbatim, or listings if we have a language
-func (options *xml) BlockCode(out *bytes.Buffer, text []byte, lang string, caption []byte, subfigure, callout bool) {
+func (options *xml) BlockCode(out *bytes.Buffer, text []byte, info CodeInfo, caption []byte, subfigure, callout bool) {
+	lang := info.Lang
 	if options.para {
 		// close it
 		out.WriteString("</t>")
@@ -103,6 +128,9 @@ func (options *xml) BlockCode(out *bytes.Buffer, text []byte, lang string, capti
 	if lang != "" {
 		ial.GetOrDefaultAttr("type", lang)
 	}
+	if info.Title != "" {
+		ial.GetOrDefaultAttr("name", info.Title)
+	}
 	prefix := ial.Value("prefix")
 	ial.DropAttr("prefix") // it's a fake attribute, so drop it
 
@@ -137,26 +165,30 @@ func (options *xml) BlockCode(out *bytes.Buffer, text []byte, lang string, capti
 }
 
 func (options *xml) CalloutCode(out *bytes.Buffer, index, id string) {
-	printf(nil, "TODO implement: CalloutCode")
+	unsupported(options.p, "CalloutCode", "")
 }
 
 func (options *xml) CalloutText(out *bytes.Buffer, index string, id []string) {
-	printf(nil, "TODO implement: CalloutText")
+	unsupported(options.p, "CalloutText", "")
 }
 
-func (options *xml) TitleBlockTOML(out *bytes.Buffer, block *title) {
+func (options *xml) TitleBlockTOML(out *bytes.Buffer, block *TitleBlock) {
 	if options.flags&XML_STANDALONE == 0 {
 		return
 	}
 	// Processing Instructions are attribute of <rfc> know.
 	options.titleBlock = block
+	xmlCoding(out, block)
 	out.WriteString("<rfc xmlns:xi=\"http://www.w3.org/2001/XInclude\"")
-	out.WriteString(" ipr=\"" + options.titleBlock.Ipr + "\"")
-	out.WriteString(" category=\"" + options.titleBlock.Category + "\"")
+	out.WriteString(" ipr=\"" + escapeString(options.titleBlock.Ipr) + "\"")
+	out.WriteString(" category=\"" + escapeString(options.titleBlock.Category) + "\"")
 	if options.titleBlock.Number > 0 {
 		out.WriteString(fmt.Sprintf(" number=\"%d\"", options.titleBlock.Number))
 	}
-	out.WriteString(" docName=\"" + options.titleBlock.DocName + "\">")
+	out.WriteString(" docName=\"" + escapeString(options.titleBlock.DocName) + "\"")
+	if options.titleBlock.Language != "" {
+		out.WriteString(" xml:lang=\"" + escapeString(options.titleBlock.Language) + "\"")
+	}
 	if len(options.titleBlock.Updates) > 0 {
 		updates := make([]string, len(options.titleBlock.Updates))
 		for i := range updates {
@@ -171,10 +203,11 @@ func (options *xml) TitleBlockTOML(out *bytes.Buffer, block *title) {
 		}
 		out.WriteString(" obsoletes=\"" + strings.Join(obsoletes, ", ") + "\"")
 	}
-	out.WriteString("\n")
+	out.WriteString(titleBlockTOMLPIAttributes(options.p, options.titleBlock.PI))
+	out.WriteString(">\n")
 	out.WriteString("<front>\n")
-	out.WriteString("<title abbrev=\"" + options.titleBlock.Abbrev + "\">")
-	out.WriteString(options.titleBlock.Title + "</title>\n\n")
+	out.WriteString("<title abbrev=\"" + escapeString(options.titleBlock.Abbrev) + "\">")
+	out.WriteString(escapeString(options.titleBlock.Title) + "</title>\n\n")
 
 	for _, a := range options.titleBlock.Author {
 		titleBlockTOMLAuthor(out, a)
@@ -182,8 +215,8 @@ func (options *xml) TitleBlockTOML(out *bytes.Buffer, block *title) {
 
 	titleBlockTOMLDate(out, options.titleBlock.Date)
 
-	out.WriteString("<area>" + options.titleBlock.Area + "</area>\n")
-	out.WriteString("<workgroup>" + options.titleBlock.Workgroup + "</workgroup>\n")
+	out.WriteString("<area>" + escapeString(options.titleBlock.Area) + "</area>\n")
+	out.WriteString("<workgroup>" + escapeString(options.titleBlock.Workgroup) + "</workgroup>\n")
 
 	titleBlockTOMLKeyword(out, options.titleBlock.Keyword)
 	out.WriteString("\n")
@@ -197,9 +230,10 @@ func (options *xml) BlockQuote(out *bytes.Buffer, text []byte, attribution []byt
 		parts := bytes.Split(attribution, []byte(" -- "))
 		if len(parts) == 2 {
 			cite := string(bytes.TrimSpace(parts[0]))
-			quotedFrom := sanitizeXML(bytes.TrimSpace(parts[1]))
+			var quotedFrom bytes.Buffer
+			writePlainXML(options.p, &quotedFrom, bytes.TrimSpace(parts[1]), "a quote source")
 			ial.GetOrDefaultAttr("cite", cite)
-			ial.GetOrDefaultAttr("quotedFrom", string(quotedFrom))
+			ial.GetOrDefaultAttr("quotedFrom", quotedFrom.String())
 		}
 	}
 
@@ -254,11 +288,11 @@ func (options *xml) CommentHtml(out *bytes.Buffer, text []byte) {
 
 func (options *xml) BlockHtml(out *bytes.Buffer, text []byte) {
 	// not supported, don't know yet if this is useful
-	return
+	unsupported(options.p, "BlockHtml", "")
 }
 
 func (options *xml) Part(out *bytes.Buffer, text func() bool, id string) {
-	printf(nil, "syntax not supported: Part")
+	unsupported(options.p, "Part", "")
 }
 
 func (options *xml) Note(out *bytes.Buffer, text func() bool, id string) {
@@ -278,6 +312,8 @@ func (options *xml) Note(out *bytes.Buffer, text func() bool, id string) {
 
 	ial := options.Attr()
 
+	options.pn.specialSection("note")
+
 	out.WriteString("\n<note" + options.AttrString(ial) + ">\n")
 	out.WriteString("<name>")
 	text()
@@ -289,7 +325,7 @@ func (options *xml) Note(out *bytes.Buffer, text func() bool, id string) {
 
 func (options *xml) SpecialHeader(out *bytes.Buffer, what []byte, text func() bool, id string) {
 	if string(what) == "preface" {
-		printf(nil, "handling preface like abstract")
+		printf(options.p, "handling preface like abstract")
 		what = []byte("abstract")
 	}
 	switch options.specialSection {
@@ -308,6 +344,8 @@ func (options *xml) SpecialHeader(out *bytes.Buffer, what []byte, text func() bo
 
 	ial := options.Attr()
 
+	options.pn.specialSection(string(what))
+
 	out.WriteString("\n<abstract" + options.AttrString(ial) + ">\n")
 	options.sectionLevel = 0
 	options.specialSection = _ABSTRACT
@@ -330,6 +368,8 @@ func (options *xml) Header(out *bytes.Buffer, text func() bool, level int, id st
 
 	ial := options.Attr()
 	ial.GetOrDefaultId(id)
+	ial.DropAttr("aliases") // only HTML has more anchors
+	options.pn.header(level)
 
 	// new section
 	out.WriteString("\n<section" + options.AttrString(ial) + ">\n")
@@ -342,7 +382,18 @@ func (options *xml) Header(out *bytes.Buffer, text func() bool, level int, id st
 }
 
 func (options *xml) HRule(out *bytes.Buffer) {
-	printf(nil, "syntax not supported: HRule")
+	transition(out)
+}
+
+// transition outputs a horizontal rule as a paragraph holding Transition.
+func transition(out *bytes.Buffer) {
+	if Transition == "" {
+		out.WriteString("<t />\n")
+		return
+	}
+	out.WriteString("<t>")
+	attrEscape(out, []byte(Transition))
+	out.WriteString("</t>\n")
 }
 
 func (options *xml) List(out *bytes.Buffer, text func() bool, flags, start int, group []byte) {
@@ -387,6 +438,7 @@ func (options *xml) List(out *bytes.Buffer, text func() bool, flags, start int,
 
 	if !text() {
 		out.Truncate(marker)
+		truncated(options.p, "List")
 		return
 	}
 	switch {
@@ -427,9 +479,18 @@ func (options *xml) Paragraph(out *bytes.Buffer, text func() bool, flags int) {
 	marker := out.Len()
 	options.para = true
 	defer func() { options.para = false }()
-	out.WriteString("<t>\n")
+	s := ""
+	if options.ial != nil && options.ial.Value("lang") != "" {
+		s = " xml:lang=\"" + escapeString(options.ial.Value("lang")) + "\""
+	}
+	if options.flags&XML_PARAGRAPH_NUMBERS != 0 && options.p != nil && options.p.nesting == 1 {
+		out.WriteString("<t pn=\"" + options.pn.next() + "\"" + s + ">\n")
+	} else {
+		out.WriteString("<t" + s + ">\n")
+	}
 	if !text() {
 		out.Truncate(marker)
+		truncated(options.p, "Paragraph")
 		return
 	}
 	if marker+3 == out.Len() { // empty paragraph, suppress
@@ -441,7 +502,7 @@ func (options *xml) Paragraph(out *bytes.Buffer, text func() bool, flags int) {
 }
 
 func (options *xml) Math(out *bytes.Buffer, text []byte, display bool) {
-	printf(nil, "syntax not supported: Math")
+	unsupported(options.p, "Math", "")
 }
 
 func (options *xml) Table(out *bytes.Buffer, header []byte, body []byte, footer []byte, columnData []int, caption []byte) {
@@ -500,13 +561,16 @@ func (options *xml) TableCell(out *bytes.Buffer, text []byte, align, colspan int
 }
 
 func (options *xml) Footnotes(out *bytes.Buffer, text func() bool) {
-	printf(nil, "syntax not supported: Footnotes")
+	unsupported(options.p, "Footnotes", "")
 }
 
 func (options *xml) FootnoteItem(out *bytes.Buffer, name, text []byte, flags int) {
-	printf(nil, "syntax not supported: FootnoteItem")
+	unsupported(options.p, "FootnoteItem", "")
 }
 
+// Unnumbered makes the section with the attributes ial unnumbered.
+func (options *xml) Unnumbered(ial *inlineAttr) { ial.attr["numbered"] = "false" }
+
 func (options *xml) Index(out *bytes.Buffer, primary, secondary []byte, prim bool) {
 	p := ""
 	if prim {
@@ -521,6 +585,14 @@ func (options *xml) Citation(out *bytes.Buffer, link, title []byte) {
 		out.WriteString("<xref target=\"" + string(link) + "\"/>")
 		return
 	}
+	if part, ok := citationSection(title); ok {
+		out.WriteString("<xref target=\"" + string(link) + "\" section=\"" + part.section + "\" sectionFormat=\"" + part.format + "\"")
+		if part.relative != "" {
+			out.WriteString(" relative=\"" + part.relative + "\"")
+		}
+		out.WriteString("/>")
+		return
+	}
 	out.WriteString("<xref target=\"" + string(link) + "\" section=\"" + string(title) + "\"/>")
 }
 
@@ -545,45 +617,32 @@ func (options *xml) References(out *bytes.Buffer, citations map[string]*citation
 	}
 	options.docLevel = _DOC_BACK_MATTER
 
-	refi, refn, keys := countCitationsAndSort(citations)
+	_, _, keys := countCitationsAndSort(citations)
 
 	// output <xi:include href="<references file>.xml"/>, we use file it its not empty, otherwise
 	// we construct one for RFCNNNN and I-D.something something.
-	if refi+refn > 0 {
-		if refn > 0 {
-			out.WriteString("<references>\n")
-			out.WriteString("<name>Normative References</name>\n")
-			for _, k := range keys {
-				c := citations[k]
-				if c.typ == 'n' {
-					if c.xml != nil {
-						out.Write(c.xml)
-						out.WriteByte('\n')
-						continue
-					}
-					f := referenceFile(c)
-					out.WriteString("<xi:include href=\"" + f + "\"/>\n")
-				}
+	for _, g := range referenceGroups(options.titleBlock) {
+		opened := false
+		for _, k := range keys {
+			c := citations[k]
+			if c.typ != g.typ {
+				continue
 			}
-			out.WriteString("</references>\n")
-		}
-		if refi > 0 {
-			// This needs an anchor
-			out.WriteString("<references>\n")
-			out.WriteString("<name>Informative References</name>\n")
-			for _, k := range keys {
-				c := citations[k]
-				if c.typ == 'i' {
-					// if we have raw xml, output that
-					if c.xml != nil {
-						out.Write(c.xml)
-						out.WriteByte('\n')
-						continue
-					}
-					f := referenceFile(c)
-					out.WriteString("<xi:include href=\"" + f + "\"/>\n")
-				}
+			if !opened {
+				out.WriteString("<references>\n")
+				out.WriteString("<name>" + escapeString(g.title) + "</name>\n")
+				opened = true
 			}
+			// if we have raw xml, output that
+			if c.xml != nil {
+				out.Write(c.xml)
+				out.WriteByte('\n')
+				continue
+			}
+			f := referenceFile(options.p, c)
+			out.WriteString("<xi:include href=\"" + f + "\"/>\n")
+		}
+		if opened {
 			out.WriteString("</references>\n")
 		}
 	}
@@ -599,9 +658,20 @@ func (options *xml) AutoLink(out *bytes.Buffer, link []byte, kind int) {
 }
 
 func (options *xml) CodeSpan(out *bytes.Buffer, text []byte) {
-	out.WriteString("<tt>")
-	writeEntity(out, text)
-	out.WriteString("</tt>")
+	switch codeRole(options.Attr()) {
+	case roleKbd:
+		out.WriteString("<strong><tt>")
+		writeEntity(out, text)
+		out.WriteString("</tt></strong>")
+	case roleSamp:
+		out.WriteString("<em>")
+		writeEntity(out, text)
+		out.WriteString("</em>")
+	default:
+		out.WriteString("<tt>")
+		writeEntity(out, text)
+		out.WriteString("</tt>")
+	}
 }
 
 func (options *xml) DoubleEmphasis(out *bytes.Buffer, text []byte) {
@@ -705,11 +775,25 @@ func (options *xml) Abbreviation(out *bytes.Buffer, abbr, title []byte) {
 
 func (options *xml) RawHtmlTag(out *bytes.Buffer, tag []byte) {
 	switch {
-	case bytes.Compare(tag, []byte("<br/>")) == 0:
-		out.WriteString("<vspace/>")
+	case options.flags&XML_SKIP_HTML != 0:
+		return
+	case options.flags&XML_ESCAPE_HTML != 0:
+		attrEscape(out, tag)
 		return
 	}
-	printf(nil, "syntax not supported: RawHtmlTag: %s", string(tag))
+	// We map the tags that have an XML2RFC equivalent.
+	switch name, closing := htmlTagName(tag); name {
+	case "br":
+		out.WriteString("<vspace/>")
+	case "sup", "sub", "tt", "em", "strong":
+		if closing {
+			out.WriteString("</" + name + ">")
+			return
+		}
+		out.WriteString("<" + name + ">")
+	default:
+		unsupported(options.p, "RawHtmlTag", string(tag))
+	}
 }
 
 func (options *xml) TripleEmphasis(out *bytes.Buffer, text []byte) {
@@ -719,15 +803,39 @@ func (options *xml) TripleEmphasis(out *bytes.Buffer, text []byte) {
 }
 
 func (options *xml) StrikeThrough(out *bytes.Buffer, text []byte) {
+	unsupported(options.p, "StrikeThrough", "")
+	out.Write(text)
+}
+
+// Changes are made visible with a cref.
+func (options *xml) Insertion(out *bytes.Buffer, text []byte) {
+	out.WriteString("<cref>Insert: ")
+	out.Write(text)
+	out.WriteString("</cref>")
+}
+
+func (options *xml) Deletion(out *bytes.Buffer, text []byte) {
+	out.WriteString("<cref>Delete: ")
+	out.Write(text)
+	out.WriteString("</cref>")
+}
+
+func (options *xml) CriticComment(out *bytes.Buffer, text []byte) {
+	out.WriteString("<cref>")
+	out.Write(text)
+	out.WriteString("</cref>")
+}
+
+func (options *xml) Highlight(out *bytes.Buffer, text []byte) {
 	out.Write(text)
 }
 
 func (options *xml) FootnoteRef(out *bytes.Buffer, ref []byte, id int) {
-	printf(nil, "syntax not supported: FootnoteRef")
+	unsupported(options.p, "FootnoteRef", "")
 }
 
 func (options *xml) Entity(out *bytes.Buffer, entity []byte) {
-	out.Write(entity)
+	xmlEntity(options.p, out, entity, false)
 }
 
 func (options *xml) NormalText(out *bytes.Buffer, text []byte) {
@@ -739,7 +847,7 @@ func (options *xml) DocumentHeader(out *bytes.Buffer, first bool) {
 	if !first || options.flags&XML_STANDALONE == 0 {
 		return
 	}
-	out.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	out.WriteString(xmlDeclaration)
 }
 
 func (options *xml) DocumentFooter(out *bytes.Buffer, first bool) {
@@ -772,6 +880,7 @@ func (options *xml) DocumentFooter(out *bytes.Buffer, first bool) {
 }
 
 func (options *xml) DocumentMatter(out *bytes.Buffer, matter int) {
+	options.pn.matter(matter)
 	if options.flags&XML_STANDALONE == 0 {
 		return
 	}